@@ -175,11 +175,9 @@ func generateModel(featureDir, featureName string) error {
 	tStr := `package model
 
 import (
-	"context"
 	"time"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/unusualcodeorg/goserve/arch/mongo"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	mongod "go.mongodb.org/mongo-driver/mongo"
@@ -218,8 +216,12 @@ func (doc *%s) Validate() error {
 	return validate.Struct(doc)
 }
 
-func (*%s) EnsureIndexes(db mongo.Database) {
-	indexes := []mongod.IndexModel{
+func (*%s) GetCollectionName() string {
+	return CollectionName
+}
+
+func (*%s) GetIndexes() []mongod.IndexModel {
+	return []mongod.IndexModel{
 		{
 			Keys: bson.D{
 				{Key: "_id", Value: 1},
@@ -227,8 +229,6 @@ func (*%s) EnsureIndexes(db mongo.Database) {
 			},
 		},
 	}
-	
-	mongo.NewQueryBuilder[%s](db, CollectionName).Query(context.Background()).CreateIndexes(indexes)
 }
 
 `
@@ -0,0 +1,13 @@
+package auth
+
+import (
+	"github.com/unusualcodeorg/goserve/arch/micro"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// a user signed up, only the id is sent so that the events stream holds no personal data
+var UserSignedUp = micro.NewEventType[UserSignedUpPayload]("user.signed_up", 1)
+
+type UserSignedUpPayload struct {
+	UserID primitive.ObjectID `json:"userId"`
+}
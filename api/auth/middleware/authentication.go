@@ -58,7 +58,7 @@ func (m *authenticationProvider) Middleware() gin.HandlerFunc {
 			return
 		}
 
-		user, err := m.userService.FindUserById(userId)
+		user, err := m.userService.FindAuthUser(userId)
 		if err != nil {
 			m.Send(ctx).UnauthorizedError("permission denied: claims subject does not exists", err)
 			return
@@ -79,7 +79,7 @@ func TestAuthenticationProvider_VerifyTokenInvalid(t *testing.T) {
 func TestAuthenticationProvider_VerifyTokenInvalidClaim(t *testing.T) {
 	mockAuthService := new(auth.MockService)
 	mockUserService := new(user.MockService)
-	mockAuthService.AssertNotCalled(t, "FindUserById", mock.Anything)
+	mockAuthService.AssertNotCalled(t, "FindAuthUser", mock.Anything)
 
 	token := "Bearer token"
 	claims := &jwt.RegisteredClaims{}
@@ -102,7 +102,7 @@ func TestAuthenticationProvider_VerifyTokenInvalidClaim(t *testing.T) {
 func TestAuthenticationProvider_VerifyTokenInvalidClaimUser(t *testing.T) {
 	mockAuthService := new(auth.MockService)
 	mockUserService := new(user.MockService)
-	mockAuthService.AssertNotCalled(t, "FindUserById", mock.Anything)
+	mockAuthService.AssertNotCalled(t, "FindAuthUser", mock.Anything)
 
 	token := "Bearer token"
 	claims := &jwt.RegisteredClaims{}
@@ -133,7 +133,7 @@ func TestAuthenticationProvider_VerifyTokenInvalidUser(t *testing.T) {
 
 	mockAuthService.On("VerifyToken", "token").Return(claims, nil)
 	mockAuthService.On("ValidateClaims", claims).Return(true)
-	mockUserService.On("FindUserById", userId).Return(nil, errors.New("user not found"))
+	mockUserService.On("FindAuthUser", userId).Return(nil, errors.New("user not found"))
 
 	rr := network.MockTestAuthenticationProvider(
 		t,
@@ -158,7 +158,7 @@ func TestAuthenticationProvider_VerifyTokenInvalidKaystore(t *testing.T) {
 
 	mockAuthService.On("VerifyToken", "token").Return(claims, nil)
 	mockAuthService.On("ValidateClaims", claims).Return(true)
-	mockUserService.On("FindUserById", userId).Return(user, nil)
+	mockUserService.On("FindAuthUser", userId).Return(user, nil)
 	mockAuthService.On("FindKeystore", user, claims.ID).Return(nil, errors.New("not found"))
 
 	rr := network.MockTestAuthenticationProvider(
@@ -185,7 +185,7 @@ func TestAuthenticationProvider_Success(t *testing.T) {
 
 	mockAuthService.On("VerifyToken", "token").Return(claims, nil)
 	mockAuthService.On("ValidateClaims", claims).Return(true)
-	mockUserService.On("FindUserById", userId).Return(user, nil)
+	mockUserService.On("FindAuthUser", userId).Return(user, nil)
 	mockAuthService.On("FindKeystore", user, claims.ID).Return(keystore, nil)
 
 	mockHandler := func(ctx *gin.Context) {
@@ -1,11 +1,9 @@
 package model
 
 import (
-	"context"
 	"time"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/unusualcodeorg/goserve/arch/mongo"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	mongod "go.mongodb.org/mongo-driver/mongo"
@@ -53,11 +51,15 @@ func (apikey *ApiKey) Validate() error {
 	return validate.Struct(apikey)
 }
 
-func (*ApiKey) EnsureIndexes(db mongo.Database) {
-	indexes := []mongod.IndexModel{
+func (*ApiKey) GetCollectionName() string {
+	return ApiKeyCollectionName
+}
+
+func (*ApiKey) GetIndexes() []mongod.IndexModel {
+	return []mongod.IndexModel{
 		{
 			Keys: bson.D{
-				{Key: "code", Value: 1},
+				{Key: "key", Value: 1},
 				{Key: "status", Value: 1},
 			},
 		},
@@ -68,6 +70,4 @@ func (*ApiKey) EnsureIndexes(db mongo.Database) {
 			Options: options.Index().SetUnique(true),
 		},
 	}
-
-	mongo.NewQueryBuilder[ApiKey](db, ApiKeyCollectionName).Query(context.Background()).CreateIndexes(indexes)
 }
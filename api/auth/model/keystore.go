@@ -1,11 +1,9 @@
 package model
 
 import (
-	"context"
 	"time"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/unusualcodeorg/goserve/arch/mongo"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	mongod "go.mongodb.org/mongo-driver/mongo"
@@ -48,8 +46,12 @@ func (keystore *Keystore) Validate() error {
 	return validate.Struct(keystore)
 }
 
-func (*Keystore) EnsureIndexes(db mongo.Database) {
-	indexes := []mongod.IndexModel{
+func (*Keystore) GetCollectionName() string {
+	return KeystoreCollectionName
+}
+
+func (*Keystore) GetIndexes() []mongod.IndexModel {
+	return []mongod.IndexModel{
 		{
 			Keys: bson.D{
 				{Key: "client", Value: 1},
@@ -66,5 +68,4 @@ func (*Keystore) EnsureIndexes(db mongo.Database) {
 			},
 		},
 	}
-	mongo.NewQueryBuilder[Keystore](db, KeystoreCollectionName).Query(context.Background()).CreateIndexes(indexes)
 }
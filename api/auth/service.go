@@ -2,6 +2,9 @@ package auth
 
 import (
 	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -11,9 +14,13 @@ import (
 	userModel "github.com/unusualcodeorg/goserve/api/user/model"
 	"github.com/unusualcodeorg/goserve/arch/mongo"
 	"github.com/unusualcodeorg/goserve/arch/network"
+	"github.com/unusualcodeorg/goserve/arch/redis"
 	"github.com/unusualcodeorg/goserve/config"
 	"github.com/unusualcodeorg/goserve/utils"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongod "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -41,6 +48,10 @@ type service struct {
 	keystoreQueryBuilder mongo.QueryBuilder[model.Keystore]
 	apikeyQueryBuilder   mongo.QueryBuilder[model.ApiKey]
 	userService          user.Service
+	// the api key and the keystore are found on every request, nil when disabled
+	apikeyCache   redis.Cache[cachedApiKey]
+	keystoreCache redis.Cache[cachedKeystore]
+	cacheTTL      time.Duration
 	// token
 	rsaPrivateKey        *rsa.PrivateKey
 	rsaPublicKey         *rsa.PublicKey
@@ -50,8 +61,23 @@ type service struct {
 	tokenAudience        string
 }
 
+/*
+ * The ttl of the cached api keys, keystores and users, 0 when AUTH_CACHE is off
+ * a sign out, a deleted api key or a changed role is evicted at once, other changes show after the ttl
+ */
+func CacheTTL(env *config.Env) time.Duration {
+	if !env.AuthCache {
+		return 0
+	}
+	if env.AuthCacheTTLSec == 0 {
+		return time.Minute
+	}
+	return time.Duration(env.AuthCacheTTLSec) * time.Second
+}
+
 func NewService(
 	db mongo.Database,
+	store redis.Store,
 	env *config.Env,
 	userService user.Service,
 ) Service {
@@ -74,9 +100,22 @@ func NewService(
 		panic(err)
 	}
 
+	var apikeyCache redis.Cache[cachedApiKey]
+	var keystoreCache redis.Cache[cachedKeystore]
+	cacheTTL := CacheTTL(env)
+	if cacheTTL > 0 {
+		cacheConfig := redis.DefaultCacheConfig()
+		cacheConfig.Lock = false
+		apikeyCache = redis.NewCacheWithConfig[cachedApiKey](store, cacheConfig)
+		keystoreCache = redis.NewCacheWithConfig[cachedKeystore](store, cacheConfig)
+	}
+
 	return &service{
 		BaseService:          network.NewBaseService(),
 		userService:          userService,
+		apikeyCache:          apikeyCache,
+		keystoreCache:        keystoreCache,
+		cacheTTL:             cacheTTL,
 		keystoreQueryBuilder: mongo.NewQueryBuilder[model.Keystore](db, model.KeystoreCollectionName),
 		apikeyQueryBuilder:   mongo.NewQueryBuilder[model.ApiKey](db, model.ApiKeyCollectionName),
 		// token key
@@ -148,9 +187,18 @@ func (s *service) SignInBasic(signInDto *dto.SignInBasic) (*dto.UserAuth, error)
 }
 
 func (s *service) SignOut(keystore *model.Keystore) error {
-	filter := bson.M{"_id": keystore.ID}
-	_, err := s.keystoreQueryBuilder.SingleQuery().DeleteOne(filter)
-	return err
+	filter, err := mongo.NewFilter[model.Keystore]().Eq("_id", keystore.ID).Build()
+	if err != nil {
+		return err
+	}
+	_, err = s.keystoreQueryBuilder.SingleQuery().DeleteOne(filter)
+	if err != nil {
+		return err
+	}
+	if s.keystoreCache != nil {
+		s.keystoreCache.Delete(keystoreCacheKey(keystore.Client, keystore.PrimaryKey))
+	}
+	return nil
 }
 
 func (s *service) IsEmailRegisted(email string) bool {
@@ -272,13 +320,54 @@ func (s *service) CreateKeystore(client *userModel.User, primaryKey string, seco
 	return doc, nil
 }
 
+// the keystore found has no SecondaryKey, it is only read by FindRefreshKeystore
 func (s *service) FindKeystore(client *userModel.User, primaryKey string) (*model.Keystore, error) {
-	filter := bson.M{"client": client.ID, "pKey": primaryKey, "status": true}
-	return s.keystoreQueryBuilder.SingleQuery().FindOne(filter, nil)
+	if s.keystoreCache == nil {
+		return s.findKeystore(client, primaryKey)
+	}
+
+	cached, err := s.keystoreCache.GetOrLoad(keystoreCacheKey(client.ID, primaryKey), s.cacheTTL, func() (*cachedKeystore, error) {
+		keystore, err := s.findKeystore(client, primaryKey)
+		if errors.Is(err, mongod.ErrNoDocuments) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return newCachedKeystore(keystore), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cached == nil {
+		return nil, mongod.ErrNoDocuments
+	}
+	return cached.keystore(primaryKey), nil
+}
+
+func (s *service) findKeystore(client *userModel.User, primaryKey string) (*model.Keystore, error) {
+	filter, err := mongo.NewFilter[model.Keystore]().
+		Eq("client", client.ID).
+		Eq("pKey", primaryKey).
+		Eq("status", true).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	opts := options.FindOne().SetProjection(bson.D{{Key: "sKey", Value: 0}})
+	return s.keystoreQueryBuilder.SingleQuery().FindOne(filter, opts)
 }
 
 func (s *service) FindRefreshKeystore(client *userModel.User, primaryKey string, secondaryKey string) (*model.Keystore, error) {
-	filter := bson.M{"client": client.ID, "pKey": primaryKey, "sKey": secondaryKey, "status": true}
+	filter, err := mongo.NewFilter[model.Keystore]().
+		Eq("client", client.ID).
+		Eq("pKey", primaryKey).
+		Eq("sKey", secondaryKey).
+		Eq("status", true).
+		Build()
+	if err != nil {
+		return nil, err
+	}
 	return s.keystoreQueryBuilder.SingleQuery().FindOne(filter, nil)
 }
 
@@ -340,7 +429,35 @@ func (s *service) ValidateClaims(claims *jwt.RegisteredClaims) bool {
 }
 
 func (s *service) FindApiKey(key string) (*model.ApiKey, error) {
-	filter := bson.M{"key": key, "status": true}
+	if s.apikeyCache == nil {
+		return s.findApiKey(key)
+	}
+
+	// the invalid keys are cached as not found too, so that they can't flood the database
+	cached, err := s.apikeyCache.GetOrLoad(apikeyCacheKey(key), s.cacheTTL, func() (*cachedApiKey, error) {
+		apikey, err := s.findApiKey(key)
+		if errors.Is(err, mongod.ErrNoDocuments) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return newCachedApiKey(apikey), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cached == nil {
+		return nil, mongod.ErrNoDocuments
+	}
+	return cached.apikey(key), nil
+}
+
+func (s *service) findApiKey(key string) (*model.ApiKey, error) {
+	filter, err := mongo.NewFilter[model.ApiKey]().Eq("key", key).Eq("status", true).Build()
+	if err != nil {
+		return nil, err
+	}
 
 	apikey, err := s.apikeyQueryBuilder.SingleQuery().FindOne(filter, nil)
 	if err != nil {
@@ -359,14 +476,104 @@ func (s *service) CreateApiKey(key string, version int, permissions []model.Perm
 	}
 
 	doc.ID = *id
+	// the key may be cached as not found
+	s.evictApiKey(key)
 	return doc, nil
 }
 
 func (s *service) DeleteApiKey(apikey *model.ApiKey) (bool, error) {
-	filter := bson.M{"_id": apikey.ID}
+	filter, err := mongo.NewFilter[model.ApiKey]().Eq("_id", apikey.ID).Build()
+	if err != nil {
+		return false, err
+	}
 	result, err := s.apikeyQueryBuilder.SingleQuery().DeleteOne(filter)
 	if err != nil {
 		return false, err
 	}
+	s.evictApiKey(apikey.Key)
 	return result.DeletedCount > 0, nil
 }
+
+func (s *service) evictApiKey(key string) {
+	if s.apikeyCache != nil {
+		s.apikeyCache.Delete(apikeyCacheKey(key))
+	}
+}
+
+/*
+ * The api keys and keystores are cached without their secrets, the keys are restored from the lookups
+ * the secrets are not stored in the redis key names either
+ */
+type cachedApiKey struct {
+	ID          primitive.ObjectID `json:"_id"`
+	Version     int                `json:"version"`
+	Permissions []model.Permission `json:"permissions"`
+	Comments    []string           `json:"comments"`
+	Status      bool               `json:"status"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt"`
+}
+
+func newCachedApiKey(apikey *model.ApiKey) *cachedApiKey {
+	return &cachedApiKey{
+		ID:          apikey.ID,
+		Version:     apikey.Version,
+		Permissions: apikey.Permissions,
+		Comments:    apikey.Comments,
+		Status:      apikey.Status,
+		CreatedAt:   apikey.CreatedAt,
+		UpdatedAt:   apikey.UpdatedAt,
+	}
+}
+
+func (c *cachedApiKey) apikey(key string) *model.ApiKey {
+	return &model.ApiKey{
+		ID:          c.ID,
+		Key:         key,
+		Version:     c.Version,
+		Permissions: c.Permissions,
+		Comments:    c.Comments,
+		Status:      c.Status,
+		CreatedAt:   c.CreatedAt,
+		UpdatedAt:   c.UpdatedAt,
+	}
+}
+
+type cachedKeystore struct {
+	ID        primitive.ObjectID `json:"_id"`
+	Client    primitive.ObjectID `json:"client"`
+	Status    bool               `json:"status"`
+	CreatedAt time.Time          `json:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt"`
+}
+
+func newCachedKeystore(keystore *model.Keystore) *cachedKeystore {
+	return &cachedKeystore{
+		ID:        keystore.ID,
+		Client:    keystore.Client,
+		Status:    keystore.Status,
+		CreatedAt: keystore.CreatedAt,
+		UpdatedAt: keystore.UpdatedAt,
+	}
+}
+
+func (c *cachedKeystore) keystore(primaryKey string) *model.Keystore {
+	return &model.Keystore{
+		ID:         c.ID,
+		Client:     c.Client,
+		PrimaryKey: primaryKey,
+		Status:     c.Status,
+		CreatedAt:  c.CreatedAt,
+		UpdatedAt:  c.UpdatedAt,
+	}
+}
+
+func apikeyCacheKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "apikey_" + hex.EncodeToString(sum[:])
+}
+
+func keystoreCacheKey(client primitive.ObjectID, primaryKey string) string {
+	sum := sha256.Sum256([]byte(primaryKey))
+	return "keystore_" + client.Hex() + "_" + hex.EncodeToString(sum[:])
+}
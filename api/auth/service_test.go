@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/unusualcodeorg/goserve/api/auth/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCachedApiKeyHasNoKey(t *testing.T) {
+	apikey := model.NewApiKey("secret-api-key", 1, []model.Permission{model.GeneralPermission}, []string{"test"})
+	apikey.ID = primitive.NewObjectID()
+
+	data, err := json.Marshal(newCachedApiKey(apikey))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "secret-api-key")
+
+	var cached cachedApiKey
+	assert.NoError(t, json.Unmarshal(data, &cached))
+	restored := cached.apikey("secret-api-key")
+	assert.Equal(t, apikey.ID, restored.ID)
+	assert.Equal(t, apikey.Key, restored.Key)
+	assert.Equal(t, apikey.Permissions, restored.Permissions)
+	assert.True(t, restored.Status)
+}
+
+func TestCachedKeystoreHasNoKeys(t *testing.T) {
+	keystore, err := model.NewKeystore(primitive.NewObjectID(), "primary-key", "secondary-key")
+	assert.NoError(t, err)
+	keystore.ID = primitive.NewObjectID()
+
+	data, err := json.Marshal(newCachedKeystore(keystore))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "primary-key")
+	assert.NotContains(t, string(data), "secondary-key")
+
+	var cached cachedKeystore
+	assert.NoError(t, json.Unmarshal(data, &cached))
+	restored := cached.keystore("primary-key")
+	assert.Equal(t, keystore.ID, restored.ID)
+	assert.Equal(t, keystore.Client, restored.Client)
+	assert.Equal(t, "primary-key", restored.PrimaryKey)
+	assert.Empty(t, restored.SecondaryKey)
+}
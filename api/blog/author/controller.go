@@ -65,14 +65,21 @@ func (c *controller) updateBlogHandler(ctx *gin.Context) {
 		return
 	}
 
+	version, err := network.ReqIfMatch(ctx)
+	if err != nil {
+		c.Send(ctx).BadRequestError(err.Error(), err)
+		return
+	}
+
 	user := c.MustGetUser(ctx)
 
-	b, err := c.service.UpdateBlog(body, user)
+	b, err := c.service.UpdateBlog(body, user, version)
 	if err != nil {
 		c.Send(ctx).MixedError(err)
 		return
 	}
 
+	network.SetETag(ctx, b.Version)
 	c.Send(ctx).SuccessDataResponse("blog updated successfully", b)
 }
 
@@ -91,6 +98,7 @@ func (c *controller) getBlogHandler(ctx *gin.Context) {
 		return
 	}
 
+	network.SetETag(ctx, blog.Version)
 	c.Send(ctx).SuccessDataResponse("success", blog)
 }
 
@@ -1,11 +1,13 @@
 package author
 
 import (
+	"errors"
 	"time"
 
 	"github.com/unusualcodeorg/goserve/api/blog"
 	"github.com/unusualcodeorg/goserve/api/blog/dto"
 	"github.com/unusualcodeorg/goserve/api/blog/model"
+	"github.com/unusualcodeorg/goserve/api/user"
 	userModel "github.com/unusualcodeorg/goserve/api/user/model"
 	coredto "github.com/unusualcodeorg/goserve/arch/dto"
 	"github.com/unusualcodeorg/goserve/arch/mongo"
@@ -13,12 +15,13 @@ import (
 	"github.com/unusualcodeorg/goserve/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongod "go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Service interface {
 	CreateBlog(createBlogDto *dto.CreateBlog, author *userModel.User) (*dto.PrivateBlog, error)
-	UpdateBlog(updateBlogDto *dto.UpdateBlog, author *userModel.User) (*dto.PrivateBlog, error)
+	UpdateBlog(updateBlogDto *dto.UpdateBlog, author *userModel.User, version *int64) (*dto.PrivateBlog, error)
 	DeactivateBlog(blogId primitive.ObjectID, author *userModel.User) error
 	BlogSubmission(blogId primitive.ObjectID, author *userModel.User, submit bool) error
 	GetBlogById(id primitive.ObjectID, author *userModel.User) (*dto.PrivateBlog, error)
@@ -31,13 +34,15 @@ type Service interface {
 type service struct {
 	network.BaseService
 	blogQueryBuilder mongo.QueryBuilder[model.Blog]
+	userService      user.Service
 	blogService      blog.Service
 }
 
-func NewService(db mongo.Database, blogService blog.Service) Service {
+func NewService(db mongo.Database, userService user.Service, blogService blog.Service) Service {
 	return &service{
 		BaseService:      network.NewBaseService(),
 		blogQueryBuilder: mongo.NewQueryBuilder[model.Blog](db, model.CollectionName),
+		userService:      userService,
 		blogService:      blogService,
 	}
 }
@@ -60,27 +65,25 @@ func (s *service) CreateBlog(b *dto.CreateBlog, author *userModel.User) (*dto.Pr
 		return nil, err
 	}
 
-	return dto.NewPrivateBlog(created, author)
+	return s.privateBlog(created, author)
 }
 
-func (s *service) UpdateBlog(b *dto.UpdateBlog, author *userModel.User) (*dto.PrivateBlog, error) {
+func (s *service) UpdateBlog(b *dto.UpdateBlog, author *userModel.User, version *int64) (*dto.PrivateBlog, error) {
 	filter := bson.M{"_id": b.ID, "author": author.ID, "status": true}
-	blog, err := s.blogQueryBuilder.SingleQuery().FindOne(filter, nil)
-	if err != nil {
-		return nil, network.NewNotFoundError("Blog with id: "+b.ID.Hex()+" does not exists", nil)
-	}
 
 	updates := bson.M{}
 
 	if b.Slug != nil {
 		slug := utils.FormatEndpoint(*b.Slug)
-		if slug != blog.Slug {
-			exists := s.blogService.BlogSlugExists(slug)
-			if exists {
-				return nil, network.NewBadRequestError("Blog with slug: "+slug+" already exists", nil)
-			}
-			updates["slug"] = slug
+		taken := bson.M{"slug": slug, "_id": bson.M{"$ne": b.ID}}
+		count, err := s.blogQueryBuilder.SingleQuery().CountDocuments(taken, options.Count().SetLimit(1))
+		if err != nil {
+			return nil, err
 		}
+		if count > 0 {
+			return nil, network.NewBadRequestError("Blog with slug: "+slug+" already exists", nil)
+		}
+		updates["slug"] = slug
 	}
 
 	if b.Title != nil {
@@ -106,18 +109,41 @@ func (s *service) UpdateBlog(b *dto.UpdateBlog, author *userModel.User) (*dto.Pr
 	updates["updatedBy"] = author.ID
 	updates["updatedAt"] = time.Now()
 
-	set := bson.M{"$set": updates}
-	_, err = s.blogQueryBuilder.SingleQuery().UpdateOne(filter, set)
+	var updated *model.Blog
+	var err error
+	if version != nil {
+		set := bson.M{"$set": updates}
+		updated, err = s.blogQueryBuilder.SingleQuery().FindOneAndUpdateVersioned(filter, *version, set)
+	} else {
+		set := bson.M{"$set": updates, "$inc": bson.M{mongo.VersionField: 1}}
+		updated, err = s.blogQueryBuilder.SingleQuery().FindOneAndUpdate(filter, set, nil)
+	}
+
+	if errors.Is(err, mongo.ErrVersionConflict) {
+		return nil, blog.ConflictError(err)
+	}
+	if errors.Is(err, mongod.ErrNoDocuments) {
+		return nil, network.NewNotFoundError("Blog with id: "+b.ID.Hex()+" does not exists", nil)
+	}
+	if mongod.IsDuplicateKeyError(err) && b.Slug != nil {
+		return nil, network.NewBadRequestError("Blog with slug: "+utils.FormatEndpoint(*b.Slug)+" already exists", err)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return s.GetBlogById(blog.ID, author)
+	// the change stream evicts it as well, this is for the setups without one
+	s.blogService.EvictBlogDtoCache(updated.ID, updated.Slug)
+
+	return s.privateBlog(updated, author)
 }
 
 func (s *service) DeactivateBlog(blogId primitive.ObjectID, author *userModel.User) error {
 	filter := bson.M{"_id": blogId, "author": author.ID, "status": true}
-	update := bson.M{"$set": bson.M{"status": false, "updatedBy": author.ID, "updatedAt": time.Now()}}
+	update := bson.M{
+		"$set": bson.M{"status": false, "updatedBy": author.ID, "updatedAt": time.Now()},
+		"$inc": bson.M{mongo.VersionField: 1},
+	}
 	result, err := s.blogQueryBuilder.SingleQuery().UpdateOne(filter, update)
 	if err != nil {
 		return err
@@ -127,12 +153,17 @@ func (s *service) DeactivateBlog(blogId primitive.ObjectID, author *userModel.Us
 		return network.NewNotFoundError("blog not found", nil)
 	}
 
+	s.blogService.EvictBlogDtoCache(blogId)
+
 	return nil
 }
 
 func (s *service) BlogSubmission(blogId primitive.ObjectID, author *userModel.User, submit bool) error {
 	filter := bson.M{"_id": blogId, "author": author.ID, "status": true}
-	update := bson.M{"$set": bson.M{"submitted": submit, "updatedBy": author.ID, "updatedAt": time.Now()}}
+	update := bson.M{
+		"$set": bson.M{"submitted": submit, "updatedBy": author.ID, "updatedAt": time.Now()},
+		"$inc": bson.M{mongo.VersionField: 1},
+	}
 	result, err := s.blogQueryBuilder.SingleQuery().UpdateOne(filter, update)
 	if err != nil {
 		return err
@@ -153,7 +184,16 @@ func (s *service) GetBlogById(id primitive.ObjectID, author *userModel.User) (*d
 		return nil, err
 	}
 
-	return dto.NewPrivateBlog(blog, author)
+	return s.privateBlog(blog, author)
+}
+
+// the author of the request has no profile fields, see user.Service FindAuthUser
+func (s *service) privateBlog(blog *model.Blog, author *userModel.User) (*dto.PrivateBlog, error) {
+	profile, err := s.userService.FindUserPublicProfile(author.ID)
+	if err != nil {
+		return nil, err
+	}
+	return dto.NewPrivateBlog(blog, profile)
 }
 
 func (s *service) GetPaginatedDrafts(author *userModel.User, p *coredto.Pagination) ([]*dto.InfoBlog, error) {
@@ -34,20 +34,13 @@ func (c *controller) getBlogByIdHandler(ctx *gin.Context) {
 		return
 	}
 
-	blog, err := c.service.GetBlogDtoCacheById(mongoId.ID)
-	if err == nil {
-		c.Send(ctx).SuccessDataResponse("success", blog)
-		return
-	}
-
-	blog, err = c.service.GetPublisedBlogById(mongoId.ID)
+	blog, err := c.service.GetPublisedBlogById(mongoId.ID)
 	if err != nil {
 		c.Send(ctx).MixedError(err)
 		return
 	}
 
 	c.Send(ctx).SuccessDataResponse("success", blog)
-	c.service.SetBlogDtoCacheById(blog)
 }
 
 func (c *controller) getBlogBySlugHandler(ctx *gin.Context) {
@@ -57,18 +50,11 @@ func (c *controller) getBlogBySlugHandler(ctx *gin.Context) {
 		return
 	}
 
-	blog, err := c.service.GetBlogDtoCacheBySlug(slug.Slug)
-	if err == nil {
-		c.Send(ctx).SuccessDataResponse("success", blog)
-		return
-	}
-
-	blog, err = c.service.GetPublishedBlogBySlug(slug.Slug)
+	blog, err := c.service.GetPublishedBlogBySlug(slug.Slug)
 	if err != nil {
 		c.Send(ctx).MixedError(err)
 		return
 	}
 
 	c.Send(ctx).SuccessDataResponse("success", blog)
-	c.service.SetBlogDtoCacheBySlug(blog)
 }
@@ -28,6 +28,7 @@ type PrivateBlog struct {
 	PublishedAt *time.Time         `json:"publishedAt,omitempty"`
 	CreatedAt   time.Time          `json:"createdAt" validate:"required"`
 	UpdatedAt   time.Time          `json:"updatedAt" validate:"required"`
+	Version     int64              `json:"version"`
 }
 
 func EmptyInfoPrivateBlog() *PrivateBlog {
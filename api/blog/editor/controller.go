@@ -48,6 +48,7 @@ func (c *controller) getBlogHandler(ctx *gin.Context) {
 		return
 	}
 
+	network.SetETag(ctx, blog.Version)
 	c.Send(ctx).SuccessDataResponse("success", blog)
 }
 
@@ -58,9 +59,15 @@ func (c *controller) publishBlogHandler(ctx *gin.Context) {
 		return
 	}
 
+	version, err := network.ReqIfMatch(ctx)
+	if err != nil {
+		c.Send(ctx).BadRequestError(err.Error(), err)
+		return
+	}
+
 	user := c.MustGetUser(ctx)
 
-	err = c.service.BlogPublication(mongoId.ID, user, true)
+	err = c.service.BlogPublication(mongoId.ID, user, true, version)
 	if err != nil {
 		c.Send(ctx).MixedError(err)
 		return
@@ -76,9 +83,15 @@ func (c *controller) unpublishBlogHandler(ctx *gin.Context) {
 		return
 	}
 
+	version, err := network.ReqIfMatch(ctx)
+	if err != nil {
+		c.Send(ctx).BadRequestError(err.Error(), err)
+		return
+	}
+
 	user := c.MustGetUser(ctx)
 
-	err = c.service.BlogPublication(mongoId.ID, user, false)
+	err = c.service.BlogPublication(mongoId.ID, user, false, version)
 	if err != nil {
 		c.Send(ctx).MixedError(err)
 		return
@@ -1,23 +1,28 @@
 package editor
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/unusualcodeorg/goserve/api/blog"
 	"github.com/unusualcodeorg/goserve/api/blog/dto"
 	"github.com/unusualcodeorg/goserve/api/blog/model"
 	"github.com/unusualcodeorg/goserve/api/user"
 	userModel "github.com/unusualcodeorg/goserve/api/user/model"
 	coredto "github.com/unusualcodeorg/goserve/arch/dto"
+	"github.com/unusualcodeorg/goserve/arch/jobs"
 	"github.com/unusualcodeorg/goserve/arch/mongo"
 	"github.com/unusualcodeorg/goserve/arch/network"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongod "go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Service interface {
 	GetBlogById(id primitive.ObjectID) (*dto.PrivateBlog, error)
-	BlogPublication(blogId primitive.ObjectID, editor *userModel.User, publish bool) error
+	BlogPublication(blogId primitive.ObjectID, editor *userModel.User, publish bool, version *int64) error
 	GetPaginatedPublished(p *coredto.Pagination) ([]*dto.InfoBlog, error)
 	GetPaginatedSubmitted(p *coredto.Pagination) ([]*dto.InfoBlog, error)
 }
@@ -26,64 +31,106 @@ type service struct {
 	network.BaseService
 	blogQueryBuilder mongo.QueryBuilder[model.Blog]
 	userService      user.Service
+	blogService      blog.Service
+	queue            jobs.Queue
 }
 
-func NewService(db mongo.Database, userService user.Service) Service {
+func NewService(db mongo.Database, userService user.Service, blogService blog.Service, queue jobs.Queue) Service {
 	return &service{
 		BaseService:      network.NewBaseService(),
 		blogQueryBuilder: mongo.NewQueryBuilder[model.Blog](db, model.CollectionName),
 		userService:      userService,
+		blogService:      blogService,
+		queue:            queue,
 	}
 }
 
-func (s *service) BlogPublication(blogId primitive.ObjectID, editor *userModel.User, publish bool) error {
+func (s *service) BlogPublication(blogId primitive.ObjectID, editor *userModel.User, publish bool, version *int64) error {
+	now := time.Now()
 	filter := bson.M{"_id": blogId, "status": true}
-	blog, err := s.blogQueryBuilder.SingleQuery().FindOne(filter, nil)
-	if err != nil {
-		return network.NewNotFoundError("blog for _id "+blogId.Hex()+" not found", err)
-	}
 
+	var fields bson.M
 	if publish {
-		if blog.Published {
-			return network.NewBadRequestError("blog for _id "+blogId.Hex()+" is already published", err)
-		}
-		if !blog.Submitted {
-			return network.NewBadRequestError("blog for _id "+blogId.Hex()+" is not submitted", err)
+		filter["submitted"] = true
+		filter["published"] = false
+		fields = bson.M{
+			"drafted":     false,
+			"submitted":   false,
+			"published":   true,
+			"text":        "$draftText",
+			"publishedAt": bson.M{"$ifNull": bson.A{"$publishedAt", now}},
 		}
 	} else {
-		if !blog.Published {
-			return network.NewBadRequestError("blog for _id "+blogId.Hex()+" is not published", err)
-		}
+		filter["published"] = true
+		fields = bson.M{"drafted": true, "submitted": false, "published": false}
 	}
 
-	var update bson.M
+	fields["updatedBy"] = editor.ID
+	fields["updatedAt"] = now
 
-	if publish {
-		if blog.PublishedAt == nil {
-			now := time.Now()
-			blog.PublishedAt = &now
-		}
-		update = bson.M{"drafted": false, "submitted": false, "published": true, "text": blog.DraftText, "publishedAt": blog.PublishedAt}
+	var updated *model.Blog
+	var err error
+	if version != nil {
+		update := mongo.NewPipeline().Set(fields).Stages()
+		updated, err = s.blogQueryBuilder.SingleQuery().FindOneAndUpdateVersioned(filter, *version, update)
 	} else {
-		update = bson.M{"drafted": true, "submitted": false, "published": false}
+		fields[mongo.VersionField] = mongo.NextVersion
+		update := mongo.NewPipeline().Set(fields).Stages()
+		updated, err = s.blogQueryBuilder.SingleQuery().FindOneAndUpdate(filter, update, nil)
 	}
 
-	update["updatedBy"] = editor.ID
-	update["updatedAt"] = time.Now()
-
-	updated := bson.M{"$set": update}
-	result, err := s.blogQueryBuilder.SingleQuery().UpdateOne(filter, updated)
+	if errors.Is(err, mongo.ErrVersionConflict) {
+		return blog.ConflictError(err)
+	}
+	if errors.Is(err, mongod.ErrNoDocuments) {
+		return s.publicationError(blogId, publish)
+	}
 	if err != nil {
 		return err
 	}
 
-	if result.MatchedCount == 0 {
-		return network.NewNotFoundError("blog not found", nil)
+	// the slug may be cached as not found before the blog is published
+	s.blogService.EvictBlogDtoCache(updated.ID, updated.Slug)
+	if publish {
+		s.warmBlogCache(updated.ID, updated.Slug)
 	}
 
 	return nil
 }
 
+// the publication succeeds even if the job can't be enqueued, the cache fills on the first read
+func (s *service) warmBlogCache(id primitive.ObjectID, slug string) {
+	payload := blog.WarmCachePayload{BlogID: id, Slug: slug}
+	if _, err := blog.WarmCacheJob.Enqueue(s.Context(), s.queue, payload); err != nil {
+		fmt.Println("blog cache warm up not enqueued:", err)
+	}
+}
+
+// explains why the publication filter did not match the blog
+func (s *service) publicationError(blogId primitive.ObjectID, publish bool) error {
+	filter := bson.M{"_id": blogId, "status": true}
+	current, err := s.blogQueryBuilder.SingleQuery().FindOne(filter, nil)
+	if err != nil {
+		return network.NewNotFoundError("blog for _id "+blogId.Hex()+" not found", err)
+	}
+
+	if publish {
+		if current.Published {
+			return network.NewBadRequestError("blog for _id "+blogId.Hex()+" is already published", nil)
+		}
+		if !current.Submitted {
+			return network.NewBadRequestError("blog for _id "+blogId.Hex()+" is not submitted", nil)
+		}
+	} else {
+		if !current.Published {
+			return network.NewBadRequestError("blog for _id "+blogId.Hex()+" is not published", nil)
+		}
+	}
+
+	// the blog changed between the update and this read
+	return blog.ConflictError(mongo.ErrVersionConflict)
+}
+
 func (s *service) GetBlogById(id primitive.ObjectID) (*dto.PrivateBlog, error) {
 	filter := bson.M{"_id": id, "status": true}
 	blog, err := s.blogQueryBuilder.SingleQuery().FindOne(filter, nil)
@@ -0,0 +1,23 @@
+package blog
+
+import (
+	"github.com/unusualcodeorg/goserve/arch/micro"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// an author submitted the blog to the editors
+var BlogSubmitted = micro.NewEventType[BlogSubmittedPayload]("blog.submitted", 1)
+
+// an editor published the blog, it is readable from now on
+var BlogPublished = micro.NewEventType[BlogPublishedPayload]("blog.published", 1)
+
+type BlogSubmittedPayload struct {
+	BlogID   primitive.ObjectID `json:"blogId"`
+	AuthorID primitive.ObjectID `json:"authorId"`
+}
+
+type BlogPublishedPayload struct {
+	BlogID   primitive.ObjectID `json:"blogId"`
+	AuthorID primitive.ObjectID `json:"authorId"`
+	Slug     string             `json:"slug"`
+}
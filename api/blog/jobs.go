@@ -0,0 +1,14 @@
+package blog
+
+import (
+	"github.com/unusualcodeorg/goserve/arch/jobs"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// loads a blog just published into the cache, so that its first readers don't wait for the database
+var WarmCacheJob = jobs.NewType[WarmCachePayload]("blog.cache.warm")
+
+type WarmCachePayload struct {
+	BlogID primitive.ObjectID `json:"blogId"`
+	Slug   string             `json:"slug"`
+}
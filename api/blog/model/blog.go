@@ -1,12 +1,10 @@
 package model
 
 import (
-	"context"
 	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/unusualcodeorg/goserve/api/user/model"
-	"github.com/unusualcodeorg/goserve/arch/mongo"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	mongod "go.mongodb.org/mongo-driver/mongo"
@@ -35,6 +33,7 @@ type Blog struct {
 	UpdatedBy   primitive.ObjectID `bson:"updatedBy" validate:"required"`
 	CreatedAt   time.Time          `bson:"createdAt" validate:"required"`
 	UpdatedAt   time.Time          `bson:"updatedAt" validate:"required"`
+	Version     int64              `bson:"version"`
 }
 
 func NewBlog(slug, title, description, draftText string, tags []string, author *model.User) (*Blog, error) {
@@ -71,8 +70,12 @@ func (blog *Blog) Validate() error {
 	return validate.Struct(blog)
 }
 
-func (*Blog) EnsureIndexes(db mongo.Database) {
-	indexes := []mongod.IndexModel{
+func (*Blog) GetCollectionName() string {
+	return CollectionName
+}
+
+func (*Blog) GetIndexes() []mongod.IndexModel {
+	return []mongod.IndexModel{
 		{
 			Keys: bson.D{
 				{Key: "slug", Value: 1},
@@ -92,6 +95,17 @@ func (*Blog) EnsureIndexes(db mongo.Database) {
 		{Keys: bson.D{{Key: "slug", Value: 1}, {Key: "published", Value: 1}, {Key: "status", Value: 1}}},
 		{Keys: bson.D{{Key: "tags", Value: 1}, {Key: "published", Value: 1}, {Key: "status", Value: 1}}},
 	}
+}
+
+/*
+ * The redis cache tags of the entries made from the blog, see redis.Cache.Tag
+ * Example -> cache.InvalidateTag(model.BlogCacheTag(id)) evicts every cached entry showing the blog
+ */
+func BlogCacheTag(id primitive.ObjectID) string {
+	return "blog:" + id.Hex()
+}
 
-	mongo.NewQueryBuilder[Blog](db, CollectionName).Query(context.Background()).CreateIndexes(indexes)
+// only the blog itself is evicted on its changes, the tags of nothing invalidated would grow with every load
+func (b *Blog) CacheTags() []string {
+	return []string{BlogCacheTag(b.ID)}
 }
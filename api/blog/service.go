@@ -1,6 +1,9 @@
 package blog
 
 import (
+	"context"
+	"errors"
+	"net/http"
 	"time"
 
 	"github.com/unusualcodeorg/goserve/api/blog/dto"
@@ -12,18 +15,22 @@ import (
 	"github.com/unusualcodeorg/goserve/arch/redis"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongod "go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const publicBlogCacheTTL = 10 * time.Minute
+
 type Service interface {
-	SetBlogDtoCacheById(blog *dto.PublicBlog) error
 	GetBlogDtoCacheById(id primitive.ObjectID) (*dto.PublicBlog, error)
-	SetBlogDtoCacheBySlug(blog *dto.PublicBlog) error
 	GetBlogDtoCacheBySlug(slug string) (*dto.PublicBlog, error)
+	EvictBlogDtoCache(id primitive.ObjectID, slugs ...string) error
+	WarmBlogDtoCache(id primitive.ObjectID, slug string) error
+	WatchBlogChanges(ctx context.Context, tokens mongo.ResumeTokenStore) error
 	BlogSlugExists(slug string) bool
 	GetPublisedBlogById(id primitive.ObjectID) (*dto.PublicBlog, error)
 	GetPublishedBlogBySlug(slug string) (*dto.PublicBlog, error)
-	getPublicPublishedBlog(filter bson.M) (*dto.PublicBlog, error)
+	getPublicPublishedBlog(key string, filter bson.M) (*dto.PublicBlog, error)
 	getPaginated(filter bson.M, p *coredto.Pagination, opts *options.FindOptions) ([]*dto.InfoBlog, error)
 }
 
@@ -35,34 +42,108 @@ type service struct {
 }
 
 func NewService(db mongo.Database, store redis.Store, userService user.Service) Service {
+	// the hot blogs are served from memory, the edits evict them from every instance
+	cacheConfig := redis.DefaultCacheConfig()
+	cacheConfig.LocalSize = 1000
+	// the blog texts are large, they take less memory in redis compressed
+	cacheConfig.Codec = redis.MsgpackCodec
+	cacheConfig.Compression = redis.CompressionZstd
+
 	return &service{
 		BaseService:      network.NewBaseService(),
 		blogQueryBuilder: mongo.NewQueryBuilder[model.Blog](db, model.CollectionName),
-		publicBlogCache:  redis.NewCache[dto.PublicBlog](store),
+		publicBlogCache:  redis.NewCacheWithConfig[dto.PublicBlog](store, cacheConfig),
 		userService:      userService,
 	}
 }
 
-func (s *service) SetBlogDtoCacheById(blog *dto.PublicBlog) error {
-	key := "blog_" + blog.ID.Hex()
-	return s.publicBlogCache.SetJSON(key, blog, time.Duration(10*time.Minute))
-}
-
 func (s *service) GetBlogDtoCacheById(id primitive.ObjectID) (*dto.PublicBlog, error) {
 	key := "blog_" + id.Hex()
 	return s.publicBlogCache.GetJSON(key)
 }
 
-func (s *service) SetBlogDtoCacheBySlug(blog *dto.PublicBlog) error {
-	key := "blog_" + blog.Slug
-	return s.publicBlogCache.SetJSON(key, blog, time.Duration(10*time.Minute))
-}
-
 func (s *service) GetBlogDtoCacheBySlug(slug string) (*dto.PublicBlog, error) {
 	key := "blog_" + slug
 	return s.publicBlogCache.GetJSON(key)
 }
 
+/*
+ * evicts the entries tagged with the blog, in any cache, and the not found entries of its id and slugs
+ * the slugs are needed for a blog just published, its old not found entry is not tagged
+ */
+func (s *service) EvictBlogDtoCache(id primitive.ObjectID, slugs ...string) error {
+	keys := []string{"blog_" + id.Hex()}
+	for _, slug := range slugs {
+		if slug != "" {
+			keys = append(keys, "blog_"+slug)
+		}
+	}
+	return errors.Join(
+		s.publicBlogCache.InvalidateTag(model.BlogCacheTag(id)),
+		s.publicBlogCache.Delete(keys...),
+	)
+}
+
+// run by WarmCacheJob, a blog unpublished since is cached as not found
+func (s *service) WarmBlogDtoCache(id primitive.ObjectID, slug string) error {
+	_, err := s.GetPublisedBlogById(id)
+	if err == nil && slug != "" {
+		_, err = s.GetPublishedBlogBySlug(slug)
+	}
+
+	var apiErr network.ApiError
+	if errors.As(err, &apiErr) && apiErr.GetCode() == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+/*
+ * evicts the cached blog when the document changes from anywhere e.g. admin scripts
+ * blocks until ctx is done
+ */
+func (s *service) WatchBlogChanges(ctx context.Context, tokens mongo.ResumeTokenStore) error {
+	config := mongo.WatchConfig{
+		Name: "blog_cache",
+		Operations: []mongo.OperationType{
+			mongo.OperationUpdate,
+			mongo.OperationReplace,
+			mongo.OperationDelete,
+		},
+		Pipeline: mongo.NewPipeline().Project(bson.D{
+			{Key: "operationType", Value: 1},
+			{Key: "documentKey", Value: 1},
+			{Key: "fullDocument.slug", Value: 1},
+			{Key: "fullDocumentBeforeChange.slug", Value: 1},
+		}),
+		FullDocument:             true,
+		FullDocumentBeforeChange: true,
+		TokenStore:               tokens,
+	}
+	return s.blogQueryBuilder.Watch(ctx, config, s.evictOnChange)
+}
+
+func (s *service) evictOnChange(event *mongo.ChangeEvent[model.Blog]) error {
+	id, ok := event.ID.(primitive.ObjectID)
+	if !ok {
+		return nil
+	}
+
+	var slugs []string
+	if event.Document != nil {
+		slugs = append(slugs, event.Document.Slug)
+	}
+	if event.Previous != nil {
+		slugs = append(slugs, event.Previous.Slug)
+	}
+	// the old slug of a changed or deleted blog is known from the cache when pre-images are disabled
+	if cached, err := s.GetBlogDtoCacheById(id); err == nil {
+		slugs = append(slugs, cached.Slug)
+	}
+
+	return s.EvictBlogDtoCache(id, slugs...)
+}
+
 func (s *service) BlogSlugExists(slug string) bool {
 	filter := bson.M{"slug": slug}
 	projection := bson.D{{Key: "status", Value: 1}}
@@ -73,28 +154,42 @@ func (s *service) BlogSlugExists(slug string) bool {
 
 func (s *service) GetPublisedBlogById(id primitive.ObjectID) (*dto.PublicBlog, error) {
 	filter := bson.M{"_id": id, "published": true, "status": true}
-	return s.getPublicPublishedBlog(filter)
+	return s.getPublicPublishedBlog("blog_"+id.Hex(), filter)
 }
 
 func (s *service) GetPublishedBlogBySlug(slug string) (*dto.PublicBlog, error) {
 	filter := bson.M{"slug": slug, "published": true, "status": true}
-	return s.getPublicPublishedBlog(filter)
+	return s.getPublicPublishedBlog("blog_"+slug, filter)
 }
 
-func (s *service) getPublicPublishedBlog(filter bson.M) (*dto.PublicBlog, error) {
-	projection := bson.D{{Key: "draftText", Value: 0}}
-	opts := options.FindOne().SetProjection(projection)
-	blog, err := s.blogQueryBuilder.SingleQuery().FindOne(filter, opts)
-	if err != nil {
-		return nil, network.NewNotFoundError("blog not found", err)
-	}
+// read through the cache, the concurrent misses of a hot blog make a single query
+func (s *service) getPublicPublishedBlog(key string, filter bson.M) (*dto.PublicBlog, error) {
+	blog, err := s.publicBlogCache.GetOrLoadTagged(key, publicBlogCacheTTL, func() (*dto.PublicBlog, []string, error) {
+		projection := bson.D{{Key: "draftText", Value: 0}}
+		opts := options.FindOne().SetProjection(projection)
+		blog, err := s.blogQueryBuilder.SingleQuery().FindOne(filter, opts)
+		if errors.Is(err, mongod.ErrNoDocuments) {
+			return nil, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		author, err := s.userService.FindUserPublicProfile(blog.Author)
+		if err != nil {
+			return nil, nil, network.NewNotFoundError("author not found", err)
+		}
 
-	author, err := s.userService.FindUserPublicProfile(blog.Author)
+		public, err := dto.NewPublicBlog(blog, author)
+		return public, blog.CacheTags(), err
+	})
 	if err != nil {
-		return nil, network.NewNotFoundError("author not found", err)
+		return nil, err
 	}
-
-	return dto.NewPublicBlog(blog, author)
+	if blog == nil {
+		return nil, network.NewNotFoundError("blog not found", nil)
+	}
+	return blog, nil
 }
 
 func (s *service) getPaginated(filter bson.M, p *coredto.Pagination, opts *options.FindOptions) ([]*dto.InfoBlog, error) {
@@ -115,3 +210,8 @@ func (s *service) getPaginated(filter bson.M, p *coredto.Pagination, opts *optio
 
 	return dtos, nil
 }
+
+// the 409 of the author and editor updates made with a stale version
+func ConflictError(err error) error {
+	return network.NewConflictError("blog was modified by another request, reload and retry", err)
+}
@@ -75,18 +75,11 @@ func (c *controller) getSimilarBlogsHandler(ctx *gin.Context) {
 		return
 	}
 
-	blogs, err := c.service.GetSimilarBlogsDtoCache(mongoId.ID)
-	if err == nil {
-		c.Send(ctx).SuccessDataResponse("success", blogs)
-		return
-	}
-
-	blogs, err = c.service.GetSimilarBlogs(mongoId.ID)
+	blogs, err := c.service.GetSimilarBlogs(mongoId.ID)
 	if err != nil {
 		c.Send(ctx).MixedError(err)
 		return
 	}
 
 	c.Send(ctx).SuccessDataResponse("success", blogs)
-	c.service.SetSimilarBlogsDtoCache(mongoId.ID, blogs)
 }
@@ -1,6 +1,7 @@
 package blogs
 
 import (
+	"errors"
 	"time"
 
 	"github.com/unusualcodeorg/goserve/api/blog/model"
@@ -11,15 +12,17 @@ import (
 	"github.com/unusualcodeorg/goserve/arch/redis"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongod "go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const similarBlogsCacheTTL = 6 * time.Hour
+
 type Service interface {
-	SetSimilarBlogsDtoCache(blogId primitive.ObjectID, blogs []*dto.ItemBlog) error
-	GetSimilarBlogsDtoCache(blogId primitive.ObjectID) ([]*dto.ItemBlog, error)
 	GetPaginatedLatestBlogs(p *coredto.Pagination) ([]*dto.ItemBlog, error)
 	GetPaginatedTaggedBlogs(tag string, p *coredto.Pagination) ([]*dto.ItemBlog, error)
 	GetSimilarBlogs(blogId primitive.ObjectID) ([]*dto.ItemBlog, error)
+	findSimilarBlogs(blogId primitive.ObjectID) ([]*dto.ItemBlog, error)
 	getPublicPaginated(filter bson.M, p *coredto.Pagination) ([]*dto.ItemBlog, error)
 	getPaginated(filter bson.M, p *coredto.Pagination, opts *options.FindOptions) ([]*dto.ItemBlog, error)
 }
@@ -38,16 +41,6 @@ func NewService(db mongo.Database, store redis.Store) Service {
 	}
 }
 
-func (s *service) SetSimilarBlogsDtoCache(blogId primitive.ObjectID, blogs []*dto.ItemBlog) error {
-	key := "similar_blogs_" + blogId.Hex()
-	return s.itemBlogCache.SetJSONList(key, blogs, 6*time.Hour)
-}
-
-func (s *service) GetSimilarBlogsDtoCache(blogId primitive.ObjectID) ([]*dto.ItemBlog, error) {
-	key := "similar_blogs_" + blogId.Hex()
-	return s.itemBlogCache.GetJSONList(key)
-}
-
 func (s *service) GetPaginatedLatestBlogs(p *coredto.Pagination) ([]*dto.ItemBlog, error) {
 	filter := bson.M{"status": true, "published": true}
 	return s.getPublicPaginated(filter, p)
@@ -59,10 +52,38 @@ func (s *service) GetPaginatedTaggedBlogs(tag string, p *coredto.Pagination) ([]
 }
 
 func (s *service) GetSimilarBlogs(blogId primitive.ObjectID) ([]*dto.ItemBlog, error) {
+	key := "similar_blogs_" + blogId.Hex()
+	blogs, err := s.itemBlogCache.GetOrLoadListTagged(key, similarBlogsCacheTTL, func() ([]*dto.ItemBlog, []string, error) {
+		blogs, err := s.findSimilarBlogs(blogId)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// evicted when the blog or any of the similar blogs changes, also when not found until it is published
+		tags := []string{model.BlogCacheTag(blogId)}
+		for _, b := range blogs {
+			tags = append(tags, model.BlogCacheTag(b.ID))
+		}
+		return blogs, tags, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if blogs == nil {
+		return nil, network.NewNotFoundError("blog not found", nil)
+	}
+	return blogs, nil
+}
+
+// nil when the blog is not found
+func (s *service) findSimilarBlogs(blogId primitive.ObjectID) ([]*dto.ItemBlog, error) {
 	filter := bson.M{"_id": blogId, "published": true, "status": true}
 	blog, err := s.blogQueryBuilder.SingleQuery().FindOne(filter, nil)
+	if errors.Is(err, mongod.ErrNoDocuments) {
+		return nil, nil
+	}
 	if err != nil {
-		return nil, network.NewNotFoundError("blog not found", err)
+		return nil, err
 	}
 
 	filter = bson.M{
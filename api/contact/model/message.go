@@ -4,8 +4,8 @@ import (
 	"time"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/unusualcodeorg/goserve/arch/mongo"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongod "go.mongodb.org/mongo-driver/mongo"
 )
 
 const CollectionName = "messages"
@@ -13,7 +13,7 @@ const CollectionName = "messages"
 type Message struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" validate:"-"`
 	Type      string             `bson:"type" validate:"required"`
-	Msg       string             `bson:"msg" validate:"required"`
+	Msg       string             `bson:"msg" validate:"required" encrypt:"true"`
 	Status    bool               `bson:"status" validate:"required"`
 	CreatedAt time.Time          `bson:"createdAt" validate:"required"`
 	UpdatedAt time.Time          `bson:"updatedAt" validate:"required"`
@@ -43,6 +43,10 @@ func (message *Message) Validate() error {
 	return validate.Struct(message)
 }
 
-func (*Message) EnsureIndexes(db mongo.Database) {
+func (*Message) GetCollectionName() string {
+	return CollectionName
+}
 
+func (*Message) GetIndexes() []mongod.IndexModel {
+	return nil
 }
@@ -0,0 +1,40 @@
+package contact
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/unusualcodeorg/goserve/api/contact/dto"
+	coredto "github.com/unusualcodeorg/goserve/arch/dto"
+	"github.com/unusualcodeorg/goserve/arch/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongod "go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestService_SaveAndFindMessage(t *testing.T) {
+	s := NewService(mongo.NewMemoryDatabase())
+
+	msg, err := s.SaveMessage(&dto.CreateMessage{Type: "feedback", Msg: "hello"})
+	assert.NoError(t, err)
+	assert.False(t, msg.ID.IsZero())
+
+	found, err := s.FindMessage(msg.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", found.Msg)
+
+	_, err = s.FindMessage(primitive.NewObjectID())
+	assert.ErrorIs(t, err, mongod.ErrNoDocuments)
+}
+
+func TestService_FindPaginatedMessage(t *testing.T) {
+	s := NewService(mongo.NewMemoryDatabase())
+	for _, m := range []string{"a", "b", "c"} {
+		_, err := s.SaveMessage(&dto.CreateMessage{Type: "feedback", Msg: m})
+		assert.NoError(t, err)
+	}
+
+	msgs, err := s.FindPaginatedMessage(&coredto.Pagination{Page: 2, Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "c", msgs[0].Msg)
+}
@@ -1,9 +1,12 @@
 package user
 
 import (
+	"context"
+
 	"github.com/stretchr/testify/mock"
 	"github.com/unusualcodeorg/goserve/api/user/dto"
 	"github.com/unusualcodeorg/goserve/api/user/model"
+	"github.com/unusualcodeorg/goserve/arch/mongo"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -51,6 +54,14 @@ func (m *MockService) FindUserById(id primitive.ObjectID) (*model.User, error) {
 	return args.Get(0).(*model.User), args.Error(1)
 }
 
+func (m *MockService) FindAuthUser(id primitive.ObjectID) (*model.User, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.User), args.Error(1)
+}
+
 func (m *MockService) FindUserByEmail(email string) (*model.User, error) {
 	args := m.Called(email)
 	if args.Get(0) == nil {
@@ -87,3 +98,23 @@ func (m *MockService) DeleteUserByEmail(email string) (bool, error) {
 	args := m.Called(email)
 	return args.Bool(0), args.Error(1)
 }
+
+func (m *MockService) EvictUserCache(id primitive.ObjectID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockService) EvictRoleCache(roleId primitive.ObjectID) error {
+	args := m.Called(roleId)
+	return args.Error(0)
+}
+
+func (m *MockService) WatchUserChanges(ctx context.Context, tokens mongo.ResumeTokenStore) error {
+	args := m.Called(ctx, tokens)
+	return args.Error(0)
+}
+
+func (m *MockService) WatchRoleChanges(ctx context.Context, tokens mongo.ResumeTokenStore) error {
+	args := m.Called(ctx, tokens)
+	return args.Error(0)
+}
@@ -1,11 +1,9 @@
 package model
 
 import (
-	"context"
 	"time"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/unusualcodeorg/goserve/arch/mongo"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	mongod "go.mongodb.org/mongo-driver/mongo"
@@ -64,8 +62,12 @@ func (role *Role) Validate() error {
 	return validate.Struct(role)
 }
 
-func (*Role) EnsureIndexes(db mongo.Database) {
-	indexes := []mongod.IndexModel{
+func (*Role) GetCollectionName() string {
+	return RolesCollectionName
+}
+
+func (*Role) GetIndexes() []mongod.IndexModel {
+	return []mongod.IndexModel{
 		{
 			Keys: bson.D{
 				{Key: "_id", Value: 1},
@@ -85,5 +87,4 @@ func (*Role) EnsureIndexes(db mongo.Database) {
 			Options: options.Index().SetUnique(true),
 		},
 	}
-	mongo.NewQueryBuilder[Role](db, RolesCollectionName).Query(context.Background()).CreateIndexes(indexes)
 }
@@ -1,11 +1,9 @@
 package model
 
 import (
-	"context"
 	"time"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/unusualcodeorg/goserve/arch/mongo"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	mongod "go.mongodb.org/mongo-driver/mongo"
@@ -17,7 +15,7 @@ const UserCollectionName = "users"
 type User struct {
 	ID            primitive.ObjectID   `bson:"_id,omitempty"`
 	Name          string               `bson:"name" validate:"required,max=200"`
-	Email         string               `bson:"email" validate:"required,email"`
+	Email         string               `bson:"email" validate:"required,email" encrypt:"blind"`
 	Password      *string              `bson:"password" validate:"required,min=6,max=100"`
 	ProfilePicURL *string              `bson:"profilePicUrl,omitempty" validate:"omitempty,max=500"`
 	Roles         []primitive.ObjectID `bson:"roles,omitempty" validate:"required"`
@@ -64,8 +62,12 @@ func (user *User) Validate() error {
 	return validate.Struct(user)
 }
 
-func (*User) EnsureIndexes(db mongo.Database) {
-	indexes := []mongod.IndexModel{
+func (*User) GetCollectionName() string {
+	return UserCollectionName
+}
+
+func (*User) GetIndexes() []mongod.IndexModel {
+	return []mongod.IndexModel{
 		{
 			Keys: bson.D{
 				{Key: "_id", Value: 1},
@@ -74,16 +76,35 @@ func (*User) EnsureIndexes(db mongo.Database) {
 		},
 		{
 			Keys: bson.D{
-				{Key: "email", Value: 1},
+				{Key: "emailHash", Value: 1},
 				{Key: "status", Value: 1},
 			},
 		},
 		{
 			Keys: bson.D{
-				{Key: "email", Value: 1},
+				{Key: "emailHash", Value: 1},
 			},
 			Options: options.Index().SetUnique(true),
 		},
 	}
-	mongo.NewQueryBuilder[User](db, UserCollectionName).Query(context.Background()).CreateIndexes(indexes)
+}
+
+/*
+ * The redis cache tags of the entries made from the user, see redis.Cache.Tag
+ * Example -> cache.InvalidateTag(model.RoleCacheTag(id)) evicts every cached user having the role
+ */
+func UserCacheTag(id primitive.ObjectID) string {
+	return "user:" + id.Hex()
+}
+
+func RoleCacheTag(id primitive.ObjectID) string {
+	return "role:" + id.Hex()
+}
+
+func (user *User) CacheTags() []string {
+	tags := []string{UserCacheTag(user.ID)}
+	for _, id := range user.Roles {
+		tags = append(tags, RoleCacheTag(id))
+	}
+	return tags
 }
@@ -1,12 +1,18 @@
 package user
 
 import (
+	"context"
+	"errors"
+	"time"
+
 	"github.com/unusualcodeorg/goserve/api/user/dto"
 	"github.com/unusualcodeorg/goserve/api/user/model"
 	"github.com/unusualcodeorg/goserve/arch/mongo"
 	"github.com/unusualcodeorg/goserve/arch/network"
+	"github.com/unusualcodeorg/goserve/arch/redis"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongod "go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -16,29 +22,80 @@ type Service interface {
 	FindRoleByCode(code model.RoleCode) (*model.Role, error)
 	FindRoles(roleIds []primitive.ObjectID) ([]*model.Role, error)
 	FindUserById(id primitive.ObjectID) (*model.User, error)
+	FindAuthUser(id primitive.ObjectID) (*model.User, error)
 	FindUserByEmail(email string) (*model.User, error)
 	CreateUser(user *model.User) (*model.User, error)
 	FindUserPrivateProfile(user *model.User) (*model.User, error)
 	FindUserPublicProfile(userId primitive.ObjectID) (*model.User, error)
 	DeleteUserByEmail(email string) (bool, error)
+	EvictUserCache(id primitive.ObjectID) error
+	EvictRoleCache(roleId primitive.ObjectID) error
+	WatchUserChanges(ctx context.Context, tokens mongo.ResumeTokenStore) error
+	WatchRoleChanges(ctx context.Context, tokens mongo.ResumeTokenStore) error
 }
 
 type service struct {
 	network.BaseService
 	userQueryBuilder mongo.QueryBuilder[model.User]
 	roleQueryBuilder mongo.QueryBuilder[model.Role]
+	// the users with their roles found by FindAuthUser on every authenticated request, nil when disabled
+	userCache    redis.Cache[authUser]
+	userCacheTTL time.Duration
+}
+
+// the fields of the user needed by the authentication and authorization, the cache holds no personal data
+type authUser struct {
+	ID       primitive.ObjectID   `json:"_id"`
+	Roles    []primitive.ObjectID `json:"roles"`
+	RoleDocs []*model.Role        `json:"roleDocs"`
+	Verified bool                 `json:"verified"`
+	Status   bool                 `json:"status"`
+}
+
+func newAuthUser(user *model.User) *authUser {
+	return &authUser{
+		ID:       user.ID,
+		Roles:    user.Roles,
+		RoleDocs: user.RoleDocs,
+		Verified: user.Verified,
+		Status:   user.Status,
+	}
+}
+
+func (u *authUser) user() *model.User {
+	return &model.User{
+		ID:       u.ID,
+		Roles:    u.Roles,
+		RoleDocs: u.RoleDocs,
+		Verified: u.Verified,
+		Status:   u.Status,
+	}
 }
 
-func NewService(db mongo.Database) Service {
-	return &service{
+// cacheTTL 0 disables the cache of FindUserById
+func NewService(db mongo.Database, store redis.Store, cacheTTL time.Duration) Service {
+	s := &service{
 		BaseService:      network.NewBaseService(),
 		userQueryBuilder: mongo.NewQueryBuilder[model.User](db, model.UserCollectionName),
 		roleQueryBuilder: mongo.NewQueryBuilder[model.Role](db, model.RolesCollectionName),
+		userCacheTTL:     cacheTTL,
 	}
+	if cacheTTL > 0 {
+		cacheConfig := redis.DefaultCacheConfig()
+		cacheConfig.Lock = false
+		s.userCache = redis.NewCacheWithConfig[authUser](store, cacheConfig)
+	}
+	return s
 }
 
+// the user of the request has no profile fields, see FindAuthUser
 func (s *service) GetUserPrivateProfile(user *model.User) (*dto.InfoPrivateUser, error) {
-	return dto.NewInfoPrivateUser(user), nil
+	profile, err := s.FindUserPrivateProfile(user)
+	if err != nil {
+		return nil, network.NewNotFoundError("user does not exists", err)
+	}
+	profile.RoleDocs = user.RoleDocs
+	return dto.NewInfoPrivateUser(profile), nil
 }
 
 func (s *service) GetUserPublicProfile(userId primitive.ObjectID) (*dto.InfoPublicUser, error) {
@@ -50,19 +107,66 @@ func (s *service) GetUserPublicProfile(userId primitive.ObjectID) (*dto.InfoPubl
 }
 
 func (s *service) FindRoleByCode(code model.RoleCode) (*model.Role, error) {
-	filter := bson.M{"code": code, "status": true}
+	filter, err := mongo.NewFilter[model.Role]().Eq("code", code).Eq("status", true).Build()
+	if err != nil {
+		return nil, err
+	}
 	return s.roleQueryBuilder.SingleQuery().FindOne(filter, nil)
 }
 
 func (s *service) FindRoles(roleIds []primitive.ObjectID) ([]*model.Role, error) {
-	filter := bson.M{"_id": bson.M{"$in": roleIds}}
+	filter, err := mongo.NewFilter[model.Role]().In("_id", roleIds).Build()
+	if err != nil {
+		return nil, err
+	}
 	return s.roleQueryBuilder.SingleQuery().FindAll(filter, nil)
 }
 
 func (s *service) FindUserById(id primitive.ObjectID) (*model.User, error) {
-	userFilter := bson.M{"_id": id, "status": true}
-	proj := bson.D{{Key: "password", Value: 0}}
-	opts := options.FindOne().SetProjection(proj)
+	return s.findUserById(id, bson.D{{Key: "password", Value: 0}})
+}
+
+/*
+ * The user of the authenticated requests, only its id, status, verified and roles are found with the role docs
+ * the profile is read with FindUserPrivateProfile or FindUserPublicProfile
+ */
+func (s *service) FindAuthUser(id primitive.ObjectID) (*model.User, error) {
+	if s.userCache == nil {
+		user, err := s.findUserById(id, authUserProjection)
+		if err != nil {
+			return nil, err
+		}
+		return newAuthUser(user).user(), nil
+	}
+
+	key := "user_" + id.Hex()
+	cached, err := s.userCache.GetOrLoadTagged(key, s.userCacheTTL, func() (*authUser, []string, error) {
+		user, err := s.findUserById(id, authUserProjection)
+		if errors.Is(err, mongod.ErrNoDocuments) {
+			return nil, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return newAuthUser(user), user.CacheTags(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cached == nil {
+		return nil, mongod.ErrNoDocuments
+	}
+	return cached.user(), nil
+}
+
+var authUserProjection = bson.D{{Key: "roles", Value: 1}, {Key: "verified", Value: 1}, {Key: "status", Value: 1}}
+
+func (s *service) findUserById(id primitive.ObjectID, projection bson.D) (*model.User, error) {
+	userFilter, err := mongo.NewFilter[model.User]().Eq("_id", id).Eq("status", true).Build()
+	if err != nil {
+		return nil, err
+	}
+	opts := options.FindOne().SetProjection(projection)
 	user, err := s.userQueryBuilder.SingleQuery().FindOne(userFilter, opts)
 	if err != nil {
 		return nil, err
@@ -78,7 +182,10 @@ func (s *service) FindUserById(id primitive.ObjectID) (*model.User, error) {
 }
 
 func (s *service) FindUserByEmail(email string) (*model.User, error) {
-	filter := bson.M{"email": email, "status": true}
+	filter, err := mongo.NewFilter[model.User]().Eq("email", email).Eq("status", true).Build()
+	if err != nil {
+		return nil, err
+	}
 	user, err := s.userQueryBuilder.SingleQuery().FindOne(filter, nil)
 
 	if err != nil {
@@ -104,24 +211,104 @@ func (s *service) CreateUser(user *model.User) (*model.User, error) {
 }
 
 func (s *service) FindUserPrivateProfile(user *model.User) (*model.User, error) {
-	filter := bson.M{"_id": user.ID, "status": true}
+	filter, err := mongo.NewFilter[model.User]().Eq("_id", user.ID).Eq("status", true).Build()
+	if err != nil {
+		return nil, err
+	}
 	projection := bson.D{{Key: "password", Value: 0}}
 	opts := options.FindOne().SetProjection(projection)
 	return s.userQueryBuilder.SingleQuery().FindOne(filter, opts)
 }
 
 func (s *service) FindUserPublicProfile(userId primitive.ObjectID) (*model.User, error) {
-	filter := bson.M{"_id": userId, "status": true}
+	filter, err := mongo.NewFilter[model.User]().Eq("_id", userId).Eq("status", true).Build()
+	if err != nil {
+		return nil, err
+	}
 	projection := bson.D{{Key: "name", Value: 1}, {Key: "profilePicUrl", Value: 1}}
 	opts := options.FindOne().SetProjection(projection)
 	return s.userQueryBuilder.SingleQuery().FindOne(filter, opts)
 }
 
 func (s *service) DeleteUserByEmail(email string) (bool, error) {
-	filter := bson.M{"email": email}
+	filter, err := mongo.NewFilter[model.User]().Eq("email", email).Build()
+	if err != nil {
+		return false, err
+	}
+	opts := options.FindOne().SetProjection(bson.D{{Key: "_id", Value: 1}})
+	user, err := s.userQueryBuilder.SingleQuery().FindOne(filter, opts)
+	if errors.Is(err, mongod.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	filter, err = mongo.NewFilter[model.User]().Eq("_id", user.ID).Build()
+	if err != nil {
+		return false, err
+	}
 	result, err := s.userQueryBuilder.SingleQuery().DeleteOne(filter)
 	if err != nil {
 		return false, err
 	}
+	s.EvictUserCache(user.ID)
 	return result.DeletedCount > 0, nil
 }
+
+func (s *service) EvictUserCache(id primitive.ObjectID) error {
+	if s.userCache == nil {
+		return nil
+	}
+	return errors.Join(
+		s.userCache.InvalidateTag(model.UserCacheTag(id)),
+		s.userCache.Delete("user_"+id.Hex()),
+	)
+}
+
+// a role changed or disabled evicts all the cached users having it
+func (s *service) EvictRoleCache(roleId primitive.ObjectID) error {
+	if s.userCache == nil {
+		return nil
+	}
+	return s.userCache.InvalidateTag(model.RoleCacheTag(roleId))
+}
+
+/*
+ * evicts the cached users when the documents change from anywhere e.g. the roles granted by admin scripts
+ * blocks until ctx is done
+ */
+func (s *service) WatchUserChanges(ctx context.Context, tokens mongo.ResumeTokenStore) error {
+	return s.userQueryBuilder.Watch(ctx, cacheWatchConfig("user_cache", tokens), func(event *mongo.ChangeEvent[model.User]) error {
+		if id, ok := event.ID.(primitive.ObjectID); ok {
+			return s.EvictUserCache(id)
+		}
+		return nil
+	})
+}
+
+func (s *service) WatchRoleChanges(ctx context.Context, tokens mongo.ResumeTokenStore) error {
+	return s.roleQueryBuilder.Watch(ctx, cacheWatchConfig("role_cache", tokens), func(event *mongo.ChangeEvent[model.Role]) error {
+		if id, ok := event.ID.(primitive.ObjectID); ok {
+			return s.EvictRoleCache(id)
+		}
+		return nil
+	})
+}
+
+// only the ids of the changed documents are needed
+func cacheWatchConfig(name string, tokens mongo.ResumeTokenStore) mongo.WatchConfig {
+	return mongo.WatchConfig{
+		Name: name,
+		Operations: []mongo.OperationType{
+			mongo.OperationUpdate,
+			mongo.OperationReplace,
+			mongo.OperationDelete,
+		},
+		Pipeline: mongo.NewPipeline().Project(bson.D{
+			{Key: "operationType", Value: 1},
+			{Key: "documentKey", Value: 1},
+		}),
+		TokenStore: tokens,
+	}
+}
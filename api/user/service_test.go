@@ -0,0 +1,90 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/unusualcodeorg/goserve/api/user/model"
+	"github.com/unusualcodeorg/goserve/arch/mongo"
+	"github.com/unusualcodeorg/goserve/arch/redis"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongod "go.mongodb.org/mongo-driver/mongo"
+)
+
+// nothing listens on the port, the cache falls back to the database
+func newUnreachableStore() redis.Store {
+	return redis.NewStore(context.Background(), &redis.Config{Host: "127.0.0.1", Port: 1, DialTimeout: 50 * time.Millisecond})
+}
+
+func createTestUser(t *testing.T, s Service) *model.User {
+	role, err := model.NewRole(model.RoleCodeLearner)
+	assert.NoError(t, err)
+	role.ID = primitive.NewObjectID()
+
+	user, err := model.NewUser("a@b.com", "hashed-password", "a", nil, []*model.Role{role})
+	assert.NoError(t, err)
+	user, err = s.CreateUser(user)
+	assert.NoError(t, err)
+	return user
+}
+
+func TestService_FindAuthUserCache(t *testing.T) {
+	for name, ttl := range map[string]time.Duration{"disabled": 0, "redis down": time.Minute} {
+		t.Run(name, func(t *testing.T) {
+			s := NewService(mongo.NewMemoryDatabase(), newUnreachableStore(), ttl)
+			user := createTestUser(t, s)
+
+			found, err := s.FindAuthUser(user.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, user.Roles, found.Roles)
+			assert.Empty(t, found.Email)
+			assert.Empty(t, found.Name)
+			assert.Nil(t, found.Password)
+
+			full, err := s.FindUserById(user.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, "a@b.com", full.Email)
+			assert.Equal(t, "a", full.Name)
+			assert.Nil(t, full.Password)
+
+			profile, err := s.GetUserPrivateProfile(found)
+			assert.NoError(t, err)
+			assert.Equal(t, "a@b.com", profile.Email)
+			assert.Equal(t, "a", profile.Name)
+
+			_, err = s.FindAuthUser(primitive.NewObjectID())
+			assert.ErrorIs(t, err, mongod.ErrNoDocuments)
+
+			deleted, err := s.DeleteUserByEmail("a@b.com")
+			assert.NoError(t, err)
+			assert.True(t, deleted)
+
+			_, err = s.FindAuthUser(user.ID)
+			assert.ErrorIs(t, err, mongod.ErrNoDocuments)
+
+			deleted, err = s.DeleteUserByEmail("a@b.com")
+			assert.NoError(t, err)
+			assert.False(t, deleted)
+		})
+	}
+}
+
+func TestAuthUserHasNoPersonalData(t *testing.T) {
+	user, err := model.NewUser("a@b.com", "hashed-password", "a name", nil, nil)
+	assert.NoError(t, err)
+
+	data, err := json.Marshal(newAuthUser(user))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "a@b.com")
+	assert.NotContains(t, string(data), "a name")
+	assert.NotContains(t, string(data), "hashed-password")
+}
+
+func TestUserCacheTags(t *testing.T) {
+	user := &model.User{ID: primitive.NewObjectID(), Roles: []primitive.ObjectID{primitive.NewObjectID()}}
+	assert.Equal(t, []string{"user:" + user.ID.Hex(), "role:" + user.Roles[0].Hex()}, user.CacheTags())
+	assert.Equal(t, model.RoleCacheTag(user.Roles[0]), user.CacheTags()[1])
+}
@@ -0,0 +1,227 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type State int32
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+var ErrOpen = errors.New("circuit breaker is open")
+
+type Config struct {
+	// the consecutive failures that open the breaker
+	Failures int
+	// the breaker stays open this long before a call may try again, then one call at a time until one succeeds
+	OpenTimeout time.Duration
+	// checks the dependency every OpenTimeout while open, the breaker closes when it succeeds
+	Probe func(ctx context.Context) error
+	// the errors not counted as failures e.g. a not found reply, all the errors count when nil
+	// a call cancelled by its caller with context.Canceled counts neither as a failure nor as a success
+	IsFailure func(err error) bool
+	// called with the breaker locked, it must not call the breaker
+	OnStateChange func(name string, from State, to State)
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Failures:    5,
+		OpenTimeout: 5 * time.Second,
+	}
+}
+
+/*
+ * Example -> err := breaker.Do(func() error { return client.Ping(ctx).Err() })
+ * the calls fail fast with ErrOpen while the dependency is down instead of waiting for its timeouts
+ */
+type Breaker interface {
+	Name() string
+	State() State
+	// ErrOpen without calling fn while open
+	Do(fn func() error) error
+	// for the calls that can't be wrapped in Do, done must be called with the result of the call
+	Allow() (done func(err error), err error)
+	// opens the breaker right away e.g. when the startup can't connect
+	Trip()
+}
+
+type breaker struct {
+	name     string
+	config   Config
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	// a half-open call is in flight
+	trial   bool
+	probing bool
+}
+
+func New(name string, config Config) Breaker {
+	defaults := DefaultConfig()
+	if config.Failures <= 0 {
+		config.Failures = defaults.Failures
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = defaults.OpenTimeout
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = func(err error) bool { return err != nil }
+	}
+	return &breaker{name: name, config: config}
+}
+
+func (b *breaker) Name() string {
+	return b.name
+}
+
+func (b *breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *breaker) Do(fn func() error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	done(err)
+	return err
+}
+
+func (b *breaker) Allow() (func(err error), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.config.OpenTimeout {
+			return nil, ErrOpen
+		}
+		b.setState(HalfOpen)
+		fallthrough
+	case HalfOpen:
+		if b.trial {
+			return nil, ErrOpen
+		}
+		b.trial = true
+		return b.doneTrial, nil
+	}
+	return b.done, nil
+}
+
+func (b *breaker) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// opened by the other calls meanwhile
+	if b.state != Closed || errors.Is(err, context.Canceled) {
+		return
+	}
+	if !b.config.IsFailure(err) {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.config.Failures {
+		b.open()
+	}
+}
+
+func (b *breaker) doneTrial(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	// the next call is the trial
+	if b.state != HalfOpen || errors.Is(err, context.Canceled) {
+		return
+	}
+	if b.config.IsFailure(err) {
+		b.open()
+		return
+	}
+	b.close()
+}
+
+func (b *breaker) Trip() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != Open {
+		b.open()
+	}
+}
+
+func (b *breaker) open() {
+	b.openedAt = time.Now()
+	b.setState(Open)
+	if b.config.Probe != nil && !b.probing {
+		b.probing = true
+		go b.probe()
+	}
+}
+
+func (b *breaker) close() {
+	b.failures = 0
+	b.setState(Closed)
+}
+
+func (b *breaker) setState(state State) {
+	from := b.state
+	b.state = state
+	if from != state && b.config.OnStateChange != nil {
+		b.config.OnStateChange(b.name, from, state)
+	}
+}
+
+// stops once the breaker is closed, by the probe or by a call
+func (b *breaker) probe() {
+	for {
+		time.Sleep(b.config.OpenTimeout)
+
+		b.mu.Lock()
+		if b.state == Closed {
+			b.probing = false
+			b.mu.Unlock()
+			return
+		}
+		b.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), b.config.OpenTimeout)
+		err := b.config.Probe(ctx)
+		cancel()
+
+		b.mu.Lock()
+		if err == nil && b.state != Closed {
+			b.close()
+		}
+		if b.state == Closed {
+			b.probing = false
+			b.mu.Unlock()
+			return
+		}
+		b.mu.Unlock()
+	}
+}
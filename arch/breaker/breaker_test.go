@@ -0,0 +1,105 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errFailed = errors.New("failed")
+
+func TestBreakerOpens(t *testing.T) {
+	var changes []string
+	b := New("test", Config{
+		Failures:    2,
+		OpenTimeout: 20 * time.Millisecond,
+		OnStateChange: func(name string, from State, to State) {
+			changes = append(changes, from.String()+">"+to.String())
+		},
+	})
+
+	assert.ErrorIs(t, b.Do(func() error { return errFailed }), errFailed)
+	assert.NoError(t, b.Do(func() error { return nil }), "a success resets the count")
+	assert.ErrorIs(t, b.Do(func() error { return errFailed }), errFailed)
+	assert.Equal(t, Closed, b.State())
+	assert.ErrorIs(t, b.Do(func() error { return errFailed }), errFailed)
+	assert.Equal(t, Open, b.State())
+
+	called := false
+	assert.ErrorIs(t, b.Do(func() error { called = true; return nil }), ErrOpen)
+	assert.False(t, called)
+
+	time.Sleep(20 * time.Millisecond)
+
+	// one trial at a time
+	done, err := b.Allow()
+	assert.NoError(t, err)
+	assert.Equal(t, HalfOpen, b.State())
+	_, err = b.Allow()
+	assert.ErrorIs(t, err, ErrOpen)
+
+	done(errFailed)
+	assert.Equal(t, Open, b.State())
+	assert.ErrorIs(t, b.Do(func() error { return nil }), ErrOpen)
+
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, b.Do(func() error { return nil }))
+	assert.Equal(t, Closed, b.State())
+
+	assert.Equal(t, []string{"closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed"}, changes)
+}
+
+func TestBreakerCancelled(t *testing.T) {
+	b := New("test", Config{Failures: 2, OpenTimeout: 20 * time.Millisecond})
+
+	assert.ErrorIs(t, b.Do(func() error { return errFailed }), errFailed)
+	assert.ErrorIs(t, b.Do(func() error { return context.Canceled }), context.Canceled)
+	assert.ErrorIs(t, b.Do(func() error { return errFailed }), errFailed)
+	assert.Equal(t, Open, b.State(), "a cancelled call does not reset the count")
+
+	time.Sleep(20 * time.Millisecond)
+	assert.ErrorIs(t, b.Do(func() error { return context.Canceled }), context.Canceled)
+	assert.Equal(t, HalfOpen, b.State(), "a cancelled trial does not close the breaker")
+
+	assert.ErrorIs(t, b.Do(func() error { return errFailed }), errFailed)
+	assert.Equal(t, Open, b.State())
+}
+
+func TestBreakerIsFailure(t *testing.T) {
+	notFound := errors.New("not found")
+	b := New("test", Config{Failures: 1, IsFailure: func(err error) bool { return err != nil && err != notFound }})
+
+	assert.ErrorIs(t, b.Do(func() error { return notFound }), notFound)
+	assert.Equal(t, Closed, b.State())
+
+	b.Trip()
+	assert.Equal(t, Open, b.State())
+}
+
+func TestBreakerProbe(t *testing.T) {
+	var healthy atomic.Bool
+	var probes atomic.Int32
+	b := New("test", Config{
+		Failures:    1,
+		OpenTimeout: 10 * time.Millisecond,
+		Probe: func(ctx context.Context) error {
+			probes.Add(1)
+			if healthy.Load() {
+				return nil
+			}
+			return errFailed
+		},
+	})
+
+	b.Trip()
+	time.Sleep(35 * time.Millisecond)
+	assert.Equal(t, Open, b.State())
+	assert.GreaterOrEqual(t, probes.Load(), int32(2))
+
+	healthy.Store(true)
+	assert.Eventually(t, func() bool { return b.State() == Closed }, time.Second, 5*time.Millisecond)
+}
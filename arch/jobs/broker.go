@@ -0,0 +1,228 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/unusualcodeorg/goserve/arch/redis"
+)
+
+// a message read from the stream, deliveries counts the reads including this one
+type delivery struct {
+	id         string
+	data       []byte
+	deliveries int
+}
+
+type broker interface {
+	add(ctx context.Context, data []byte) error
+	schedule(ctx context.Context, data []byte, at time.Time) error
+	// moves the scheduled jobs that are due to the stream
+	promote(ctx context.Context, now time.Time, count int) (int, error)
+	// the new messages, waits up to block when there are none
+	read(ctx context.Context, consumer string, count int, block time.Duration) ([]delivery, error)
+	// takes over the messages that no consumer acknowledged for minIdle
+	claim(ctx context.Context, consumer string, minIdle time.Duration, count int) ([]delivery, error)
+	// resets the idle time of the messages, so that they are not claimed while processed
+	touch(ctx context.Context, consumer string, ids ...string) error
+	ack(ctx context.Context, id string) error
+	retry(ctx context.Context, id string, data []byte, at time.Time) error
+	dead(ctx context.Context, id string, data []byte) error
+}
+
+const jobField = "job"
+
+// acknowledged in the same call as the removal so that a due job is never lost or doubled
+var promoteScript = goredis.NewScript(`
+local due = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+for _, job in ipairs(due) do
+	redis.call("XADD", KEYS[2], "*", "job", job)
+	redis.call("ZREM", KEYS[1], job)
+end
+return #due
+`)
+
+/*
+ * The keys share the hash slot of the queue name for the cluster
+ * Example -> jobs:{default} is the stream, jobs:{default}:delayed and jobs:{default}:dead
+ */
+type redisBroker struct {
+	store      redis.Store
+	stream     string
+	delayed    string
+	deadLetter string
+	group      string
+	deadMaxLen int64
+}
+
+func newRedisBroker(store redis.Store, config Config) *redisBroker {
+	stream := "jobs:{" + config.Name + "}"
+	return &redisBroker{
+		store:      store,
+		stream:     stream,
+		delayed:    stream + ":delayed",
+		deadLetter: stream + ":dead",
+		group:      config.Group,
+		deadMaxLen: config.DeadMaxLen,
+	}
+}
+
+func (b *redisBroker) client() goredis.UniversalClient {
+	return b.store.GetInstance().UniversalClient
+}
+
+// reads from the start of the stream, so the jobs enqueued before the group exists are not skipped
+func (b *redisBroker) ensureGroup(ctx context.Context) error {
+	err := b.client().XGroupCreateMkStream(ctx, b.stream, b.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// the group is missing on a new redis, or when the stream was deleted or redis restarted without persistence
+func isNoGroup(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOGROUP")
+}
+
+func (b *redisBroker) add(ctx context.Context, data []byte) error {
+	return b.client().XAdd(ctx, &goredis.XAddArgs{
+		Stream: b.stream,
+		Values: map[string]any{jobField: data},
+	}).Err()
+}
+
+func (b *redisBroker) schedule(ctx context.Context, data []byte, at time.Time) error {
+	return b.client().ZAdd(ctx, b.delayed, goredis.Z{Score: float64(at.UnixMilli()), Member: data}).Err()
+}
+
+func (b *redisBroker) promote(ctx context.Context, now time.Time, count int) (int, error) {
+	return promoteScript.Run(ctx, b.client(), []string{b.delayed, b.stream}, now.UnixMilli(), count).Int()
+}
+
+func (b *redisBroker) read(ctx context.Context, consumer string, count int, block time.Duration) ([]delivery, error) {
+	streams, err := b.client().XReadGroup(ctx, &goredis.XReadGroupArgs{
+		Group:    b.group,
+		Consumer: consumer,
+		Streams:  []string{b.stream, ">"},
+		Count:    int64(count),
+		Block:    block,
+	}).Result()
+	if err == goredis.Nil {
+		return nil, nil
+	}
+	if isNoGroup(err) {
+		return nil, b.ensureGroup(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []delivery
+	for _, s := range streams {
+		for _, m := range s.Messages {
+			deliveries = append(deliveries, delivery{id: m.ID, data: messageData(m), deliveries: 1})
+		}
+	}
+	return deliveries, nil
+}
+
+func (b *redisBroker) claim(ctx context.Context, consumer string, minIdle time.Duration, count int) ([]delivery, error) {
+	pending, err := b.client().XPendingExt(ctx, &goredis.XPendingExtArgs{
+		Stream: b.stream,
+		Group:  b.group,
+		Idle:   minIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  int64(count),
+	}).Result()
+	// claim runs before the first read, so it meets the missing group first
+	if isNoGroup(err) {
+		return nil, b.ensureGroup(ctx)
+	}
+	if err != nil || len(pending) == 0 {
+		return nil, err
+	}
+
+	ids := make([]string, len(pending))
+	retries := make(map[string]int64, len(pending))
+	for i, p := range pending {
+		ids[i] = p.ID
+		retries[p.ID] = p.RetryCount
+	}
+
+	// another consumer may claim some of them first, XCLAIM checks the idle time again
+	messages, err := b.client().XClaim(ctx, &goredis.XClaimArgs{
+		Stream:   b.stream,
+		Group:    b.group,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]delivery, len(messages))
+	for i, m := range messages {
+		deliveries[i] = delivery{id: m.ID, data: messageData(m), deliveries: int(retries[m.ID]) + 1}
+	}
+	return deliveries, nil
+}
+
+// JUSTID does not count as a delivery
+func (b *redisBroker) touch(ctx context.Context, consumer string, ids ...string) error {
+	return b.client().XClaimJustID(ctx, &goredis.XClaimArgs{
+		Stream:   b.stream,
+		Group:    b.group,
+		Consumer: consumer,
+		Messages: ids,
+	}).Err()
+}
+
+// the processed messages are deleted, the stream only holds the jobs to be done
+func (b *redisBroker) ack(ctx context.Context, id string) error {
+	_, err := b.client().TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.XAck(ctx, b.stream, b.group, id)
+		pipe.XDel(ctx, b.stream, id)
+		return nil
+	})
+	return err
+}
+
+func (b *redisBroker) retry(ctx context.Context, id string, data []byte, at time.Time) error {
+	_, err := b.client().TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.XAck(ctx, b.stream, b.group, id)
+		pipe.XDel(ctx, b.stream, id)
+		pipe.ZAdd(ctx, b.delayed, goredis.Z{Score: float64(at.UnixMilli()), Member: data})
+		return nil
+	})
+	return err
+}
+
+func (b *redisBroker) dead(ctx context.Context, id string, data []byte) error {
+	_, err := b.client().TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.XAck(ctx, b.stream, b.group, id)
+		pipe.XDel(ctx, b.stream, id)
+		pipe.XAdd(ctx, &goredis.XAddArgs{
+			Stream: b.deadLetter,
+			MaxLen: b.deadMaxLen,
+			Approx: true,
+			Values: map[string]any{jobField: data},
+		})
+		return nil
+	})
+	return err
+}
+
+func messageData(m goredis.XMessage) []byte {
+	switch v := m.Values[jobField].(type) {
+	case string:
+		return []byte(v)
+	default:
+		return []byte(fmt.Sprint(v))
+	}
+}
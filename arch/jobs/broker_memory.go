@@ -0,0 +1,185 @@
+package jobs
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+ * Same as NewQueue within a single process, for the unit tests of the services enqueuing jobs
+ */
+func NewMemoryQueue(config Config) Queue {
+	return newQueue(newMemoryBroker(time.Now), config)
+}
+
+type memoryMessage struct {
+	id         string
+	data       []byte
+	consumer   string
+	delivered  time.Time
+	deliveries int
+}
+
+type memoryScheduled struct {
+	data []byte
+	at   time.Time
+}
+
+type memoryBroker struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	seq       int
+	messages  []*memoryMessage
+	scheduled []memoryScheduled
+	deadJobs  [][]byte
+	// closed when a message is added, to wake up the blocked reads
+	added chan struct{}
+}
+
+func newMemoryBroker(now func() time.Time) *memoryBroker {
+	return &memoryBroker{now: now, added: make(chan struct{})}
+}
+
+func (b *memoryBroker) push(data []byte) {
+	b.seq++
+	b.messages = append(b.messages, &memoryMessage{id: strconv.Itoa(b.seq), data: data})
+	close(b.added)
+	b.added = make(chan struct{})
+}
+
+func (b *memoryBroker) remove(id string) {
+	for i, m := range b.messages {
+		if m.id == id {
+			b.messages = append(b.messages[:i], b.messages[i+1:]...)
+			return
+		}
+	}
+}
+
+func (b *memoryBroker) add(_ context.Context, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.push(data)
+	return nil
+}
+
+func (b *memoryBroker) schedule(_ context.Context, data []byte, at time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.scheduled = append(b.scheduled, memoryScheduled{data: data, at: at})
+	return nil
+}
+
+func (b *memoryBroker) promote(_ context.Context, now time.Time, count int) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	promoted := 0
+	var later []memoryScheduled
+	for _, s := range b.scheduled {
+		if promoted < count && !s.at.After(now) {
+			b.push(s.data)
+			promoted++
+			continue
+		}
+		later = append(later, s)
+	}
+	b.scheduled = later
+	return promoted, nil
+}
+
+func (b *memoryBroker) read(ctx context.Context, consumer string, count int, block time.Duration) ([]delivery, error) {
+	deliveries, added := b.take(consumer, count)
+	if len(deliveries) > 0 || block <= 0 {
+		return deliveries, nil
+	}
+
+	timer := time.NewTimer(block)
+	defer timer.Stop()
+	select {
+	case <-added:
+		deliveries, _ = b.take(consumer, count)
+		return deliveries, nil
+	case <-timer.C:
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// the messages never delivered, and the channel closed on the next add
+func (b *memoryBroker) take(consumer string, count int) ([]delivery, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var deliveries []delivery
+	for _, m := range b.messages {
+		if len(deliveries) == count {
+			break
+		}
+		if m.deliveries > 0 {
+			continue
+		}
+		m.consumer, m.delivered, m.deliveries = consumer, b.now(), 1
+		deliveries = append(deliveries, delivery{id: m.id, data: m.data, deliveries: 1})
+	}
+	return deliveries, b.added
+}
+
+func (b *memoryBroker) claim(_ context.Context, consumer string, minIdle time.Duration, count int) ([]delivery, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var deliveries []delivery
+	for _, m := range b.messages {
+		if len(deliveries) == count {
+			break
+		}
+		if m.deliveries == 0 || b.now().Sub(m.delivered) < minIdle {
+			continue
+		}
+		m.deliveries++
+		m.consumer, m.delivered = consumer, b.now()
+		deliveries = append(deliveries, delivery{id: m.id, data: m.data, deliveries: m.deliveries})
+	}
+	return deliveries, nil
+}
+
+func (b *memoryBroker) touch(_ context.Context, consumer string, ids ...string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, m := range b.messages {
+		for _, id := range ids {
+			if m.id == id {
+				m.consumer, m.delivered = consumer, b.now()
+			}
+		}
+	}
+	return nil
+}
+
+func (b *memoryBroker) ack(_ context.Context, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(id)
+	return nil
+}
+
+func (b *memoryBroker) retry(_ context.Context, id string, data []byte, at time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(id)
+	b.scheduled = append(b.scheduled, memoryScheduled{data: data, at: at})
+	return nil
+}
+
+func (b *memoryBroker) dead(_ context.Context, id string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(id)
+	b.deadJobs = append(b.deadJobs, data)
+	return nil
+}
@@ -0,0 +1,128 @@
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/unusualcodeorg/goserve/arch/redis"
+)
+
+// answers the stream group commands like a new redis, where the consumer group does not exist yet
+type fakeRedis struct {
+	listener net.Listener
+	mu       sync.Mutex
+	groups   map[string]bool
+	commands []string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	f := &fakeRedis{listener: listener, groups: map[string]bool{}}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if _, err := conn.Write([]byte(f.reply(args))); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) reply(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := strings.ToUpper(args[0])
+	f.commands = append(f.commands, name)
+	switch {
+	case name == "XGROUP" && len(args) > 3 && strings.ToUpper(args[1]) == "CREATE":
+		f.groups[args[2]+"/"+args[3]] = true
+		return "+OK\r\n"
+	case name == "XPENDING" && len(args) > 2:
+		if !f.groups[args[1]+"/"+args[2]] {
+			return fmt.Sprintf("-NOGROUP No such key '%s' or consumer group '%s'\r\n", args[1], args[2])
+		}
+		return "*0\r\n"
+	default:
+		return "-ERR unknown command '" + args[0] + "'\r\n"
+	}
+}
+
+func (f *fakeRedis) sent(command string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.commands {
+		if c == command {
+			n++
+		}
+	}
+	return n
+}
+
+// the clients send the commands as arrays of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(r, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func TestRedisBrokerClaimCreatesGroup(t *testing.T) {
+	fake := newFakeRedis(t)
+	store := redis.NewStore(context.Background(), &redis.Config{Host: fake.listener.Addr().String()})
+	defer store.Disconnect()
+
+	broker := newRedisBroker(store, Config{Name: "test", Group: "workers"})
+
+	deliveries, err := broker.claim(context.Background(), "c1", time.Minute, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, deliveries)
+	assert.Equal(t, 1, fake.sent("XGROUP"))
+
+	deliveries, err = broker.claim(context.Background(), "c1", time.Minute, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, deliveries)
+	assert.Equal(t, 1, fake.sent("XGROUP"))
+	assert.Equal(t, 2, fake.sent("XPENDING"))
+}
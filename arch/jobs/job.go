@@ -0,0 +1,110 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrNoHandler = errors.New("jobs: no handler for the job type")
+
+type Job[T any] struct {
+	// the same across the retries of the job
+	ID   string
+	Type string
+	// starts at 1, the job is dead-lettered after Config.MaxAttempts
+	Attempt    int
+	EnqueuedAt time.Time
+	Payload    T
+}
+
+type Handler func(ctx context.Context, job *Job[json.RawMessage]) error
+
+/*
+ * Example -> var SendEmail = jobs.NewType[EmailPayload]("email.send")
+ * SendEmail.Handle(queue, func(ctx context.Context, job *jobs.Job[EmailPayload]) error {...})
+ * id, err := SendEmail.Enqueue(ctx, queue, EmailPayload{To: "a@b.com"})
+ */
+type Type[T any] struct {
+	name string
+}
+
+func NewType[T any](name string) Type[T] {
+	return Type[T]{name: name}
+}
+
+func (t Type[T]) Name() string {
+	return t.name
+}
+
+func (t Type[T]) Enqueue(ctx context.Context, queue Queue, payload T) (string, error) {
+	return queue.Enqueue(ctx, t.name, payload)
+}
+
+func (t Type[T]) EnqueueIn(ctx context.Context, queue Queue, delay time.Duration, payload T) (string, error) {
+	return queue.EnqueueAt(ctx, time.Now().Add(delay), t.name, payload)
+}
+
+// a payload that can't be decoded is dead-lettered without retries
+func (t Type[T]) Handle(queue Queue, handler func(ctx context.Context, job *Job[T]) error) {
+	queue.Handle(t.name, func(ctx context.Context, job *Job[json.RawMessage]) error {
+		var payload T
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return Permanent(fmt.Errorf("jobs: invalid %s payload: %w", t.name, err))
+		}
+		return handler(ctx, &Job[T]{
+			ID:         job.ID,
+			Type:       job.Type,
+			Attempt:    job.Attempt,
+			EnqueuedAt: job.EnqueuedAt,
+			Payload:    payload,
+		})
+	})
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// the handlers return it for the failures that a retry can't fix, the job is dead-lettered at once
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// the stored form of a job, a retry is stored again with the attempts made so far
+type envelope struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Payload    json.RawMessage `json:"payload"`
+	Attempts   int             `json:"attempts"`
+	EnqueuedAt time.Time       `json:"enqueuedAt"`
+	LastError  string          `json:"lastError,omitempty"`
+}
+
+func newJobID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,418 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/unusualcodeorg/goserve/arch/redis"
+)
+
+type Config struct {
+	// the stream of the queue, the instances sharing it share the jobs
+	Name  string
+	Group string
+	// unique per instance, its pending jobs are claimed by the others if it dies
+	Consumer string
+	// the jobs processed at the same time by the instance
+	Workers     int
+	MaxAttempts int
+	// the retries wait with an exponential backoff from BackoffMin up to BackoffMax, with jitter
+	BackoffMin time.Duration
+	BackoffMax time.Duration
+	// a job not acknowledged for this long is claimed by another worker, its worker is deemed dead
+	// the running jobs are kept visible with heartbeats, so it may be shorter than JobTimeout
+	VisibilityTimeout time.Duration
+	// the ctx of the handler is cancelled after it
+	JobTimeout time.Duration
+	// the delayed jobs and the stuck jobs are checked at this interval
+	PollInterval time.Duration
+	// the dead-letter stream is trimmed to about this length
+	DeadMaxLen int64
+}
+
+func DefaultConfig() Config {
+	host, _ := os.Hostname()
+	return Config{
+		Name:              "default",
+		Group:             "workers",
+		Consumer:          fmt.Sprintf("%s-%d", host, os.Getpid()),
+		Workers:           4,
+		MaxAttempts:       5,
+		BackoffMin:        time.Second,
+		BackoffMax:        10 * time.Minute,
+		VisibilityTimeout: time.Minute,
+		JobTimeout:        5 * time.Minute,
+		PollInterval:      time.Second,
+		DeadMaxLen:        10000,
+	}
+}
+
+/*
+ * Example -> queue := jobs.NewQueue(store, jobs.DefaultConfig())
+ * SendEmail.Handle(queue, sendEmail)
+ * queue.Start()
+ * defer queue.Shutdown(ctx)
+ * a job is delivered at least once, the handlers should be idempotent
+ */
+type Queue interface {
+	Enqueue(ctx context.Context, jobType string, payload any) (string, error)
+	EnqueueAt(ctx context.Context, at time.Time, jobType string, payload any) (string, error)
+	// the handlers should be registered before Start
+	Handle(jobType string, handler Handler)
+	Start()
+	// stops taking jobs and waits for the running ones until ctx is done, then cancels them
+	// a cancelled job is left pending and claimed by another worker after VisibilityTimeout
+	Shutdown(ctx context.Context) error
+}
+
+type queue struct {
+	broker broker
+	config Config
+	now    func() time.Time
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+
+	// one per worker, taken for each job in flight
+	slots chan struct{}
+	// only used by the poll loop
+	nextClaim time.Time
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	// cancelled by Shutdown to stop taking jobs
+	polling context.Context
+	stop    context.CancelFunc
+	// cancelled when Shutdown gives up waiting for the running jobs
+	running  context.Context
+	abort    context.CancelFunc
+	loops    sync.WaitGroup
+	inFlight sync.WaitGroup
+}
+
+func NewQueue(store redis.Store, config Config) Queue {
+	config = withDefaults(config)
+	return newQueue(newRedisBroker(store, config), config)
+}
+
+func newQueue(broker broker, config Config) *queue {
+	config = withDefaults(config)
+	q := &queue{
+		broker:   broker,
+		config:   config,
+		now:      time.Now,
+		handlers: map[string]Handler{},
+		slots:    make(chan struct{}, config.Workers),
+	}
+	q.polling, q.stop = context.WithCancel(context.Background())
+	q.running, q.abort = context.WithCancel(context.Background())
+	return q
+}
+
+func withDefaults(config Config) Config {
+	defaults := DefaultConfig()
+	if config.Name == "" {
+		config.Name = defaults.Name
+	}
+	if config.Group == "" {
+		config.Group = defaults.Group
+	}
+	if config.Consumer == "" {
+		config.Consumer = defaults.Consumer
+	}
+	if config.Workers <= 0 {
+		config.Workers = defaults.Workers
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaults.MaxAttempts
+	}
+	if config.BackoffMin <= 0 {
+		config.BackoffMin = defaults.BackoffMin
+	}
+	config.BackoffMax = max(config.BackoffMax, config.BackoffMin)
+	if config.VisibilityTimeout <= 0 {
+		config.VisibilityTimeout = defaults.VisibilityTimeout
+	}
+	if config.JobTimeout <= 0 {
+		config.JobTimeout = defaults.JobTimeout
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaults.PollInterval
+	}
+	if config.DeadMaxLen <= 0 {
+		config.DeadMaxLen = defaults.DeadMaxLen
+	}
+	return config
+}
+
+func (q *queue) Enqueue(ctx context.Context, jobType string, payload any) (string, error) {
+	return q.enqueue(ctx, time.Time{}, jobType, payload)
+}
+
+func (q *queue) EnqueueAt(ctx context.Context, at time.Time, jobType string, payload any) (string, error) {
+	return q.enqueue(ctx, at, jobType, payload)
+}
+
+func (q *queue) enqueue(ctx context.Context, at time.Time, jobType string, payload any) (string, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	now := q.now()
+	job := envelope{ID: newJobID(), Type: jobType, Payload: raw, EnqueuedAt: now}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+
+	if at.After(now) {
+		err = q.broker.schedule(ctx, data, at)
+	} else {
+		err = q.broker.add(ctx, data)
+	}
+	if err != nil {
+		return "", err
+	}
+	return job.ID, nil
+}
+
+func (q *queue) Handle(jobType string, handler Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = handler
+}
+
+func (q *queue) handler(jobType string) Handler {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.handlers[jobType]
+}
+
+func (q *queue) Start() {
+	q.startOnce.Do(func() {
+		q.loops.Add(2)
+		go q.poll()
+		go q.maintain()
+	})
+}
+
+func (q *queue) Shutdown(ctx context.Context) error {
+	q.stopOnce.Do(q.stop)
+	q.loops.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		q.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		q.abort()
+		return ctx.Err()
+	}
+}
+
+// blocks for a free worker, then takes the other free ones too, 0 when stopped
+func (q *queue) acquire() int {
+	select {
+	case q.slots <- struct{}{}:
+	case <-q.polling.Done():
+		return 0
+	}
+	return 1 + q.tryAcquire()
+}
+
+func (q *queue) tryAcquire() int {
+	n := 0
+	for {
+		select {
+		case q.slots <- struct{}{}:
+			n++
+		default:
+			return n
+		}
+	}
+}
+
+func (q *queue) release(n int) {
+	for i := 0; i < n; i++ {
+		<-q.slots
+	}
+}
+
+func (q *queue) poll() {
+	defer q.loops.Done()
+	for {
+		n := q.acquire()
+		if n == 0 {
+			return
+		}
+
+		deliveries, err := q.fetch(n)
+		q.release(n - len(deliveries))
+		if err != nil {
+			if q.polling.Err() != nil {
+				return
+			}
+			fmt.Println("jobs: fetch failed:", err)
+			q.wait(q.config.PollInterval)
+			continue
+		}
+		q.dispatch(deliveries)
+	}
+}
+
+// the jobs of the dead workers are recovered first, at most once per PollInterval
+func (q *queue) fetch(n int) ([]delivery, error) {
+	if now := q.now(); !now.Before(q.nextClaim) {
+		q.nextClaim = now.Add(q.config.PollInterval)
+		deliveries, err := q.broker.claim(q.polling, q.config.Consumer, q.config.VisibilityTimeout, n)
+		if err != nil || len(deliveries) > 0 {
+			return deliveries, err
+		}
+	}
+	return q.broker.read(q.polling, q.config.Consumer, n, q.config.PollInterval)
+}
+
+// promotes the due retries and the scheduled jobs
+func (q *queue) maintain() {
+	defer q.loops.Done()
+	for q.wait(q.config.PollInterval) {
+		if _, err := q.broker.promote(q.polling, q.now(), 100); err != nil && q.polling.Err() == nil {
+			fmt.Println("jobs: promote failed:", err)
+		}
+	}
+}
+
+// false when stopped
+func (q *queue) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-q.polling.Done():
+		return false
+	}
+}
+
+// each delivery holds a slot until done
+func (q *queue) dispatch(deliveries []delivery) {
+	for _, d := range deliveries {
+		q.inFlight.Add(1)
+		go func(d delivery) {
+			defer q.inFlight.Done()
+			defer q.release(1)
+			q.process(d)
+		}(d)
+	}
+}
+
+func (q *queue) process(d delivery) {
+	// the broker calls outlive Shutdown, the job must be settled once its handler returns
+	ctx := context.Background()
+
+	var job envelope
+	if err := json.Unmarshal(d.data, &job); err != nil {
+		q.settle(q.broker.dead(ctx, d.id, d.data), "dead-letter", d.id)
+		return
+	}
+
+	attempt := job.Attempts + d.deliveries
+	if attempt > q.config.MaxAttempts {
+		// the workers of the previous deliveries died or hung without settling it
+		job.LastError = fmt.Sprintf("abandoned after %d attempts", attempt-1)
+		q.settle(q.broker.dead(ctx, d.id, encode(job)), "dead-letter", job.ID)
+		return
+	}
+
+	err := q.run(d.id, &job, attempt)
+	switch {
+	case err == nil:
+		q.settle(q.broker.ack(ctx, d.id), "ack", job.ID)
+	case q.running.Err() != nil:
+		// aborted by Shutdown, left pending for another worker
+	case IsPermanent(err) || attempt >= q.config.MaxAttempts:
+		job.Attempts = attempt
+		job.LastError = err.Error()
+		q.settle(q.broker.dead(ctx, d.id, encode(job)), "dead-letter", job.ID)
+	default:
+		job.Attempts = attempt
+		job.LastError = err.Error()
+		at := q.now().Add(q.backoff(attempt))
+		q.settle(q.broker.retry(ctx, d.id, encode(job), at), "retry", job.ID)
+	}
+}
+
+// runs the handler with heartbeats, a panic fails the attempt
+func (q *queue) run(id string, job *envelope, attempt int) (err error) {
+	handler := q.handler(job.Type)
+	if handler == nil {
+		return Permanent(fmt.Errorf("%w: %s", ErrNoHandler, job.Type))
+	}
+
+	ctx, cancel := context.WithTimeout(q.running, q.config.JobTimeout)
+	defer cancel()
+	go q.heartbeat(ctx, id)
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("jobs: %s panicked: %v", job.Type, r)
+		}
+	}()
+
+	return handler(ctx, &Job[json.RawMessage]{
+		ID:         job.ID,
+		Type:       job.Type,
+		Attempt:    attempt,
+		EnqueuedAt: job.EnqueuedAt,
+		Payload:    job.Payload,
+	})
+}
+
+func (q *queue) heartbeat(ctx context.Context, id string) {
+	ticker := time.NewTicker(q.config.VisibilityTimeout / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := q.broker.touch(ctx, q.config.Consumer, id); err != nil && ctx.Err() == nil {
+				fmt.Println("jobs: heartbeat failed:", err)
+			}
+		}
+	}
+}
+
+// half of the delay is random, so that the jobs failing together are not retried together
+func (q *queue) backoff(attempt int) time.Duration {
+	delay := q.config.BackoffMin
+	for i := 1; i < attempt && delay < q.config.BackoffMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, q.config.BackoffMax)
+	return delay/2 + time.Duration(mrand.Int63n(int64(delay/2)+1))
+}
+
+// a job that can't be settled is delivered again after VisibilityTimeout
+func (q *queue) settle(err error, action string, id string) {
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Printf("jobs: %s of %s failed: %v\n", action, id, err)
+	}
+}
+
+func encode(job envelope) []byte {
+	data, _ := json.Marshal(job)
+	return data
+}
@@ -0,0 +1,258 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type emailPayload struct {
+	To string `json:"to"`
+}
+
+var sendEmail = NewType[emailPayload]("email.send")
+
+func newTestQueue(config Config) (*queue, *memoryBroker) {
+	config.PollInterval = 5 * time.Millisecond
+	config.BackoffMin = time.Millisecond
+	config.BackoffMax = 4 * time.Millisecond
+	broker := newMemoryBroker(time.Now)
+	return newQueue(broker, config), broker
+}
+
+func (b *memoryBroker) counts() (messages int, scheduled int, dead int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.messages), len(b.scheduled), len(b.deadJobs)
+}
+
+func (b *memoryBroker) deadJob(i int) envelope {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var job envelope
+	json.Unmarshal(b.deadJobs[i], &job)
+	return job
+}
+
+func TestQueueProcess(t *testing.T) {
+	q, broker := newTestQueue(Config{})
+	defer q.Shutdown(context.Background())
+
+	jobs := make(chan *Job[emailPayload], 1)
+	sendEmail.Handle(q, func(ctx context.Context, job *Job[emailPayload]) error {
+		jobs <- job
+		return nil
+	})
+	q.Start()
+
+	id, err := sendEmail.Enqueue(context.Background(), q, emailPayload{To: "a@b.com"})
+	assert.NoError(t, err)
+
+	job := <-jobs
+	assert.Equal(t, id, job.ID)
+	assert.Equal(t, "email.send", job.Type)
+	assert.Equal(t, 1, job.Attempt)
+	assert.Equal(t, "a@b.com", job.Payload.To)
+
+	assert.Eventually(t, func() bool {
+		messages, scheduled, dead := broker.counts()
+		return messages == 0 && scheduled == 0 && dead == 0
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestQueueRetry(t *testing.T) {
+	q, broker := newTestQueue(Config{MaxAttempts: 5})
+	defer q.Shutdown(context.Background())
+
+	var attempts atomic.Int32
+	done := make(chan int, 1)
+	sendEmail.Handle(q, func(ctx context.Context, job *Job[emailPayload]) error {
+		attempts.Add(1)
+		if job.Attempt < 3 {
+			return errors.New("smtp unavailable")
+		}
+		done <- job.Attempt
+		return nil
+	})
+	q.Start()
+
+	id, _ := sendEmail.Enqueue(context.Background(), q, emailPayload{To: "a@b.com"})
+	assert.Equal(t, 3, <-done)
+	assert.Equal(t, int32(3), attempts.Load())
+
+	assert.Eventually(t, func() bool {
+		messages, scheduled, dead := broker.counts()
+		return messages == 0 && scheduled == 0 && dead == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.NotEmpty(t, id)
+}
+
+func TestQueueDeadLetter(t *testing.T) {
+	q, broker := newTestQueue(Config{MaxAttempts: 2})
+	defer q.Shutdown(context.Background())
+
+	var attempts atomic.Int32
+	sendEmail.Handle(q, func(ctx context.Context, job *Job[emailPayload]) error {
+		attempts.Add(1)
+		if job.Payload.To == "" {
+			return Permanent(errors.New("no recipient"))
+		}
+		return errors.New("smtp unavailable")
+	})
+	q.Handle("panics", func(ctx context.Context, job *Job[json.RawMessage]) error {
+		panic("boom")
+	})
+	q.Start()
+
+	sendEmail.Enqueue(context.Background(), q, emailPayload{To: "a@b.com"})
+	assert.Eventually(t, func() bool { _, _, dead := broker.counts(); return dead == 1 }, time.Second, 5*time.Millisecond)
+	job := broker.deadJob(0)
+	assert.Equal(t, 2, job.Attempts)
+	assert.Equal(t, "smtp unavailable", job.LastError)
+	assert.Equal(t, int32(2), attempts.Load())
+
+	sendEmail.Enqueue(context.Background(), q, emailPayload{})
+	assert.Eventually(t, func() bool { _, _, dead := broker.counts(); return dead == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 1, broker.deadJob(1).Attempts)
+	assert.Equal(t, int32(3), attempts.Load())
+
+	q.Enqueue(context.Background(), "unknown", nil)
+	assert.Eventually(t, func() bool { _, _, dead := broker.counts(); return dead == 3 }, time.Second, 5*time.Millisecond)
+	assert.Contains(t, broker.deadJob(2).LastError, ErrNoHandler.Error())
+
+	q.Enqueue(context.Background(), "panics", nil)
+	assert.Eventually(t, func() bool { _, _, dead := broker.counts(); return dead == 4 }, time.Second, 5*time.Millisecond)
+	assert.Contains(t, broker.deadJob(3).LastError, "panicked: boom")
+
+	q.Enqueue(context.Background(), sendEmail.Name(), "not an object")
+	assert.Eventually(t, func() bool { _, _, dead := broker.counts(); return dead == 5 }, time.Second, 5*time.Millisecond)
+	assert.Contains(t, broker.deadJob(4).LastError, "invalid email.send payload")
+	assert.Equal(t, int32(3), attempts.Load())
+}
+
+func TestQueueClaimStuck(t *testing.T) {
+	q, broker := newTestQueue(Config{MaxAttempts: 3, VisibilityTimeout: 20 * time.Millisecond})
+	defer q.Shutdown(context.Background())
+
+	done := make(chan int, 1)
+	sendEmail.Handle(q, func(ctx context.Context, job *Job[emailPayload]) error {
+		done <- job.Attempt
+		return nil
+	})
+
+	// taken by a worker that died before settling it
+	sendEmail.Enqueue(context.Background(), q, emailPayload{To: "a@b.com"})
+	deliveries, _ := broker.read(context.Background(), "dead-worker", 1, 0)
+	assert.Len(t, deliveries, 1)
+
+	q.Start()
+	assert.Equal(t, 2, <-done)
+
+	// abandoned by every worker
+	sendEmail.Enqueue(context.Background(), q, emailPayload{To: "a@b.com"})
+	deliveries, _ = broker.read(context.Background(), "dead-worker", 1, 0)
+	assert.Len(t, deliveries, 1)
+	broker.mu.Lock()
+	broker.messages[0].deliveries = 3
+	broker.mu.Unlock()
+
+	assert.Eventually(t, func() bool { _, _, dead := broker.counts(); return dead == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "abandoned after 3 attempts", broker.deadJob(0).LastError)
+}
+
+func TestQueueHeartbeat(t *testing.T) {
+	q, broker := newTestQueue(Config{VisibilityTimeout: 15 * time.Millisecond})
+	defer q.Shutdown(context.Background())
+
+	var attempts atomic.Int32
+	sendEmail.Handle(q, func(ctx context.Context, job *Job[emailPayload]) error {
+		attempts.Add(1)
+		time.Sleep(80 * time.Millisecond)
+		return nil
+	})
+	q.Start()
+
+	sendEmail.Enqueue(context.Background(), q, emailPayload{To: "a@b.com"})
+	assert.Eventually(t, func() bool { messages, _, _ := broker.counts(); return messages == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(1), attempts.Load())
+}
+
+func TestQueueEnqueueAt(t *testing.T) {
+	q, broker := newTestQueue(Config{})
+	defer q.Shutdown(context.Background())
+
+	done := make(chan time.Time, 1)
+	sendEmail.Handle(q, func(ctx context.Context, job *Job[emailPayload]) error {
+		done <- time.Now()
+		return nil
+	})
+	q.Start()
+
+	at := time.Now().Add(50 * time.Millisecond)
+	_, err := q.EnqueueAt(context.Background(), at, sendEmail.Name(), emailPayload{To: "a@b.com"})
+	assert.NoError(t, err)
+	_, scheduled, _ := broker.counts()
+	assert.Equal(t, 1, scheduled)
+
+	assert.False(t, (<-done).Before(at))
+}
+
+func TestQueueShutdown(t *testing.T) {
+	q, broker := newTestQueue(Config{})
+
+	started := make(chan struct{}, 2)
+	q.Handle("slow", func(ctx context.Context, job *Job[json.RawMessage]) error {
+		started <- struct{}{}
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	q.Handle("stuck", func(ctx context.Context, job *Job[json.RawMessage]) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	q.Start()
+
+	q.Enqueue(context.Background(), "slow", nil)
+	<-started
+	assert.NoError(t, q.Shutdown(context.Background()))
+	messages, _, _ := broker.counts()
+	assert.Equal(t, 0, messages)
+
+	q, broker = newTestQueue(Config{})
+	q.Handle("stuck", func(ctx context.Context, job *Job[json.RawMessage]) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	q.Start()
+
+	q.Enqueue(context.Background(), "stuck", nil)
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, q.Shutdown(ctx), context.DeadlineExceeded)
+
+	// left pending for another worker
+	time.Sleep(10 * time.Millisecond)
+	messages, scheduled, dead := broker.counts()
+	assert.Equal(t, 1, messages)
+	assert.Equal(t, 0, scheduled+dead)
+
+	_, err := q.Enqueue(context.Background(), "stuck", nil)
+	assert.NoError(t, err)
+}
+
+func TestQueueBackoff(t *testing.T) {
+	q := newQueue(newMemoryBroker(time.Now), Config{BackoffMin: time.Second, BackoffMax: 10 * time.Second})
+	for attempt, limit := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 100: 10 * time.Second} {
+		delay := q.backoff(attempt)
+		assert.GreaterOrEqual(t, delay, limit/2)
+		assert.LessOrEqual(t, delay, limit)
+	}
+}
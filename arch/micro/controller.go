@@ -15,3 +15,5 @@ func NewBaseController(basePath string, authProvider network.AuthenticationProvi
 		BaseController: network.NewBaseController(basePath, authProvider, authorizeProvider),
 	}
 }
+
+func (c *baseController) MountEvents(group EventGroup) {}
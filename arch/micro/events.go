@@ -0,0 +1,480 @@
+package micro
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const eventSubjectPrefix = "events."
+
+/*
+ * The envelope of the domain events published on the jetstream stream
+ * Example -> {"id":"..","type":"blog.published","source":"blogs","time":"..","version":1,"payload":{..}}
+ */
+type Event[T any] struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// the service that published the event
+	Source string    `json:"source"`
+	Time   time.Time `json:"time"`
+	// of the payload schema, increased on the changes the older subscribers can't read
+	Version int `json:"version"`
+	Payload T   `json:"payload"`
+	// starts at 1, the event is redelivered until acknowledged or SubscriberConfig.MaxDeliver
+	Delivery int `json:"-"`
+}
+
+type EventHandler func(ctx context.Context, event *Event[json.RawMessage]) error
+
+/*
+ * Example -> var BlogPublished = micro.NewEventType[BlogPublishedPayload]("blog.published", 1)
+ * id, err := BlogPublished.Publish(ctx, natsClient.GetInstance().Events, payload)
+ * in the controller of the subscriber: func (c *controller) MountEvents(group micro.EventGroup) {
+ *   BlogPublished.Subscribe(group, c.onBlogPublished)
+ * }
+ */
+type EventType[T any] struct {
+	name    string
+	version int
+}
+
+func NewEventType[T any](name string, version int) EventType[T] {
+	return EventType[T]{name: name, version: version}
+}
+
+func (e EventType[T]) Name() string {
+	return e.name
+}
+
+func (e EventType[T]) Subject() string {
+	return eventSubjectPrefix + e.name
+}
+
+func (e EventType[T]) Publish(ctx context.Context, events Events, payload T) (string, error) {
+	return events.Publish(ctx, e.name, e.version, payload)
+}
+
+func (e EventType[T]) Subscribe(group EventGroup, handler func(ctx context.Context, event *Event[T]) error) {
+	e.SubscribeWithConfig(group, DefaultSubscriberConfig(), handler)
+}
+
+// a payload that can't be decoded is terminated without redeliveries
+func (e EventType[T]) SubscribeWithConfig(group EventGroup, config SubscriberConfig, handler func(ctx context.Context, event *Event[T]) error) {
+	group.Subscribe(e.name, config, func(ctx context.Context, event *Event[json.RawMessage]) error {
+		var payload T
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return Permanent(fmt.Errorf("micro: invalid %s v%d payload: %w", e.name, event.Version, err))
+		}
+		return handler(ctx, &Event[T]{
+			ID:       event.ID,
+			Type:     event.Type,
+			Source:   event.Source,
+			Time:     event.Time,
+			Version:  event.Version,
+			Payload:  payload,
+			Delivery: event.Delivery,
+		})
+	})
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// the event handlers return it for the failures that a redelivery can't fix, the event is terminated at once
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+type SubscriberConfig struct {
+	// the deliveries of an event before it is terminated
+	MaxDeliver int
+	// an event not acknowledged for this long is redelivered, the running handlers extend it
+	AckWait time.Duration
+	// a failed event is redelivered with an exponential backoff from BackoffMin up to BackoffMax
+	BackoffMin time.Duration
+	BackoffMax time.Duration
+	// the events handled at the same time by the instance
+	Concurrency int
+	// a new consumer reads the events kept in the stream, else only the ones published after it
+	FromStart bool
+}
+
+func DefaultSubscriberConfig() SubscriberConfig {
+	return SubscriberConfig{
+		MaxDeliver:  5,
+		AckWait:     30 * time.Second,
+		BackoffMin:  time.Second,
+		BackoffMax:  time.Minute,
+		Concurrency: 1,
+	}
+}
+
+func (c SubscriberConfig) withDefaults() SubscriberConfig {
+	defaults := DefaultSubscriberConfig()
+	if c.MaxDeliver <= 0 {
+		c.MaxDeliver = defaults.MaxDeliver
+	}
+	if c.AckWait <= 0 {
+		c.AckWait = defaults.AckWait
+	}
+	if c.BackoffMin <= 0 {
+		c.BackoffMin = defaults.BackoffMin
+	}
+	c.BackoffMax = max(c.BackoffMax, c.BackoffMin)
+	if c.Concurrency <= 0 {
+		c.Concurrency = defaults.Concurrency
+	}
+	return c
+}
+
+type Events interface {
+	// the id dedupes the retried publications within the duplicate window of the stream
+	Publish(ctx context.Context, eventType string, version int, payload any) (string, error)
+	// creates or updates the durable pull consumer and consumes it until Stop
+	// the instances subscribing with the same durable share the events, each durable gets all of them
+	Subscribe(durable string, eventType string, config SubscriberConfig, handler EventHandler) error
+	// stops consuming and waits for the running handlers until ctx is done, then cancels them
+	Stop(ctx context.Context) error
+}
+
+type EventsConfig struct {
+	Stream string
+	// the events are kept in the stream for this long
+	MaxAge time.Duration
+	// the service publishing the events
+	Source string
+}
+
+type events struct {
+	js     jetstream.JetStream
+	config EventsConfig
+
+	mu     sync.Mutex
+	stream jetstream.Stream
+
+	subsMu   sync.Mutex
+	consumes []jetstream.ConsumeContext
+	// set by Stop, no handler is started after it so that the wait of Stop covers all of them
+	stopped  bool
+	inFlight sync.WaitGroup
+	running  context.Context
+	abort    context.CancelFunc
+}
+
+func NewEvents(js jetstream.JetStream, config EventsConfig) Events {
+	if config.Stream == "" {
+		config.Stream = "EVENTS"
+	}
+	if config.MaxAge <= 0 {
+		config.MaxAge = 7 * 24 * time.Hour
+	}
+	e := &events{js: js, config: config}
+	e.running, e.abort = context.WithCancel(context.Background())
+	return e
+}
+
+// created on the first use, so that the services without jetstream can still use request/reply
+func (e *events) ensureStream(ctx context.Context) (jetstream.Stream, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.stream != nil {
+		return e.stream, nil
+	}
+	stream, err := e.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:       e.config.Stream,
+		Subjects:   []string{eventSubjectPrefix + ">"},
+		MaxAge:     e.config.MaxAge,
+		Duplicates: 2 * time.Minute,
+		Storage:    jetstream.FileStorage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("micro: events stream %s: %w", e.config.Stream, err)
+	}
+	e.stream = stream
+	return stream, nil
+}
+
+func (e *events) Publish(ctx context.Context, eventType string, version int, payload any) (string, error) {
+	if _, err := e.ensureStream(ctx); err != nil {
+		return "", err
+	}
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	event := Event[json.RawMessage]{
+		ID:      newEventID(),
+		Type:    eventType,
+		Source:  e.config.Source,
+		Time:    time.Now().UTC(),
+		Version: version,
+		Payload: raw,
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = e.js.Publish(ctx, eventSubjectPrefix+eventType, data, jetstream.WithMsgID(event.ID))
+	if err != nil {
+		return "", err
+	}
+	return event.ID, nil
+}
+
+func (e *events) Subscribe(durable string, eventType string, config SubscriberConfig, handler EventHandler) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream, err := e.ensureStream(ctx)
+	if err != nil {
+		return err
+	}
+
+	config = config.withDefaults()
+	deliverPolicy := jetstream.DeliverNewPolicy
+	if config.FromStart {
+		deliverPolicy = jetstream.DeliverAllPolicy
+	}
+
+	consumer, err := stream.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+		Durable:       durable,
+		FilterSubject: eventSubjectPrefix + eventType,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       config.AckWait,
+		MaxDeliver:    config.MaxDeliver,
+		MaxAckPending: config.Concurrency * 2,
+		DeliverPolicy: deliverPolicy,
+	})
+	if err != nil {
+		return fmt.Errorf("micro: consumer %s: %w", durable, err)
+	}
+
+	sub := &subscription{
+		durable: durable,
+		config:  config,
+		handler: handler,
+		running: e.running,
+		slots:   make(chan struct{}, config.Concurrency),
+	}
+
+	consume, err := consumer.Consume(func(msg jetstream.Msg) {
+		e.deliver(sub, msg)
+	}, jetstream.PullMaxMessages(config.Concurrency), jetstream.ConsumeErrHandler(func(_ jetstream.ConsumeContext, err error) {
+		fmt.Printf("micro: consumer %s: %v\n", durable, err)
+	}))
+	if err != nil {
+		return fmt.Errorf("micro: consumer %s: %w", durable, err)
+	}
+
+	e.subsMu.Lock()
+	defer e.subsMu.Unlock()
+	if e.stopped {
+		consume.Stop()
+		return fmt.Errorf("micro: consumer %s: events stopped", durable)
+	}
+	e.consumes = append(e.consumes, consume)
+	return nil
+}
+
+// blocks the consumer while all the handlers are busy, the events taken after Stop are returned at once
+func (e *events) deliver(sub *subscription, msg jetstream.Msg) {
+	sub.slots <- struct{}{}
+	if !e.track() {
+		<-sub.slots
+		sub.settle(msg.Nak(), "nak")
+		return
+	}
+	go func() {
+		defer e.inFlight.Done()
+		defer func() { <-sub.slots }()
+		sub.handle(msg)
+	}()
+}
+
+func (e *events) track() bool {
+	e.subsMu.Lock()
+	defer e.subsMu.Unlock()
+	if e.stopped {
+		return false
+	}
+	e.inFlight.Add(1)
+	return true
+}
+
+// the events taken but not acknowledged are redelivered after the AckWait
+func (e *events) Stop(ctx context.Context) error {
+	e.subsMu.Lock()
+	e.stopped = true
+	for _, consume := range e.consumes {
+		consume.Stop()
+	}
+	e.consumes = nil
+	e.subsMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		e.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		e.abort()
+		return ctx.Err()
+	}
+}
+
+type subscription struct {
+	durable string
+	config  SubscriberConfig
+	handler EventHandler
+	running context.Context
+	slots   chan struct{}
+}
+
+func (s *subscription) handle(msg jetstream.Msg) {
+	var event Event[json.RawMessage]
+	if err := json.Unmarshal(msg.Data(), &event); err != nil {
+		s.settle(msg.TermWithReason("invalid event"), "term")
+		fmt.Printf("micro: %s terminated an invalid event on %s: %v\n", s.durable, msg.Subject(), err)
+		return
+	}
+
+	event.Delivery = 1
+	if meta, err := msg.Metadata(); err == nil {
+		event.Delivery = int(meta.NumDelivered)
+	}
+
+	err := s.run(msg, &event)
+	switch {
+	case err == nil:
+		s.settle(msg.Ack(), "ack")
+	case s.running.Err() != nil:
+		// stopped, another instance takes it at once
+		s.settle(msg.Nak(), "nak")
+	case IsPermanent(err) || event.Delivery >= s.config.MaxDeliver:
+		fmt.Printf("micro: %s terminated the %s event %s after %d deliveries: %v\n", s.durable, event.Type, event.ID, event.Delivery, err)
+		s.settle(msg.TermWithReason(err.Error()), "term")
+	default:
+		s.settle(msg.NakWithDelay(s.backoff(event.Delivery)), "nak")
+	}
+}
+
+// runs the handler extending the AckWait, a panic fails the delivery
+func (s *subscription) run(msg jetstream.Msg, event *Event[json.RawMessage]) (err error) {
+	ctx, cancel := context.WithCancel(s.running)
+	defer cancel()
+	go s.heartbeat(ctx, msg)
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("micro: %s handler panicked: %v", event.Type, r)
+		}
+	}()
+
+	return s.handler(ctx, event)
+}
+
+func (s *subscription) heartbeat(ctx context.Context, msg jetstream.Msg) {
+	ticker := time.NewTicker(s.config.AckWait / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			msg.InProgress()
+		}
+	}
+}
+
+func (s *subscription) backoff(delivery int) time.Duration {
+	delay := s.config.BackoffMin
+	for i := 1; i < delivery && delay < s.config.BackoffMax; i++ {
+		delay *= 2
+	}
+	return min(delay, s.config.BackoffMax)
+}
+
+// an event that can't be settled is redelivered after the AckWait
+func (s *subscription) settle(err error, action string) {
+	if err != nil {
+		fmt.Printf("micro: %s %s failed: %v\n", s.durable, action, err)
+	}
+}
+
+/*
+ * Passed to Controller.MountEvents, the durable consumers are named after the service, the controller and the event type
+ * Example -> blogs_blog_user_signed_up
+ * it panics if the consumer can't be created, like the nats connection at the startup
+ */
+type EventGroup interface {
+	Events() Events
+	Subscribe(eventType string, config SubscriberConfig, handler EventHandler)
+}
+
+type eventGroup struct {
+	events Events
+	prefix string
+}
+
+func NewEventGroup(events Events, prefix string) EventGroup {
+	return &eventGroup{events: events, prefix: prefix}
+}
+
+func (g *eventGroup) Events() Events {
+	return g.events
+}
+
+func (g *eventGroup) Subscribe(eventType string, config SubscriberConfig, handler EventHandler) {
+	durable := DurableName(g.prefix, eventType)
+	if err := g.events.Subscribe(durable, eventType, config, handler); err != nil {
+		panic(err)
+	}
+}
+
+// the durable names can't have dots, wildcards or spaces
+func DurableName(parts ...string) string {
+	name := strings.Join(parts, "_")
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_", "/", "_").Replace(strings.Trim(name, "._/"))
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,184 @@
+package micro
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeMsg struct {
+	data      []byte
+	delivered uint64
+	settled   string
+	delay     time.Duration
+	reason    string
+}
+
+func (m *fakeMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{NumDelivered: m.delivered}, nil
+}
+func (m *fakeMsg) Data() []byte                       { return m.data }
+func (m *fakeMsg) Headers() nats.Header               { return nil }
+func (m *fakeMsg) Subject() string                    { return "events.blog.published" }
+func (m *fakeMsg) Reply() string                      { return "" }
+func (m *fakeMsg) Ack() error                         { m.settled = "ack"; return nil }
+func (m *fakeMsg) DoubleAck(context.Context) error    { m.settled = "ack"; return nil }
+func (m *fakeMsg) Nak() error                         { m.settled = "nak"; return nil }
+func (m *fakeMsg) InProgress() error                  { return nil }
+func (m *fakeMsg) Term() error                        { m.settled = "term"; return nil }
+func (m *fakeMsg) NakWithDelay(d time.Duration) error { m.settled = "nak"; m.delay = d; return nil }
+func (m *fakeMsg) TermWithReason(reason string) error {
+	m.settled = "term"
+	m.reason = reason
+	return nil
+}
+
+type fakeGroup struct {
+	handler EventHandler
+}
+
+func (g *fakeGroup) Events() Events { return nil }
+func (g *fakeGroup) Subscribe(eventType string, config SubscriberConfig, handler EventHandler) {
+	g.handler = handler
+}
+
+type blogPublished struct {
+	BlogID string `json:"blogId"`
+}
+
+var blogPublishedEvent = NewEventType[blogPublished]("blog.published", 1)
+
+func newEventMsg(t *testing.T, payload any, delivered uint64) *fakeMsg {
+	raw, err := json.Marshal(payload)
+	assert.NoError(t, err)
+	data, err := json.Marshal(Event[json.RawMessage]{ID: "1", Type: "blog.published", Version: 1, Payload: raw})
+	assert.NoError(t, err)
+	return &fakeMsg{data: data, delivered: delivered}
+}
+
+func newSubscription(handler func(ctx context.Context, event *Event[blogPublished]) error) *subscription {
+	group := &fakeGroup{}
+	blogPublishedEvent.Subscribe(group, handler)
+	return &subscription{
+		durable: "blogs_blog_published",
+		config:  DefaultSubscriberConfig().withDefaults(),
+		handler: group.handler,
+		running: context.Background(),
+	}
+}
+
+func TestEventsAck(t *testing.T) {
+	var got *Event[blogPublished]
+	sub := newSubscription(func(ctx context.Context, event *Event[blogPublished]) error {
+		got = event
+		return nil
+	})
+
+	msg := newEventMsg(t, blogPublished{BlogID: "b1"}, 2)
+	sub.handle(msg)
+
+	assert.Equal(t, "ack", msg.settled)
+	assert.Equal(t, "b1", got.Payload.BlogID)
+	assert.Equal(t, 2, got.Delivery)
+	assert.Equal(t, 1, got.Version)
+}
+
+func TestEventsNakWithBackoff(t *testing.T) {
+	sub := newSubscription(func(ctx context.Context, event *Event[blogPublished]) error {
+		return errors.New("down")
+	})
+
+	msg := newEventMsg(t, blogPublished{BlogID: "b1"}, 1)
+	sub.handle(msg)
+	assert.Equal(t, "nak", msg.settled)
+	assert.Equal(t, time.Second, msg.delay)
+
+	msg = newEventMsg(t, blogPublished{BlogID: "b1"}, 3)
+	sub.handle(msg)
+	assert.Equal(t, "nak", msg.settled)
+	assert.Equal(t, 4*time.Second, msg.delay)
+}
+
+func TestEventsTerm(t *testing.T) {
+	sub := newSubscription(func(ctx context.Context, event *Event[blogPublished]) error {
+		if event.Payload.BlogID == "" {
+			return Permanent(errors.New("no blog"))
+		}
+		return errors.New("down")
+	})
+
+	msg := newEventMsg(t, blogPublished{}, 1)
+	sub.handle(msg)
+	assert.Equal(t, "term", msg.settled)
+	assert.Equal(t, "no blog", msg.reason)
+
+	msg = newEventMsg(t, blogPublished{BlogID: "b1"}, 5)
+	sub.handle(msg)
+	assert.Equal(t, "term", msg.settled)
+
+	msg = newEventMsg(t, "not a blog", 1)
+	sub.handle(msg)
+	assert.Equal(t, "term", msg.settled)
+
+	msg = &fakeMsg{data: []byte("{"), delivered: 1}
+	sub.handle(msg)
+	assert.Equal(t, "term", msg.settled)
+}
+
+func TestEventsPanic(t *testing.T) {
+	sub := newSubscription(func(ctx context.Context, event *Event[blogPublished]) error {
+		panic("boom")
+	})
+
+	msg := newEventMsg(t, blogPublished{BlogID: "b1"}, 1)
+	sub.handle(msg)
+	assert.Equal(t, "nak", msg.settled)
+}
+
+func TestEventsStopWaitsForHandlers(t *testing.T) {
+	e := NewEvents(nil, EventsConfig{}).(*events)
+
+	release := make(chan struct{})
+	handled := 0
+	sub := newSubscription(func(ctx context.Context, event *Event[blogPublished]) error {
+		<-release
+		handled++
+		return nil
+	})
+	sub.slots = make(chan struct{}, 1)
+
+	running := newEventMsg(t, blogPublished{BlogID: "b1"}, 1)
+	e.deliver(sub, running)
+
+	stopped := make(chan error)
+	go func() { stopped <- e.Stop(context.Background()) }()
+
+	// taken while stopping, it waits for the slot then goes back to the stream
+	late := newEventMsg(t, blogPublished{BlogID: "b2"}, 1)
+	delivered := make(chan struct{})
+	go func() {
+		e.deliver(sub, late)
+		close(delivered)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	assert.NoError(t, <-stopped)
+	<-delivered
+
+	assert.Equal(t, 1, handled)
+	assert.Equal(t, "ack", running.settled)
+	assert.Equal(t, "nak", late.settled)
+}
+
+func TestDurableName(t *testing.T) {
+	assert.Equal(t, "blogs_blog_user_signed_up", DurableName("blogs.blog", "user.signed_up"))
+	assert.Equal(t, "blogs_user_signed", DurableName("blogs", "user signed"))
+	assert.Equal(t, "events.blog.published", blogPublishedEvent.Subject())
+}
@@ -22,6 +22,8 @@ type MessageSender interface {
 type BaseController interface {
 	MessageSender
 	network.BaseController
+	// subscribes the controller to the domain events, a no-op unless overridden
+	MountEvents(group EventGroup)
 }
 
 type Controller interface {
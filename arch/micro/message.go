@@ -3,41 +3,93 @@ package micro
 import (
 	"encoding/json"
 	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/unusualcodeorg/goserve/arch/network"
 )
 
 type Message[T any] struct {
-	Data  T       `json:"data,omitempty"`
-	Error *string `json:"error,omitempty"`
+	Data  T             `json:"data,omitempty"`
+	Error *MessageError `json:"error,omitempty"`
 }
 
 type AnyMessage = Message[any]
 
-func NewAnyMessage(data any, err error) *AnyMessage {
-	var e *string
-	if err != nil {
-		er := err.Error()
-		e = &er
+/*
+ * The error replied over nats, so that the requester returns the same status as the responder
+ * Example -> {"code":404,"message":"blog not found","details":"mongo: no documents in result"}
+ */
+type MessageError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	// the cause of the error when it differs from the message
+	Details string `json:"details,omitempty"`
+}
+
+// a plain error is replied as an internal server error
+func NewMessageError(err error) *MessageError {
+	if err == nil {
+		return nil
+	}
+
+	var apiError network.ApiError
+	if !errors.As(err, &apiError) {
+		return &MessageError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	msgErr := &MessageError{Code: apiError.GetCode(), Message: apiError.GetMessage()}
+	if cause := apiError.Unwrap(); cause != nil && cause.Error() != apiError.GetMessage() {
+		msgErr.Details = cause.Error()
+	}
+	return msgErr
+}
+
+func (e *MessageError) ApiError() network.ApiError {
+	code := e.Code
+	if code < 400 || code > 599 {
+		code = http.StatusInternalServerError
+	}
+	var cause error
+	if e.Details != "" {
+		cause = errors.New(e.Details)
+	}
+	return network.NewApiError(code, e.Message, cause)
+}
+
+// also reads the "code:message" string replied by the older services
+func (e *MessageError) UnmarshalJSON(data []byte) error {
+	var legacy string
+	if err := json.Unmarshal(data, &legacy); err == nil {
+		*e = MessageError{Code: http.StatusInternalServerError, Message: legacy}
+		if code, message, found := strings.Cut(legacy, ":"); found {
+			if c, err := strconv.Atoi(code); err == nil {
+				e.Code, e.Message = c, message
+			}
+		}
+		return nil
 	}
 
+	type messageError MessageError
+	return json.Unmarshal(data, (*messageError)(e))
+}
+
+func NewAnyMessage(data any, err error) *AnyMessage {
 	return &AnyMessage{
 		Data:  data,
-		Error: e,
+		Error: NewMessageError(err),
 	}
 }
 
 func NewMessage[T any](data T, err error) *Message[T] {
-	var e *string
-	if err != nil {
-		er := err.Error()
-		e = &er
-	}
-
 	return &Message[T]{
 		Data:  data,
-		Error: e,
+		Error: NewMessageError(err),
 	}
 }
 
+// the error of the message is returned as a network.ApiError
 func ParseMsg[T any](data []byte) (*T, error) {
 	var msg Message[*T]
 	err := json.Unmarshal(data, &msg)
@@ -46,8 +98,8 @@ func ParseMsg[T any](data []byte) (*T, error) {
 	}
 
 	if msg.Error != nil {
-		err = errors.New(*msg.Error)
+		return msg.Data, msg.Error.ApiError()
 	}
 
-	return msg.Data, err
+	return msg.Data, nil
 }
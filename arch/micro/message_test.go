@@ -0,0 +1,80 @@
+package micro
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/unusualcodeorg/goserve/arch/network"
+)
+
+type blogMsg struct {
+	Title string `json:"title"`
+}
+
+func roundtrip(t *testing.T, data any, err error) (*blogMsg, error) {
+	payload, e := json.Marshal(NewAnyMessage(data, err))
+	assert.NoError(t, e)
+	return ParseMsg[blogMsg](payload)
+}
+
+func TestMessageError(t *testing.T) {
+	blog, err := roundtrip(t, blogMsg{Title: "a"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", blog.Title)
+
+	_, err = roundtrip(t, nil, network.NewNotFoundError("blog not found", errors.New("mongo: no documents in result")))
+	var apiError network.ApiError
+	assert.True(t, errors.As(err, &apiError))
+	assert.Equal(t, http.StatusNotFound, apiError.GetCode())
+	assert.Equal(t, "blog not found", apiError.GetMessage())
+	assert.Equal(t, "mongo: no documents in result", apiError.Unwrap().Error())
+
+	_, err = roundtrip(t, nil, network.NewBadRequestError("invalid title", nil))
+	assert.True(t, errors.As(err, &apiError))
+	assert.Equal(t, http.StatusBadRequest, apiError.GetCode())
+	assert.Equal(t, "invalid title", apiError.Unwrap().Error())
+
+	_, err = roundtrip(t, nil, errors.New("connection reset"))
+	assert.True(t, errors.As(err, &apiError))
+	assert.Equal(t, http.StatusInternalServerError, apiError.GetCode())
+	assert.Equal(t, "connection reset", apiError.GetMessage())
+
+	payload, _ := json.Marshal(NewAnyMessage(nil, network.NewForbiddenError("denied", nil)))
+	assert.JSONEq(t, `{"error":{"code":403,"message":"denied"}}`, string(payload))
+}
+
+func TestMessageErrorLegacy(t *testing.T) {
+	_, err := ParseMsg[blogMsg]([]byte(`{"error":"404:blog not found"}`))
+	var apiError network.ApiError
+	assert.True(t, errors.As(err, &apiError))
+	assert.Equal(t, http.StatusNotFound, apiError.GetCode())
+	assert.Equal(t, "blog not found", apiError.GetMessage())
+
+	_, err = ParseMsg[blogMsg]([]byte(`{"error":"something failed"}`))
+	assert.True(t, errors.As(err, &apiError))
+	assert.Equal(t, http.StatusInternalServerError, apiError.GetCode())
+	assert.Equal(t, "something failed", apiError.GetMessage())
+}
+
+// a handler proxying a nats request replies with the status of the responder
+func TestMessageErrorProxy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	sender := network.NewResponseSender()
+	engine.GET("/blog", func(ctx *gin.Context) {
+		_, err := roundtrip(t, nil, network.NewNotFoundError("blog not found", nil))
+		sender.Send(ctx).MixedError(err)
+	})
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/blog", nil)
+	engine.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"message":"blog not found"`)
+}
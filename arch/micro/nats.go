@@ -1,11 +1,15 @@
 package micro
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	"github.com/nats-io/nats.go/micro"
+	"github.com/unusualcodeorg/goserve/arch/breaker"
 )
 
 type Config struct {
@@ -13,6 +17,12 @@ type Config struct {
 	NatsServiceName    string
 	NatsServiceVersion string
 	Timeout            time.Duration
+	// the jetstream stream of the domain events, EVENTS by default
+	EventStream string
+	EventMaxAge time.Duration
+	// the per subject circuit breakers of the requests made WithBreaker
+	BreakerFailures    int
+	BreakerOpenTimeout time.Duration
 }
 
 type NatsClient interface {
@@ -21,17 +31,49 @@ type NatsClient interface {
 }
 
 type natsClient struct {
-	Conn    *nats.Conn
-	Service micro.Service
-	Timeout time.Duration
+	Conn      *nats.Conn
+	Service   micro.Service
+	JetStream jetstream.JetStream
+	Events    Events
+	Timeout   time.Duration
+
+	breakerConfig breaker.Config
+	breakersMu    sync.Mutex
+	breakers      map[string]breaker.Breaker
 }
 
 func (n *natsClient) GetInstance() *natsClient {
 	return n
 }
 
+// one per subject, shared by the requests made WithBreaker
+func (n *natsClient) Breaker(subject string) breaker.Breaker {
+	n.breakersMu.Lock()
+	defer n.breakersMu.Unlock()
+
+	if n.breakers == nil {
+		n.breakers = map[string]breaker.Breaker{}
+	}
+	b, ok := n.breakers[subject]
+	if !ok {
+		config := n.breakerConfig
+		config.IsFailure = isTransient
+		config.OnStateChange = func(name string, from breaker.State, to breaker.State) {
+			fmt.Printf("nats %s circuit breaker %s -> %s\n", name, from, to)
+		}
+		b = breaker.New(subject, config)
+		n.breakers[subject] = b
+	}
+	return b
+}
+
 func (n *natsClient) Disconnect() {
 	fmt.Println("disconnecting nats..")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := n.Events.Stop(ctx); err != nil {
+		fmt.Println("events stopped before the handlers finished:", err)
+	}
 	n.Conn.Close()
 	fmt.Println("disconnected nats")
 }
@@ -52,11 +94,26 @@ func NewNatsClient(config *Config) NatsClient {
 		panic(err)
 	}
 
+	js, err := jetstream.New(nc)
+	if err != nil {
+		panic(err)
+	}
+
 	fmt.Println("connected to nats")
 
 	return &natsClient{
-		Conn:    nc,
-		Service: srv,
+		Conn:      nc,
+		Service:   srv,
+		JetStream: js,
+		Events: NewEvents(js, EventsConfig{
+			Stream: config.EventStream,
+			MaxAge: config.EventMaxAge,
+			Source: config.NatsServiceName,
+		}),
 		Timeout: config.Timeout,
+		breakerConfig: breaker.Config{
+			Failures:    config.BreakerFailures,
+			OpenTimeout: config.BreakerOpenTimeout,
+		},
 	}
 }
@@ -1,76 +1,280 @@
 package micro
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	mrand "math/rand"
+	"net/http"
 	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/unusualcodeorg/goserve/arch/breaker"
+	"github.com/unusualcodeorg/goserve/arch/network"
 )
 
+type RequestOption func(*requestOptions)
+
+type requestOptions struct {
+	timeout    time.Duration
+	retries    int
+	backoffMin time.Duration
+	backoffMax time.Duration
+	hedgeDelay time.Duration
+	breaker    bool
+}
+
+// of each attempt, micro.Config.Timeout by default
+func WithTimeout(timeout time.Duration) RequestOption {
+	return func(o *requestOptions) {
+		o.timeout = timeout
+	}
+}
+
+/*
+ * Retries the requests without responders or timed out, waiting with an exponential backoff with jitter
+ * only for the idempotent calls, a timed out request may still have been handled
+ */
+func WithRetry(retries int, backoffMin time.Duration, backoffMax time.Duration) RequestOption {
+	return func(o *requestOptions) {
+		o.retries = retries
+		o.backoffMin = backoffMin
+		o.backoffMax = max(backoffMax, backoffMin)
+	}
+}
+
+// sends a second request if there is no reply after delay and takes the first reply, only for the idempotent calls
+func WithHedge(delay time.Duration) RequestOption {
+	return func(o *requestOptions) {
+		o.hedgeDelay = delay
+	}
+}
+
+// fails fast with a 503 while the subject keeps timing out or has no responders, see NatsClient.Breaker
+func WithBreaker() RequestOption {
+	return func(o *requestOptions) {
+		o.breaker = true
+	}
+}
+
 type RequestBuilder[T any] interface {
 	NatsClient() NatsClient
-	Request(data any) Request[T]
+	// the options override the ones of the builder
+	Request(data any, options ...RequestOption) Request[T]
 }
 
 type requestBuilder[T any] struct {
 	natsClient NatsClient
 	subject    string
 	timeout    time.Duration
+	options    []RequestOption
+	send       func(ctx context.Context, subject string, data []byte) ([]byte, error)
 }
 
-func NewRequestBuilder[T any](natsClient NatsClient, subject string) RequestBuilder[T] {
-	return &requestBuilder[T]{
+/*
+ * Example -> builder := micro.NewRequestBuilder[dto.Blog](natsClient, "blogs.blog", micro.WithBreaker())
+ * blog, err := builder.Request(id, micro.WithRetry(2, 50*time.Millisecond, time.Second)).NatsWithContext(ctx.Request.Context())
+ */
+func NewRequestBuilder[T any](natsClient NatsClient, subject string, options ...RequestOption) RequestBuilder[T] {
+	c := &requestBuilder[T]{
 		natsClient: natsClient,
 		subject:    subject,
 		timeout:    natsClient.GetInstance().Timeout,
+		options:    options,
 	}
+	c.send = c.natsRequest
+	return c
 }
 
 func (c *requestBuilder[T]) NatsClient() NatsClient {
 	return c.natsClient
 }
 
+func (c *requestBuilder[T]) Request(data any, options ...RequestOption) Request[T] {
+	return newRequest(c, data, options)
+}
 
-func (c *requestBuilder[T]) Request(data any) Request[T] {
-	return newRequest(c, data)
+func (c *requestBuilder[T]) natsRequest(ctx context.Context, subject string, data []byte) ([]byte, error) {
+	msg, err := c.natsClient.GetInstance().Conn.RequestWithContext(ctx, subject, data)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Data, nil
 }
 
 type Request[T any] interface {
 	Nats() (*T, error)
+	// cancelled with ctx e.g. when the http client goes away
+	NatsWithContext(ctx context.Context) (*T, error)
 }
 
 type request[T any] struct {
 	builder *requestBuilder[T]
-	data       any
+	data    any
+	options requestOptions
 }
 
-func newRequest[T any](builder *requestBuilder[T], data any) Request[T] {
+func newRequest[T any](builder *requestBuilder[T], data any, options []RequestOption) Request[T] {
+	opts := requestOptions{timeout: builder.timeout}
+	for _, option := range append(builder.options, options...) {
+		option(&opts)
+	}
+	if opts.timeout <= 0 {
+		opts.timeout = nats.DefaultTimeout
+	}
 	return &request[T]{
-		builder:    builder,
-		data: data,
+		builder: builder,
+		data:    data,
+		options: opts,
 	}
 }
 
 func (r *request[T]) Nats() (*T, error) {
+	return r.NatsWithContext(context.Background())
+}
+
+func (r *request[T]) NatsWithContext(ctx context.Context) (*T, error) {
 	sendMsg := NewMessage(r.data, nil)
 	sendPayload, err := json.Marshal(sendMsg)
 	if err != nil {
 		return nil, err
 	}
 
-	msg, err := r.builder.natsClient.GetInstance().Conn.Request(r.builder.subject, sendPayload, r.builder.timeout)
-	if err != nil {
-		return nil, err
+	var cb breaker.Breaker
+	if r.options.breaker {
+		cb = r.builder.natsClient.GetInstance().Breaker(r.builder.subject)
 	}
 
-	var receiveMsg Message[*T]
-	err = json.Unmarshal(msg.Data, &receiveMsg)
+	for attempt := 1; ; attempt++ {
+		var data []byte
+		data, err = r.attempt(ctx, cb, sendPayload)
+		if err == nil {
+			return ParseMsg[T](data)
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt > r.options.retries || !isTransient(err) {
+			break
+		}
+		if !sleep(ctx, r.backoff(attempt)) {
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, requestError(r.builder.subject, err)
+}
+
+// a hedged request counts as one call for the breaker
+func (r *request[T]) attempt(ctx context.Context, cb breaker.Breaker, payload []byte) ([]byte, error) {
+	if cb == nil {
+		return r.hedged(ctx, payload)
+	}
+	done, err := cb.Allow()
 	if err != nil {
 		return nil, err
 	}
+	data, err := r.hedged(ctx, payload)
+	if ctx.Err() != nil {
+		// the caller went away, the attempt tells nothing about the service
+		done(context.Canceled)
+	} else {
+		done(err)
+	}
+	return data, err
+}
+
+func (r *request[T]) hedged(ctx context.Context, payload []byte) ([]byte, error) {
+	if r.options.hedgeDelay <= 0 {
+		return r.send(ctx, payload)
+	}
+
+	// the slower request is cancelled once one replies
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	if receiveMsg.Error != nil {
-		err = errors.New(*receiveMsg.Error)
+	type result struct {
+		data []byte
+		err  error
 	}
+	results := make(chan result, 2)
+	call := func() {
+		data, err := r.send(ctx, payload)
+		results <- result{data: data, err: err}
+	}
+
+	go call()
+	pending := 1
+	hedge := time.NewTimer(r.options.hedgeDelay)
+	defer hedge.Stop()
+
+	var first error
+	for {
+		select {
+		case <-hedge.C:
+			pending++
+			go call()
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				return res.data, nil
+			}
+			if first == nil {
+				first = res.err
+			}
+			// a request failing before the hedge is sent is not hedged
+			if pending == 0 {
+				return nil, first
+			}
+		}
+	}
+}
 
-	return receiveMsg.Data, err
+func (r *request[T]) send(ctx context.Context, payload []byte) ([]byte, error) {
+	attemptCtx, cancel := context.WithTimeout(ctx, r.options.timeout)
+	defer cancel()
+
+	data, err := r.builder.send(attemptCtx, r.builder.subject, payload)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return nil, nats.ErrTimeout
+	}
+	return data, err
+}
+
+// half of the delay is random, so that the requests failing together are not retried together
+func (r *request[T]) backoff(attempt int) time.Duration {
+	delay := r.options.backoffMin
+	for i := 1; i < attempt && delay < r.options.backoffMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, r.options.backoffMax)
+	return delay/2 + time.Duration(mrand.Int63n(int64(delay/2)+1))
+}
+
+// false when ctx is done
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// the replies with an error are not, the service is up
+func isTransient(err error) bool {
+	return errors.Is(err, nats.ErrNoResponders) || errors.Is(err, nats.ErrTimeout)
+}
+
+func requestError(subject string, err error) error {
+	switch {
+	case errors.Is(err, breaker.ErrOpen), errors.Is(err, nats.ErrNoResponders):
+		return network.NewApiError(http.StatusServiceUnavailable, "service unavailable", fmt.Errorf("%s: %w", subject, err))
+	case errors.Is(err, nats.ErrTimeout):
+		return network.NewApiError(http.StatusGatewayTimeout, "service timeout", fmt.Errorf("%s: %w", subject, err))
+	}
+	return err
 }
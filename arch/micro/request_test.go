@@ -0,0 +1,182 @@
+package micro
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/unusualcodeorg/goserve/arch/breaker"
+	"github.com/unusualcodeorg/goserve/arch/network"
+)
+
+type sendFunc func(ctx context.Context, call int32) ([]byte, error)
+
+func newTestBuilder(t *testing.T, send sendFunc, options ...RequestOption) (*requestBuilder[blogMsg], *atomic.Int32) {
+	client := &natsClient{
+		Timeout:       100 * time.Millisecond,
+		breakerConfig: breaker.Config{Failures: 2, OpenTimeout: time.Minute},
+	}
+	builder := NewRequestBuilder[blogMsg](client, "blogs.blog", options...).(*requestBuilder[blogMsg])
+	calls := &atomic.Int32{}
+	builder.send = func(ctx context.Context, subject string, data []byte) ([]byte, error) {
+		assert.Equal(t, "blogs.blog", subject)
+		return send(ctx, calls.Add(1))
+	}
+	return builder, calls
+}
+
+func reply(t *testing.T, title string) []byte {
+	data, err := json.Marshal(NewMessage(blogMsg{Title: title}, nil))
+	assert.NoError(t, err)
+	return data
+}
+
+func assertCode(t *testing.T, code int, err error) {
+	var apiErr network.ApiError
+	if assert.ErrorAs(t, err, &apiErr) {
+		assert.Equal(t, code, apiErr.GetCode())
+	}
+}
+
+func TestRequestRetry(t *testing.T) {
+	builder, calls := newTestBuilder(t, func(ctx context.Context, call int32) ([]byte, error) {
+		if call < 3 {
+			return nil, nats.ErrNoResponders
+		}
+		return reply(t, "a"), nil
+	})
+
+	_, err := builder.Request("id").Nats()
+	assertCode(t, http.StatusServiceUnavailable, err)
+	assert.ErrorIs(t, err, nats.ErrNoResponders)
+	assert.Equal(t, int32(1), calls.Load())
+
+	calls.Store(0)
+	blog, err := builder.Request("id", WithRetry(2, time.Millisecond, 5*time.Millisecond)).Nats()
+	assert.NoError(t, err)
+	assert.Equal(t, "a", blog.Title)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestRequestNoRetryOnReplyError(t *testing.T) {
+	builder, calls := newTestBuilder(t, func(ctx context.Context, call int32) ([]byte, error) {
+		data, _ := json.Marshal(NewAnyMessage(nil, network.NewNotFoundError("blog not found", nil)))
+		return data, nil
+	}, WithRetry(3, time.Millisecond, time.Millisecond))
+
+	_, err := builder.Request("id").Nats()
+	assertCode(t, http.StatusNotFound, err)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestRequestTimeout(t *testing.T) {
+	builder, _ := newTestBuilder(t, func(ctx context.Context, call int32) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	start := time.Now()
+	_, err := builder.Request("id", WithTimeout(20*time.Millisecond)).Nats()
+	assertCode(t, http.StatusGatewayTimeout, err)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestRequestContextCancelled(t *testing.T) {
+	builder, calls := newTestBuilder(t, func(ctx context.Context, call int32) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, WithRetry(3, time.Millisecond, time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := builder.Request("id").NatsWithContext(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestRequestHedge(t *testing.T) {
+	builder, calls := newTestBuilder(t, func(ctx context.Context, call int32) ([]byte, error) {
+		if call == 1 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return reply(t, "hedged"), nil
+	}, WithHedge(10*time.Millisecond))
+
+	start := time.Now()
+	blog, err := builder.Request("id").Nats()
+	assert.NoError(t, err)
+	assert.Equal(t, "hedged", blog.Title)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestRequestHedgeNotSentAfterFailure(t *testing.T) {
+	builder, calls := newTestBuilder(t, func(ctx context.Context, call int32) ([]byte, error) {
+		return nil, nats.ErrNoResponders
+	}, WithHedge(10*time.Millisecond))
+
+	_, err := builder.Request("id").Nats()
+	assertCode(t, http.StatusServiceUnavailable, err)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestRequestBreaker(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	builder, calls := newTestBuilder(t, func(ctx context.Context, call int32) ([]byte, error) {
+		if failing.Load() {
+			return nil, nats.ErrNoResponders
+		}
+		return reply(t, "a"), nil
+	}, WithBreaker())
+
+	for i := 0; i < 2; i++ {
+		_, err := builder.Request("id").Nats()
+		assert.ErrorIs(t, err, nats.ErrNoResponders)
+	}
+	assert.Equal(t, breaker.Open, builder.natsClient.GetInstance().Breaker("blogs.blog").State())
+
+	failing.Store(false)
+	_, err := builder.Request("id").Nats()
+	assertCode(t, http.StatusServiceUnavailable, err)
+	assert.ErrorIs(t, err, breaker.ErrOpen)
+	assert.Equal(t, int32(2), calls.Load())
+
+	// the breakers are per subject
+	assert.Equal(t, breaker.Closed, builder.natsClient.GetInstance().Breaker("blogs.author").State())
+}
+
+func TestRequestBreakerIgnoresCancelled(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	builder, _ := newTestBuilder(t, func(ctx context.Context, call int32) ([]byte, error) {
+		if failing.Load() {
+			return nil, nats.ErrNoResponders
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, WithBreaker())
+	cb := builder.natsClient.GetInstance().Breaker("blogs.blog")
+
+	_, err := builder.Request("id").Nats()
+	assert.ErrorIs(t, err, nats.ErrNoResponders)
+
+	// cancelled by the http client
+	failing.Store(false)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = builder.Request("id").NatsWithContext(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	failing.Store(true)
+	_, err = builder.Request("id").Nats()
+	assert.ErrorIs(t, err, nats.ErrNoResponders)
+	assert.Equal(t, breaker.Open, cb.State(), "the cancelled request did not reset the failures")
+}
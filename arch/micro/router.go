@@ -51,6 +51,7 @@ func (r *router) LoadControllers(controllers []Controller) {
 
 		ng := natsClient.Service.AddGroup(baseSub)
 		c.MountNats(ng)
+		c.MountEvents(NewEventGroup(natsClient.Events, DurableName(baseSub)))
 	}
 }
 
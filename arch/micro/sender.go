@@ -1,12 +1,5 @@
 package micro
 
-import (
-	"errors"
-	"fmt"
-
-	"github.com/unusualcodeorg/goserve/arch/network"
-)
-
 type sender struct{}
 
 func NewMessageSender() MessageSender {
@@ -27,11 +20,7 @@ func (s *send) Message(data any) {
 	s.natsRequest.RespondJSON(NewAnyMessage(data, nil))
 }
 
+// the code of an ApiError is kept, see MessageError
 func (s *send) Error(err error) {
-	if apiError, ok := err.(network.ApiError); ok {
-		msg := fmt.Sprintf("%d:%s", apiError.GetCode(), apiError.GetMessage())
-		s.natsRequest.RespondJSON(NewAnyMessage(nil, errors.New(msg)))
-		return
-	}
 	s.natsRequest.RespondJSON(NewAnyMessage(nil, err))
 }
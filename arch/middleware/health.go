@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unusualcodeorg/goserve/arch/network"
+)
+
+const (
+	HealthUp       = "up"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+type HealthCheck struct {
+	Name string
+	// a failing optional dependency degrades the service instead of taking it down e.g. the cache
+	Optional bool
+	Check    func(ctx context.Context) error
+}
+
+type HealthStatus struct {
+	Status string                  `json:"status"`
+	Checks map[string]HealthResult `json:"checks"`
+}
+
+type HealthResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type health struct {
+	network.BaseMiddleware
+	path    string
+	checks  []HealthCheck
+	timeout time.Duration
+}
+
+/*
+ * Example -> GET /health responds 200 when up or degraded and 503 when a required check fails
+ * attach it before the api key protection, so that the probes of the load balancer need no key
+ */
+func NewHealth(path string, checks ...HealthCheck) network.RootMiddleware {
+	return &health{
+		BaseMiddleware: network.NewBaseMiddleware(),
+		path:           path,
+		checks:         checks,
+		timeout:        2 * time.Second,
+	}
+}
+
+func (m *health) Attach(engine *gin.Engine) {
+	engine.GET(m.path, m.Handler)
+}
+
+func (m *health) Handler(ctx *gin.Context) {
+	status := m.check(ctx.Request.Context())
+	code := http.StatusOK
+	if status.Status == HealthDown {
+		code = http.StatusServiceUnavailable
+	}
+	ctx.AbortWithStatusJSON(code, status)
+}
+
+// the checks run concurrently, each within the timeout
+func (m *health) check(ctx context.Context) *HealthStatus {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	results := make([]HealthResult, len(m.checks))
+	var wg sync.WaitGroup
+	for i, c := range m.checks {
+		wg.Add(1)
+		go func(i int, c HealthCheck) {
+			defer wg.Done()
+			results[i] = HealthResult{Status: HealthUp}
+			if err := c.Check(ctx); err != nil {
+				results[i] = HealthResult{Status: HealthDown, Error: err.Error()}
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	status := &HealthStatus{Status: HealthUp, Checks: make(map[string]HealthResult, len(m.checks))}
+	for i, c := range m.checks {
+		status.Checks[c.Name] = results[i]
+		if results[i].Status == HealthUp {
+			continue
+		}
+		if !c.Optional {
+			status.Status = HealthDown
+		} else if status.Status == HealthUp {
+			status.Status = HealthDegraded
+		}
+	}
+	return status
+}
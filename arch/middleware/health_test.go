@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthMiddleware(t *testing.T) {
+	up := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+
+	health := func(checks ...HealthCheck) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		engine := gin.New()
+		NewHealth("/health", checks...).Attach(engine)
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/health", nil)
+		engine.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := health(HealthCheck{Name: "mongo", Check: up}, HealthCheck{Name: "redis", Optional: true, Check: up})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"status":"up"`)
+
+	rr = health(HealthCheck{Name: "mongo", Check: up}, HealthCheck{Name: "redis", Optional: true, Check: down})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"status":"degraded"`)
+	assert.Contains(t, rr.Body.String(), `"redis":{"status":"down","error":"connection refused"}`)
+
+	rr = health(HealthCheck{Name: "mongo", Check: down}, HealthCheck{Name: "redis", Optional: true, Check: up})
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"status":"down"`)
+}
@@ -11,28 +11,40 @@ type QueryBuilder[T any] interface {
 	GetCollection() *mongo.Collection
 	SingleQuery() Query[T]
 	Query(context context.Context) Query[T]
+	Watch(context context.Context, config WatchConfig, handler ChangeHandler[T]) error
 }
 
 type queryBuilder[T any] struct {
-	collection *mongo.Collection
+	collection collection
 	timeout    time.Duration
+	keyring    Keyring
 }
 
+// on the memory database its operations fail with mongo.ErrClientDisconnected, see NewMemoryDatabase
 func (c *queryBuilder[T]) GetCollection() *mongo.Collection {
-	return c.collection
+	return driverOf(c.collection)
 }
 
 func (c *queryBuilder[T]) SingleQuery() Query[T] {
-	return newSingleQuery[T](c.collection, c.timeout)
+	return newSingleQuery[T](c.collection, c.timeout, c.keyring)
 }
 
 func (c *queryBuilder[T]) Query(context context.Context) Query[T] {
-	return newQuery[T](context, c.collection)
+	return newQuery[T](context, c.collection, c.keyring)
+}
+
+/*
+ * Example -> builder.Watch(ctx, WatchConfig{Name: "blogs", Operations: []OperationType{OperationDelete}}, handler)
+ * blocks until the context is done, needs the database to run as a replica set
+ */
+func (c *queryBuilder[T]) Watch(context context.Context, config WatchConfig, handler ChangeHandler[T]) error {
+	return newWatcher[T](c.collection, c.keyring, config, handler).run(context)
 }
 
 func NewQueryBuilder[T any](db Database, collectionName string) QueryBuilder[T] {
 	return &queryBuilder[T]{
-		collection: db.GetInstance().Collection(collectionName),
+		collection: db.GetInstance().collection(collectionName),
 		timeout:    db.GetInstance().config.Timeout,
+		keyring:    db.GetInstance().config.Keyring,
 	}
 }
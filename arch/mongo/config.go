@@ -0,0 +1,132 @@
+package mongo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func (c *DbConfig) uri() string {
+	if c.URI != "" {
+		return c.URI
+	}
+
+	hosts := strings.Split(c.Host, ",")
+	for i, h := range hosts {
+		h = strings.TrimSpace(h)
+		if !strings.Contains(h, ":") && c.Port > 0 {
+			h = fmt.Sprintf("%s:%d", h, c.Port)
+		}
+		hosts[i] = h
+	}
+
+	credentials := ""
+	if c.User != "" {
+		credentials = url.UserPassword(c.User, c.Pwd).String() + "@"
+	}
+
+	return fmt.Sprintf("mongodb://%s%s/%s", credentials, strings.Join(hosts, ","), c.Name)
+}
+
+// the structured options override the same options given in the URI
+func (c *DbConfig) clientOptions() (*options.ClientOptions, error) {
+	opts := options.Client().ApplyURI(c.uri())
+
+	if c.AuthSource != "" {
+		if opts.Auth == nil {
+			return nil, errors.New("auth source is set without credentials")
+		}
+		opts.Auth.AuthSource = c.AuthSource
+	}
+
+	if c.ReplicaSet != "" {
+		opts.SetReplicaSet(c.ReplicaSet)
+	}
+
+	if c.TLS || c.TLSCAFile != "" || c.TLSCertKeyFile != "" {
+		tlsConfig, err := c.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	if c.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(c.ReadPreference)
+		if err != nil {
+			return nil, err
+		}
+		pref, err := readpref.New(mode)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetReadPreference(pref)
+	}
+
+	if c.RetryWrites != nil {
+		opts.SetRetryWrites(*c.RetryWrites)
+	}
+
+	if c.RetryReads != nil {
+		opts.SetRetryReads(*c.RetryReads)
+	}
+
+	if c.MaxPoolSize > 0 && c.MinPoolSize > c.MaxPoolSize {
+		return nil, fmt.Errorf("min pool size %d is greater than max pool size %d", c.MinPoolSize, c.MaxPoolSize)
+	}
+	if c.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(uint64(c.MaxPoolSize))
+	}
+	if c.MinPoolSize > 0 {
+		opts.SetMinPoolSize(uint64(c.MinPoolSize))
+	}
+
+	return opts, opts.Validate()
+}
+
+func (c *DbConfig) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: c.TLSInsecure}
+
+	if c.TLSCAFile != "" {
+		ca, err := os.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading tls ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("tls ca file has no valid certificates")
+		}
+		config.RootCAs = pool
+	}
+
+	if c.TLSCertKeyFile != "" {
+		// the client certificate and its private key in a single pem file as with tlsCertificateKeyFile
+		cert, err := tls.LoadX509KeyPair(c.TLSCertKeyFile, c.TLSCertKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading tls certificate key file: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// of the connect retries, exponential for the attempt starting at 0 and jittered within the upper half of the delay
+func backoff(attempt int, base time.Duration, max time.Duration) time.Duration {
+	delay := max
+	if attempt < 32 {
+		if d := base << attempt; d > 0 && d < max {
+			delay = d
+		}
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,476 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+ * Example -> Email string `bson:"email" encrypt:"blind"`
+ * encrypt:"true" stores the string field encrypted with the active key of the Keyring
+ * encrypt:"blind" also stores a deterministic blind index in <field>Hash e.g. emailHash
+ * the equality filters on the field are rewritten to the blind index, declare the indexes on it
+ * the other filters, sorts and aggregation stages can't read the encrypted values
+ */
+const (
+	encryptTag        = "encrypt"
+	encryptBlind      = "blind"
+	blindIndexPostfix = "Hash"
+)
+
+type encryptedField struct {
+	name  string
+	blind string
+	index []int
+	ptr   bool
+}
+
+var encryptedFieldsCache sync.Map
+
+func encryptedFieldsOf(t reflect.Type) []*encryptedField {
+	t = indirectType(t)
+	if cached, ok := encryptedFieldsCache.Load(t); ok {
+		return cached.([]*encryptedField)
+	}
+
+	var fields []*encryptedField
+	if t.Kind() == reflect.Struct {
+		collectEncryptedFields(t, nil, &fields)
+	}
+
+	cached, _ := encryptedFieldsCache.LoadOrStore(t, fields)
+	return cached.([]*encryptedField)
+}
+
+// only the top level and the inlined fields are encrypted, the tags are checked once per type
+func collectEncryptedFields(t reflect.Type, index []int, fields *[]*encryptedField) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, inline, skip := bsonFieldName(f)
+		if skip {
+			continue
+		}
+
+		fieldIndex := append(append([]int{}, index...), i)
+		if inline {
+			if f.Type.Kind() == reflect.Struct {
+				collectEncryptedFields(f.Type, fieldIndex, fields)
+			}
+			continue
+		}
+
+		if !isEncrypted(f) {
+			continue
+		}
+		tag := f.Tag.Get(encryptTag)
+
+		ptr := f.Type.Kind() == reflect.Pointer
+		if indirectType(f.Type).Kind() != reflect.String || (ptr && f.Type.Elem().Kind() != reflect.String) {
+			panic(fmt.Sprintf("encrypted field %s.%s must be a string or *string", t, f.Name))
+		}
+
+		field := &encryptedField{name: name, index: fieldIndex, ptr: ptr}
+		switch tag {
+		case "true":
+		case encryptBlind:
+			field.blind = blindIndexName(name)
+		default:
+			panic(fmt.Sprintf("invalid encrypt tag %q of %s.%s", tag, t, f.Name))
+		}
+		*fields = append(*fields, field)
+	}
+}
+
+func isEncrypted(f reflect.StructField) bool {
+	tag := f.Tag.Get(encryptTag)
+	return tag != "" && tag != "false"
+}
+
+func blindIndexName(field string) string {
+	return field + blindIndexPostfix
+}
+
+// the blind index of an encrypted field, empty if the field has none
+func blindIndexOf(f reflect.StructField, name string) string {
+	if f.Tag.Get(encryptTag) == encryptBlind {
+		return blindIndexName(name)
+	}
+	return ""
+}
+
+type fieldCipher struct {
+	keyring Keyring
+	fields  []*encryptedField
+	byName  map[string]*encryptedField
+}
+
+// nil when the type has no encrypted fields
+func newFieldCipher(t reflect.Type, keyring Keyring) *fieldCipher {
+	fields := encryptedFieldsOf(t)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	c := &fieldCipher{
+		keyring: keyring,
+		fields:  fields,
+		byName:  make(map[string]*encryptedField, len(fields)),
+	}
+	for _, f := range fields {
+		c.byName[f.name] = f
+	}
+	return c
+}
+
+// doc is a pointer to the struct, the values written in plaintext before the encryption are kept
+func (c *fieldCipher) decrypt(doc any) error {
+	if c.keyring == nil {
+		return ErrNoKeyring
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(doc))
+	for _, f := range c.fields {
+		fv, err := v.FieldByIndexErr(f.index)
+		if err != nil {
+			continue
+		}
+		if f.ptr {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+
+		plaintext, err := c.keyring.Decrypt(f.name, fv.String())
+		if err != nil {
+			return err
+		}
+		fv.SetString(plaintext)
+	}
+	return nil
+}
+
+// encodes the document with the encrypted values so that the caller's copy keeps the plaintext
+func (c *fieldCipher) encryptDocument(doc any) (bson.D, error) {
+	if c.keyring == nil {
+		return nil, ErrNoKeyring
+	}
+
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var d bson.D
+	if err := bson.Unmarshal(raw, &d); err != nil {
+		return nil, err
+	}
+
+	var blinds bson.D
+	for i, e := range d {
+		f, ok := c.byName[e.Key]
+		if !ok {
+			continue
+		}
+		plaintext, ok := e.Value.(string)
+		if !ok {
+			continue
+		}
+		if d[i].Value, err = c.keyring.Encrypt(f.name, plaintext); err != nil {
+			return nil, err
+		}
+		if f.blind != "" {
+			blinds = append(blinds, bson.E{Key: f.blind, Value: c.keyring.BlindIndex(f.name, plaintext)})
+		}
+	}
+
+	return append(d, blinds...), nil
+}
+
+func (c *fieldCipher) filter(filter bson.M) (bson.M, error) {
+	if c.keyring == nil {
+		return nil, ErrNoKeyring
+	}
+	if filter == nil {
+		return nil, nil
+	}
+
+	result := make(bson.M, len(filter))
+	for key, value := range filter {
+		switch key {
+		case "$and", "$or", "$nor":
+			list, err := c.filters(key, value)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = list
+			continue
+		}
+
+		f, ok := c.byName[key]
+		if !ok {
+			result[key] = value
+			continue
+		}
+		if f.blind == "" {
+			return nil, fmt.Errorf("%w: %s has no blind index to be queried", ErrEncryptedField, key)
+		}
+
+		cond, err := c.blindCondition(f, value)
+		if err != nil {
+			return nil, err
+		}
+		result[f.blind] = cond
+	}
+	return result, nil
+}
+
+func (c *fieldCipher) filters(op string, value any) (bson.A, error) {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("%s needs an array", op)
+	}
+
+	list := make(bson.A, v.Len())
+	for i := range list {
+		sub, err := toFilter(v.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		if list[i], err = c.filter(sub); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+func (c *fieldCipher) blindCondition(f *encryptedField, value any) (any, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return c.keyring.BlindIndex(f.name, v), nil
+	case *string:
+		if v == nil {
+			return nil, nil
+		}
+		return c.keyring.BlindIndex(f.name, *v), nil
+	case bson.M:
+		ops := make(bson.M, len(v))
+		for op, arg := range v {
+			switch op {
+			case "$eq", "$ne":
+				hashed, err := c.blindCondition(f, arg)
+				if err != nil {
+					return nil, err
+				}
+				ops[op] = hashed
+			case "$in", "$nin":
+				list := reflect.ValueOf(arg)
+				if list.Kind() != reflect.Slice {
+					return nil, fmt.Errorf("%s needs an array", op)
+				}
+				hashed := make(bson.A, list.Len())
+				for i := range hashed {
+					h, err := c.blindCondition(f, list.Index(i).Interface())
+					if err != nil {
+						return nil, err
+					}
+					hashed[i] = h
+				}
+				ops[op] = hashed
+			case "$exists":
+				ops[op] = arg
+			default:
+				return nil, fmt.Errorf("%w: %s supports only the equality filters, got %s", ErrEncryptedField, f.name, op)
+			}
+		}
+		return ops, nil
+	}
+	return nil, fmt.Errorf("%w: %s needs a string value, got %T", ErrEncryptedField, f.name, value)
+}
+
+// the pipeline updates are sent as they are, they can't compute the encrypted values
+func (c *fieldCipher) update(update any) (any, error) {
+	if c.keyring == nil {
+		return nil, ErrNoKeyring
+	}
+	u, ok := update.(bson.M)
+	if !ok {
+		return update, nil
+	}
+
+	result := make(bson.M, len(u))
+	for op, arg := range u {
+		fields, isMap := arg.(bson.M)
+		switch {
+		case (op == "$set" || op == "$setOnInsert") && !isMap:
+			// e.g. {"$setOnInsert": role}
+			doc, err := c.encryptDocument(arg)
+			if err != nil {
+				return nil, err
+			}
+			result[op] = doc
+		case op == "$set" || op == "$setOnInsert":
+			set := make(bson.M, len(fields))
+			for key, value := range fields {
+				set[key] = value
+				f, ok := c.byName[key]
+				if !ok || value == nil {
+					continue
+				}
+				plaintext, ok := value.(string)
+				if p, isPtr := value.(*string); isPtr && p != nil {
+					plaintext, ok = *p, true
+				}
+				if !ok {
+					return nil, fmt.Errorf("%w: %s needs a string value, got %T", ErrEncryptedField, key, value)
+				}
+				encrypted, err := c.keyring.Encrypt(f.name, plaintext)
+				if err != nil {
+					return nil, err
+				}
+				set[key] = encrypted
+				if f.blind != "" {
+					set[f.blind] = c.keyring.BlindIndex(f.name, plaintext)
+				}
+			}
+			result[op] = set
+		case op == "$unset" && isMap:
+			unset := make(bson.M, len(fields))
+			for key, value := range fields {
+				unset[key] = value
+				if f, ok := c.byName[key]; ok && f.blind != "" {
+					unset[f.blind] = value
+				}
+			}
+			result[op] = unset
+		default:
+			for key := range fields {
+				if _, ok := c.byName[key]; ok {
+					return nil, fmt.Errorf("%w: %s can't be updated with %s", ErrEncryptedField, key, op)
+				}
+			}
+			result[op] = arg
+		}
+	}
+	return result, nil
+}
+
+func (c *fieldCipher) check(field string) error {
+	if _, ok := c.byName[field]; ok {
+		return fmt.Errorf("%w: %s can't be read by the server", ErrEncryptedField, field)
+	}
+	return nil
+}
+
+// results is a pointer to a slice of R or *R e.g. from cursor.All
+func decryptAll(keyring Keyring, results any) error {
+	slice := reflect.Indirect(reflect.ValueOf(results))
+	if slice.Kind() != reflect.Slice {
+		return nil
+	}
+
+	c := newFieldCipher(slice.Type().Elem(), keyring)
+	if c == nil {
+		return nil
+	}
+
+	for i := 0; i < slice.Len(); i++ {
+		elem := slice.Index(i)
+		if elem.Kind() == reflect.Pointer {
+			if elem.IsNil() {
+				continue
+			}
+		} else {
+			elem = elem.Addr()
+		}
+		if err := c.decrypt(elem.Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * Example -> Reencrypt(ctx, db, &model.User{}) rewrites the fields written with an old key or in plaintext
+ * with the active key and fills their blind indexes, run it after rotating the key or encrypting a field
+ * the documents changed in the meantime are skipped and picked by the next run
+ */
+func Reencrypt(ctx context.Context, db Database, doc Indexed) (int64, error) {
+	keyring := db.GetInstance().config.Keyring
+	c := newFieldCipher(reflect.TypeOf(doc), keyring)
+	if c == nil {
+		return 0, nil
+	}
+	if keyring == nil {
+		return 0, ErrNoKeyring
+	}
+
+	active := bson.M{"$regex": "^" + regexp.QuoteMeta(encryptedPrefix+keyring.ActiveKey()+":")}
+	or := bson.A{}
+	projection := bson.M{}
+	for _, f := range c.fields {
+		or = append(or, bson.M{f.name: bson.M{"$ne": nil, "$not": active}})
+		projection[f.name] = 1
+	}
+
+	collection := db.GetInstance().collection(doc.GetCollectionName())
+	opts := options.Find().SetProjection(projection).SetBatchSize(DefaultBatchSize)
+	cursor, err := collection.Find(ctx, bson.M{"$or": or}, opts)
+	if err != nil {
+		return 0, fmt.Errorf("error finding %s: %w", doc.GetCollectionName(), err)
+	}
+	defer cursor.Close(context.Background())
+
+	var count int64
+	for cursor.Next(ctx) {
+		var current bson.M
+		if err := cursor.Decode(&current); err != nil {
+			return count, fmt.Errorf("error decoding %s: %w", doc.GetCollectionName(), err)
+		}
+
+		filter := bson.M{"_id": current["_id"]}
+		set := bson.M{}
+		for _, f := range c.fields {
+			value, ok := current[f.name].(string)
+			if !ok || keyring.KeyOf(value) == keyring.ActiveKey() {
+				continue
+			}
+			plaintext, err := keyring.Decrypt(f.name, value)
+			if err != nil {
+				return count, err
+			}
+			if set[f.name], err = keyring.Encrypt(f.name, plaintext); err != nil {
+				return count, err
+			}
+			if f.blind != "" {
+				set[f.blind] = keyring.BlindIndex(f.name, plaintext)
+			}
+			filter[f.name] = value
+		}
+		if len(set) == 0 {
+			continue
+		}
+
+		result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": set})
+		if err != nil {
+			return count, fmt.Errorf("error updating %s: %w", doc.GetCollectionName(), err)
+		}
+		count += result.ModifiedCount
+	}
+
+	if err := cursor.Err(); err != nil {
+		return count, err
+	}
+	return count, nil
+}
@@ -0,0 +1,190 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongod "go.mongodb.org/mongo-driver/mongo"
+)
+
+type encryptedDoc struct {
+	ID    primitive.ObjectID `bson:"_id,omitempty"`
+	Email string             `bson:"email" validate:"required,email" encrypt:"blind"`
+	Note  *string            `bson:"note,omitempty" encrypt:"true"`
+	Name  string             `bson:"name"`
+}
+
+func (*encryptedDoc) GetCollectionName() string {
+	return "secrets"
+}
+
+func (*encryptedDoc) GetIndexes() []mongod.IndexModel {
+	return []mongod.IndexModel{{Keys: bson.D{{Key: "emailHash", Value: 1}}}}
+}
+
+var testMasterKey = []byte("0123456789abcdef0123456789abcdef")
+
+func newTestKeyring(t *testing.T, active string, ids ...string) Keyring {
+	dataKeys := map[string]string{}
+	for _, id := range ids {
+		key, err := WrapKey(testMasterKey, id, []byte(id + "-0123456789abcdef0123456789abcdef")[:encryptionKeyLen])
+		assert.NoError(t, err)
+		dataKeys[id] = key
+	}
+	blind, err := WrapKey(testMasterKey, blindIndexKeyID, []byte("blind-index-key-0123456789abcdef"))
+	assert.NoError(t, err)
+
+	keyring, err := NewKeyring(KeyringConfig{
+		MasterKey:     testMasterKey,
+		DataKeys:      dataKeys,
+		ActiveKey:     active,
+		BlindIndexKey: blind,
+	})
+	assert.NoError(t, err)
+	return keyring
+}
+
+func TestKeyring(t *testing.T) {
+	v1 := newTestKeyring(t, "v1", "v1")
+	v2 := newTestKeyring(t, "v2", "v1", "v2")
+
+	encrypted, err := v1.Encrypt("email", "a@b.com")
+	assert.NoError(t, err)
+	assert.NotContains(t, encrypted, "a@b.com")
+	assert.Equal(t, "v1", v1.KeyOf(encrypted))
+
+	again, _ := v1.Encrypt("email", "a@b.com")
+	assert.NotEqual(t, encrypted, again)
+
+	plaintext, err := v2.Decrypt("email", encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, "a@b.com", plaintext)
+
+	_, err = v2.Decrypt("name", encrypted)
+	assert.ErrorContains(t, err, "error decrypting name")
+
+	plaintext, err = v1.Decrypt("email", "plain@b.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "plain@b.com", plaintext)
+	assert.Equal(t, "", v1.KeyOf("plain@b.com"))
+
+	newer, _ := v2.Encrypt("email", "a@b.com")
+	_, err = v1.Decrypt("email", newer)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	assert.Equal(t, v1.BlindIndex("email", "a@b.com"), v2.BlindIndex("email", "a@b.com"))
+	assert.NotEqual(t, v1.BlindIndex("email", "a@b.com"), v1.BlindIndex("name", "a@b.com"))
+
+	_, err = NewKeyring(KeyringConfig{MasterKey: testMasterKey, DataKeys: map[string]string{}, ActiveKey: "v1"})
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	other, _ := GenerateDataKey([]byte("fedcba9876543210fedcba9876543210"), "v1")
+	_, err = NewKeyring(KeyringConfig{MasterKey: testMasterKey, DataKeys: map[string]string{"v1": other}, ActiveKey: "v1"})
+	assert.ErrorIs(t, err, ErrInvalidKeyValue)
+}
+
+func TestEncryptedQuery(t *testing.T) {
+	db := NewMemoryDatabase().GetInstance()
+	db.config.Keyring = newTestKeyring(t, "v1", "v1")
+	builder := NewQueryBuilder[encryptedDoc](db, "secrets")
+
+	note := "private"
+	doc := &encryptedDoc{Email: "a@b.com", Note: &note, Name: "a"}
+	_, err := builder.SingleQuery().InsertOne(doc)
+	assert.NoError(t, err)
+	assert.Equal(t, "a@b.com", doc.Email)
+
+	var raw bson.M
+	err = db.collection("secrets").FindOne(context.Background(), bson.M{}).Decode(&raw)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", db.config.Keyring.KeyOf(raw["email"].(string)))
+	assert.Equal(t, "v1", db.config.Keyring.KeyOf(raw["note"].(string)))
+	assert.Equal(t, db.config.Keyring.BlindIndex("email", "a@b.com"), raw["emailHash"])
+	assert.Equal(t, "a", raw["name"])
+
+	found, err := builder.SingleQuery().FindOne(NewFilter[encryptedDoc]().Eq("email", "a@b.com").MustBuild(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "a@b.com", found.Email)
+	assert.Equal(t, "private", *found.Note)
+
+	count, err := builder.SingleQuery().CountDocuments(bson.M{"email": bson.M{"$in": []string{"x@b.com", "a@b.com"}}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	_, err = builder.SingleQuery().FindOne(bson.M{"note": "private"}, nil)
+	assert.ErrorIs(t, err, ErrEncryptedField)
+
+	_, err = builder.SingleQuery().FindAll(bson.M{"email": bson.M{"$gt": "a"}}, nil)
+	assert.ErrorIs(t, err, ErrEncryptedField)
+
+	updated, err := builder.SingleQuery().FindOneAndUpdate(bson.M{"email": "a@b.com"}, bson.M{"$set": bson.M{"email": "c@d.com"}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "c@d.com", updated.Email)
+
+	_, err = builder.SingleQuery().FindOne(bson.M{"email": "a@b.com"}, nil)
+	assert.ErrorIs(t, err, mongod.ErrNoDocuments)
+
+	_, err = Distinct[string](builder.SingleQuery(), "email", nil)
+	assert.ErrorIs(t, err, ErrEncryptedField)
+
+	results, err := Aggregate[encryptedDoc](builder.SingleQuery(), NewPipeline().Match(bson.M{"name": "a"}), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "c@d.com", results[0].Email)
+}
+
+func TestReencrypt(t *testing.T) {
+	db := NewMemoryDatabase().GetInstance()
+	db.config.Keyring = newTestKeyring(t, "v1", "v1")
+	builder := NewQueryBuilder[encryptedDoc](db, "secrets")
+
+	_, err := builder.SingleQuery().InsertOne(&encryptedDoc{Email: "a@b.com", Name: "a"})
+	assert.NoError(t, err)
+
+	// written before the field was encrypted
+	_, err = db.collection("secrets").InsertOne(context.Background(), bson.M{"email": "plain@b.com", "name": "p"})
+	assert.NoError(t, err)
+
+	db.config.Keyring = newTestKeyring(t, "v2", "v1", "v2")
+	count, err := Reencrypt(context.Background(), db, &encryptedDoc{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	count, err = Reencrypt(context.Background(), db, &encryptedDoc{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+
+	builder = NewQueryBuilder[encryptedDoc](db, "secrets")
+	for _, email := range []string{"a@b.com", "plain@b.com"} {
+		var raw bson.M
+		err = db.collection("secrets").FindOne(context.Background(), bson.M{"emailHash": db.config.Keyring.BlindIndex("email", email)}).Decode(&raw)
+		assert.NoError(t, err)
+		assert.Equal(t, "v2", db.config.Keyring.KeyOf(raw["email"].(string)))
+
+		found, err := builder.SingleQuery().FindOne(bson.M{"email": email}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, email, found.Email)
+	}
+}
+
+func TestEncryptedFields(t *testing.T) {
+	assert.NoError(t, CheckIndexes[encryptedDoc]((&encryptedDoc{}).GetIndexes()))
+
+	props := JSONSchema[encryptedDoc]()["properties"].(bson.M)
+	assert.Equal(t, bson.M{"bsonType": "string"}, props["email"])
+	assert.Equal(t, bson.M{"bsonType": "string"}, props["emailHash"])
+	assert.Equal(t, bson.M{"bsonType": bson.A{"string", "null"}}, props["note"])
+	assert.Equal(t, []string{"email", "emailHash"}, JSONSchema[encryptedDoc]()["required"])
+
+	db := NewMemoryDatabase().GetInstance()
+	db.config.Keyring = nil
+	_, err := NewQueryBuilder[encryptedDoc](db, "secrets").SingleQuery().FindOne(bson.M{}, nil)
+	assert.ErrorIs(t, err, ErrNoKeyring)
+
+	type invalid struct {
+		Age int `bson:"age" encrypt:"true"`
+	}
+	assert.Panics(t, func() { NewQueryBuilder[invalid](db, "invalid").SingleQuery() })
+}
@@ -0,0 +1,188 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const collScanStage = "COLLSCAN"
+
+/*
+ * Example -> ExplainQuery{Name: "blog by slug", Collection: "blogs", Filter: bson.M{"slug": "", "status": true}}
+ * the filter values only need the right types, the plan is chosen from the shape of the query
+ */
+type ExplainQuery struct {
+	Name       string
+	Collection string
+	Filter     bson.M
+	Sort       bson.D
+	Pipeline   Pipeline
+}
+
+type ExplainResult struct {
+	Query    ExplainQuery
+	Stages   []string
+	Indexes  []string
+	CollScan bool
+}
+
+func (r *ExplainResult) String() string {
+	state := "ok"
+	if r.CollScan {
+		state = collScanStage
+	}
+	plan := strings.Join(r.Stages, " > ")
+	if len(r.Indexes) > 0 {
+		plan += " [" + strings.Join(r.Indexes, ", ") + "]"
+	}
+	return fmt.Sprintf("%-8s  %-10s  %-30s  %s", state, r.Query.Collection, r.Query.Name, plan)
+}
+
+// runs explain with the queryPlanner verbosity, the query itself is not executed
+func Explain(ctx context.Context, db Database, q ExplainQuery) (*ExplainResult, error) {
+	instance := db.GetInstance()
+	if instance.memory != nil {
+		return nil, fmt.Errorf("explain is %w", ErrMemoryUnsupported)
+	}
+
+	var cmd bson.D
+	if q.Pipeline != nil {
+		cmd = bson.D{
+			{Key: "aggregate", Value: q.Collection},
+			{Key: "pipeline", Value: q.Pipeline.Stages()},
+			{Key: "cursor", Value: bson.M{}},
+		}
+	} else {
+		filter := q.Filter
+		if filter == nil {
+			filter = bson.M{}
+		}
+		cmd = bson.D{{Key: "find", Value: q.Collection}, {Key: "filter", Value: filter}}
+		if len(q.Sort) > 0 {
+			cmd = append(cmd, bson.E{Key: "sort", Value: q.Sort})
+		}
+	}
+
+	var explained bson.M
+	err := instance.RunCommand(ctx, bson.D{
+		{Key: "explain", Value: cmd},
+		{Key: "verbosity", Value: "queryPlanner"},
+	}).Decode(&explained)
+	if err != nil {
+		return nil, fmt.Errorf("explain %s: %w", q.Name, err)
+	}
+
+	stages, indexes := planSummary(explained)
+	if len(stages) == 0 {
+		return nil, errors.New("explain " + q.Name + ": no winning plan found")
+	}
+
+	result := &ExplainResult{Query: q, Stages: stages, Indexes: indexes}
+	for _, s := range stages {
+		if s == collScanStage {
+			result.CollScan = true
+		}
+	}
+	return result, nil
+}
+
+// the stages and index names of the winning plans, found at any depth e.g. inside the $cursor of an aggregate
+func planSummary(explained any) ([]string, []string) {
+	var stages, indexes []string
+
+	var collect func(v any)
+	collect = func(v any) {
+		switch t := v.(type) {
+		case bson.M:
+			if s, ok := t["stage"].(string); ok {
+				stages = append(stages, s)
+			}
+			if i, ok := t["indexName"].(string); ok {
+				indexes = append(indexes, i)
+			}
+			for _, k := range sortedKeys(t) {
+				collect(t[k])
+			}
+		case bson.A:
+			for _, e := range t {
+				collect(e)
+			}
+		}
+	}
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch t := v.(type) {
+		case bson.M:
+			for _, k := range sortedKeys(t) {
+				switch k {
+				case "winningPlan":
+					collect(t[k])
+				case "rejectedPlans":
+				default:
+					walk(t[k])
+				}
+			}
+		case bson.A:
+			for _, e := range t {
+				walk(e)
+			}
+		}
+	}
+
+	walk(explained)
+	return stages, indexes
+}
+
+// the filter with its values redacted e.g. {"status":?,"tags":{"$in":?}}
+func filterShape(filter any) string {
+	if filter == nil {
+		return "{}"
+	}
+	v, err := canonical(filter)
+	if err != nil {
+		return fmt.Sprintf("<%T>", filter)
+	}
+	var b strings.Builder
+	writeShape(&b, v)
+	return b.String()
+}
+
+func writeShape(b *strings.Builder, v any) {
+	switch t := v.(type) {
+	case bson.M:
+		b.WriteString("{")
+		for i, k := range sortedKeys(t) {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(strconv.Quote(k) + ":")
+			writeShape(b, t[k])
+		}
+		b.WriteString("}")
+	case bson.A:
+		if len(t) == 0 {
+			b.WriteString("[]")
+			return
+		}
+		if _, ok := t[0].(bson.M); !ok {
+			b.WriteString("?")
+			return
+		}
+		b.WriteString("[")
+		for i, e := range t {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			writeShape(b, e)
+		}
+		b.WriteString("]")
+	default:
+		b.WriteString("?")
+	}
+}
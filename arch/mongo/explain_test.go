@@ -0,0 +1,82 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongod "go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestFilterShape(t *testing.T) {
+	filter := bson.M{
+		"_id":    primitive.NewObjectID(),
+		"status": true,
+		"tags":   bson.M{"$in": []string{"go", "mongo"}},
+		"$or":    bson.A{bson.M{"title": "secret"}, bson.M{"score": bson.M{"$gt": 3}}},
+	}
+	assert.Equal(t, `{"$or":[{"title":?},{"score":{"$gt":?}}],"_id":?,"status":?,"tags":{"$in":?}}`, filterShape(filter))
+	assert.Equal(t, "{}", filterShape(nil))
+
+	pipeline := NewPipeline().Match(bson.M{"author": "x"}).Limit(5).Stages()
+	assert.Equal(t, `[{"$match":{"author":?}},{"$limit":?}]`, filterShape(pipeline))
+}
+
+func TestSlowQueryMessage(t *testing.T) {
+	msg := slowQueryMessage("blogs", "find", bson.M{"slug": "go"}, 1234567*time.Microsecond)
+	assert.Equal(t, `slow query: blogs.find {"slug":?} took 1.235s`, msg)
+
+	msg = slowQueryMessage("blogs", "insertOne", nil, 300*time.Millisecond)
+	assert.Equal(t, "slow query: blogs.insertOne took 300ms", msg)
+}
+
+func TestPlanSummary(t *testing.T) {
+	explained := bson.M{
+		"queryPlanner": bson.M{
+			"winningPlan": bson.M{
+				"stage": "FETCH",
+				"inputStage": bson.M{
+					"stage":     "IXSCAN",
+					"indexName": "slug_1",
+				},
+			},
+			"rejectedPlans": bson.A{bson.M{"stage": "COLLSCAN"}},
+		},
+	}
+	stages, indexes := planSummary(explained)
+	assert.Equal(t, []string{"FETCH", "IXSCAN"}, stages)
+	assert.Equal(t, []string{"slug_1"}, indexes)
+
+	aggregate := bson.M{
+		"stages": bson.A{
+			bson.M{"$cursor": bson.M{"queryPlanner": bson.M{"winningPlan": bson.M{"queryPlan": bson.M{"stage": "COLLSCAN"}}}}},
+			bson.M{"$group": bson.M{}},
+		},
+	}
+	stages, indexes = planSummary(aggregate)
+	assert.Equal(t, []string{"COLLSCAN"}, stages)
+	assert.Empty(t, indexes)
+}
+
+func TestProfiledCollection(t *testing.T) {
+	db := NewMemoryDatabase().GetInstance()
+	db.config.SlowQueryThreshold = time.Nanosecond
+
+	builder := NewQueryBuilder[memoryPost](db, "posts")
+	assert.IsType(t, &profiledCollection{}, builder.(*queryBuilder[memoryPost]).collection)
+	_, err := builder.GetCollection().InsertOne(context.Background(), bson.M{"slug": "a"})
+	assert.ErrorIs(t, err, mongod.ErrClientDisconnected)
+
+	_, err = builder.SingleQuery().InsertOne(&memoryPost{Slug: "a"})
+	assert.NoError(t, err)
+
+	post, err := builder.SingleQuery().FindOne(bson.M{"slug": "a"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", post.Slug)
+
+	_, err = Explain(context.Background(), db, ExplainQuery{Name: "posts", Collection: "posts"})
+	assert.ErrorIs(t, err, ErrMemoryUnsupported)
+}
@@ -0,0 +1,193 @@
+package mongo
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongod "go.mongodb.org/mongo-driver/mongo"
+)
+
+type fieldSet struct {
+	typeName string
+	paths    map[string]bool
+	// paths below these prefixes are free form e.g. maps and bson.M values
+	openPaths map[string]bool
+}
+
+var fieldSetCache sync.Map
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	objectIdType = reflect.TypeOf(primitive.ObjectID{})
+	dateTimeType = reflect.TypeOf(primitive.DateTime(0))
+)
+
+func fieldsOf[T any]() *fieldSet {
+	return fieldsOfType(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+func fieldsOfType(t reflect.Type) *fieldSet {
+	t = indirectType(t)
+	if cached, ok := fieldSetCache.Load(t); ok {
+		return cached.(*fieldSet)
+	}
+
+	fs := &fieldSet{
+		typeName:  t.String(),
+		paths:     map[string]bool{"_id": true},
+		openPaths: map[string]bool{},
+	}
+	fs.collect(t, "", map[reflect.Type]bool{})
+
+	cached, _ := fieldSetCache.LoadOrStore(t, fs)
+	return cached.(*fieldSet)
+}
+
+func (fs *fieldSet) collect(t reflect.Type, prefix string, visiting map[reflect.Type]bool) {
+	t = indirectType(t)
+	if t.Kind() != reflect.Struct || visiting[t] {
+		return
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, inline, skip := bsonFieldName(f)
+		if skip {
+			continue
+		}
+
+		if inline {
+			fs.collect(f.Type, prefix, visiting)
+			continue
+		}
+
+		path := prefix + name
+		fs.paths[path] = true
+		if blind := blindIndexOf(f, name); blind != "" {
+			fs.paths[prefix+blind] = true
+		}
+
+		ft := elemType(f.Type)
+		switch {
+		case ft.Kind() == reflect.Map || ft.Kind() == reflect.Interface:
+			fs.openPaths[path] = true
+		case isStructType(ft):
+			fs.collect(ft, path+".", visiting)
+		}
+	}
+}
+
+func (fs *fieldSet) check(field string) error {
+	if strings.HasPrefix(field, "$") {
+		return nil
+	}
+
+	var segments []string
+	for _, s := range strings.Split(field, ".") {
+		// array positions and positional operators e.g. tags.0, roles.$, roles.$[]
+		if _, err := strconv.Atoi(s); err == nil || strings.HasPrefix(s, "$") {
+			continue
+		}
+		segments = append(segments, s)
+	}
+
+	for i := range segments {
+		path := strings.Join(segments[:i+1], ".")
+		if !fs.paths[path] {
+			return fmt.Errorf("unknown field %q for %s", field, fs.typeName)
+		}
+		if fs.openPaths[path] {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func bsonFieldName(f reflect.StructField) (name string, inline bool, skip bool) {
+	tag := f.Tag.Get("bson")
+	if tag == "-" {
+		return "", false, true
+	}
+
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	for _, opt := range parts[1:] {
+		if opt == "inline" {
+			inline = true
+		}
+	}
+
+	if name == "" {
+		if f.Anonymous && isStructType(indirectType(f.Type)) {
+			inline = true
+		}
+		// default naming of the bson driver
+		name = strings.ToLower(f.Name)
+	}
+
+	return name, inline, false
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+func elemType(t reflect.Type) reflect.Type {
+	t = indirectType(t)
+	for t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		if t == objectIdType {
+			return t
+		}
+		t = indirectType(t.Elem())
+	}
+	return t
+}
+
+func isStructType(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && t != objectIdType && t != dateTimeType
+}
+
+func CheckFields[T any](fields ...string) error {
+	fs := fieldsOf[T]()
+	for _, field := range fields {
+		if err := fs.check(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func CheckIndexes[T any](indexes []mongod.IndexModel) error {
+	return fieldsOf[T]().checkIndexes(indexes)
+}
+
+func (fs *fieldSet) checkIndexes(indexes []mongod.IndexModel) error {
+	for _, index := range indexes {
+		keys, ok := index.Keys.(bson.D)
+		if !ok {
+			continue
+		}
+		for _, key := range keys {
+			if err := fs.check(key.Key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
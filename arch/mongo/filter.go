@@ -0,0 +1,288 @@
+package mongo
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type Filter[T any] interface {
+	Eq(field string, value any) Filter[T]
+	Ne(field string, value any) Filter[T]
+	Gt(field string, value any) Filter[T]
+	Gte(field string, value any) Filter[T]
+	Lt(field string, value any) Filter[T]
+	Lte(field string, value any) Filter[T]
+	In(field string, values any) Filter[T]
+	Nin(field string, values any) Filter[T]
+	Exists(field string, exists bool) Filter[T]
+	Or(filters ...Filter[T]) Filter[T]
+	Build() (bson.M, error)
+	MustBuild() bson.M
+}
+
+type operators bson.M
+
+type filter[T any] struct {
+	fields *fieldSet
+	conds  bson.M
+	or     []Filter[T]
+	err    error
+}
+
+/*
+ * Example -> filter, err := NewFilter[model.Blog]().Eq("slug", slug).Eq("status", true).Build()
+ * an unknown field is returned by Build, MustBuild panics and is meant for the filters built once at the startup
+ */
+func NewFilter[T any]() Filter[T] {
+	return &filter[T]{
+		fields: fieldsOf[T](),
+		conds:  bson.M{},
+	}
+}
+
+func (f *filter[T]) Eq(field string, value any) Filter[T] {
+	if !f.checked(field) {
+		return f
+	}
+	if ops, ok := f.conds[field].(operators); ok {
+		ops["$eq"] = value
+		return f
+	}
+	f.conds[field] = value
+	return f
+}
+
+func (f *filter[T]) Ne(field string, value any) Filter[T] {
+	return f.op(field, "$ne", value)
+}
+
+func (f *filter[T]) Gt(field string, value any) Filter[T] {
+	return f.op(field, "$gt", value)
+}
+
+func (f *filter[T]) Gte(field string, value any) Filter[T] {
+	return f.op(field, "$gte", value)
+}
+
+func (f *filter[T]) Lt(field string, value any) Filter[T] {
+	return f.op(field, "$lt", value)
+}
+
+func (f *filter[T]) Lte(field string, value any) Filter[T] {
+	return f.op(field, "$lte", value)
+}
+
+func (f *filter[T]) In(field string, values any) Filter[T] {
+	return f.op(field, "$in", values)
+}
+
+func (f *filter[T]) Nin(field string, values any) Filter[T] {
+	return f.op(field, "$nin", values)
+}
+
+func (f *filter[T]) Exists(field string, exists bool) Filter[T] {
+	return f.op(field, "$exists", exists)
+}
+
+func (f *filter[T]) Or(filters ...Filter[T]) Filter[T] {
+	f.or = append(f.or, filters...)
+	return f
+}
+
+func (f *filter[T]) Build() (bson.M, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	result := bson.M{}
+	for field, cond := range f.conds {
+		if ops, ok := cond.(operators); ok {
+			result[field] = bson.M(ops)
+			continue
+		}
+		result[field] = cond
+	}
+
+	if len(f.or) > 0 {
+		or := make(bson.A, len(f.or))
+		for i, o := range f.or {
+			built, err := o.Build()
+			if err != nil {
+				return nil, err
+			}
+			or[i] = built
+		}
+		result["$or"] = or
+	}
+
+	return result, nil
+}
+
+func (f *filter[T]) MustBuild() bson.M {
+	result, err := f.Build()
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+func (f *filter[T]) op(field string, op string, value any) Filter[T] {
+	if !f.checked(field) {
+		return f
+	}
+
+	switch cond := f.conds[field].(type) {
+	case nil:
+		f.conds[field] = operators{op: value}
+	case operators:
+		cond[op] = value
+	default:
+		f.conds[field] = operators{"$eq": cond, op: value}
+	}
+
+	return f
+}
+
+func (f *filter[T]) checked(field string) bool {
+	if f.err != nil {
+		return false
+	}
+	f.err = f.fields.check(field)
+	return f.err == nil
+}
+
+type Update[T any] interface {
+	Set(field string, value any) Update[T]
+	Unset(field string) Update[T]
+	Inc(field string, value any) Update[T]
+	Push(field string, value any) Update[T]
+	AddToSet(field string, value any) Update[T]
+	Pull(field string, value any) Update[T]
+	Build() (bson.M, error)
+	MustBuild() bson.M
+}
+
+type update[T any] struct {
+	fields *fieldSet
+	ops    bson.M
+	err    error
+}
+
+/*
+ * Example -> update, err := NewUpdate[model.Blog]().Set("status", false).Inc("version", 1).Build()
+ */
+func NewUpdate[T any]() Update[T] {
+	return &update[T]{
+		fields: fieldsOf[T](),
+		ops:    bson.M{},
+	}
+}
+
+func (u *update[T]) Set(field string, value any) Update[T] {
+	return u.op("$set", field, value)
+}
+
+func (u *update[T]) Unset(field string) Update[T] {
+	return u.op("$unset", field, "")
+}
+
+func (u *update[T]) Inc(field string, value any) Update[T] {
+	return u.op("$inc", field, value)
+}
+
+func (u *update[T]) Push(field string, value any) Update[T] {
+	return u.op("$push", field, value)
+}
+
+func (u *update[T]) AddToSet(field string, value any) Update[T] {
+	return u.op("$addToSet", field, value)
+}
+
+func (u *update[T]) Pull(field string, value any) Update[T] {
+	return u.op("$pull", field, value)
+}
+
+func (u *update[T]) Build() (bson.M, error) {
+	if u.err != nil {
+		return nil, u.err
+	}
+	return u.ops, nil
+}
+
+func (u *update[T]) MustBuild() bson.M {
+	result, err := u.Build()
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+func (u *update[T]) op(op string, field string, value any) Update[T] {
+	if u.err != nil {
+		return u
+	}
+	if u.err = u.fields.check(field); u.err != nil {
+		return u
+	}
+
+	fields, ok := u.ops[op].(bson.M)
+	if !ok {
+		fields = bson.M{}
+		u.ops[op] = fields
+	}
+	fields[field] = value
+	return u
+}
+
+type Sort[T any] interface {
+	Asc(field string) Sort[T]
+	Desc(field string) Sort[T]
+	Build() (bson.D, error)
+	MustBuild() bson.D
+}
+
+type sorter[T any] struct {
+	fields *fieldSet
+	keys   bson.D
+	err    error
+}
+
+func NewSort[T any]() Sort[T] {
+	return &sorter[T]{
+		fields: fieldsOf[T](),
+		keys:   bson.D{},
+	}
+}
+
+func (s *sorter[T]) Asc(field string) Sort[T] {
+	return s.key(field, 1)
+}
+
+func (s *sorter[T]) Desc(field string) Sort[T] {
+	return s.key(field, -1)
+}
+
+func (s *sorter[T]) Build() (bson.D, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.keys, nil
+}
+
+func (s *sorter[T]) MustBuild() bson.D {
+	result, err := s.Build()
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+func (s *sorter[T]) key(field string, order int) Sort[T] {
+	if s.err != nil {
+		return s
+	}
+	if s.err = s.fields.check(field); s.err != nil {
+		return s
+	}
+	s.keys = append(s.keys, bson.E{Key: field, Value: order})
+	return s
+}
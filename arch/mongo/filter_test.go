@@ -0,0 +1,118 @@
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongod "go.mongodb.org/mongo-driver/mongo"
+)
+
+type mockProfile struct {
+	Bio   string            `bson:"bio"`
+	Links map[string]string `bson:"links"`
+}
+
+type mockDoc struct {
+	ID        primitive.ObjectID   `bson:"_id,omitempty"`
+	Title     string               `bson:"title"`
+	Tags      []string             `bson:"tags"`
+	Score     float64              `bson:"score"`
+	Roles     []primitive.ObjectID `bson:"roles,omitempty"`
+	Profile   *mockProfile         `bson:"profile,omitempty"`
+	Status    bool                 `bson:"status"`
+	Secret    string               `bson:"-"`
+	Untagged  string
+	CreatedAt time.Time `bson:"createdAt"`
+}
+
+func TestFilter_Build(t *testing.T) {
+	id := primitive.NewObjectID()
+	filter, err := NewFilter[mockDoc]().
+		Eq("_id", id).
+		Eq("status", true).
+		Gt("score", 0.5).
+		Lte("score", 1).
+		In("tags", []string{"go"}).
+		Build()
+
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{
+		"_id":    id,
+		"status": true,
+		"score":  bson.M{"$gt": 0.5, "$lte": 1},
+		"tags":   bson.M{"$in": []string{"go"}},
+	}, filter)
+}
+
+func TestFilter_EqWithOperators(t *testing.T) {
+	filter := NewFilter[mockDoc]().Eq("title", "a").Ne("title", "b").MustBuild()
+	assert.Equal(t, bson.M{"title": bson.M{"$eq": "a", "$ne": "b"}}, filter)
+}
+
+func TestFilter_Or(t *testing.T) {
+	filter := NewFilter[mockDoc]().
+		Eq("status", true).
+		Or(NewFilter[mockDoc]().Eq("title", "a"), NewFilter[mockDoc]().Exists("profile", false)).
+		MustBuild()
+
+	assert.Equal(t, bson.M{
+		"status": true,
+		"$or":    bson.A{bson.M{"title": "a"}, bson.M{"profile": bson.M{"$exists": false}}},
+	}, filter)
+}
+
+func TestFilter_UnknownField(t *testing.T) {
+	_, err := NewFilter[mockDoc]().Eq("code", 1).Eq("status", true).Build()
+	assert.EqualError(t, err, `unknown field "code" for mongo.mockDoc`)
+
+	_, err = NewFilter[mockDoc]().Eq("secret", "x").Build()
+	assert.Error(t, err)
+
+	_, err = NewFilter[mockDoc]().Or(NewFilter[mockDoc]().Eq("titel", "x")).Build()
+	assert.Error(t, err)
+
+	assert.Panics(t, func() { NewFilter[mockDoc]().Eq("code", 1).MustBuild() })
+}
+
+func TestFilter_NestedFields(t *testing.T) {
+	assert.NoError(t, CheckFields[mockDoc]("profile.bio", "profile.links.github", "tags.0", "roles.$", "untagged"))
+	assert.Error(t, CheckFields[mockDoc]("profile.age"))
+	assert.Error(t, CheckFields[mockDoc]("title.sub"))
+}
+
+func TestUpdate_Build(t *testing.T) {
+	update := NewUpdate[mockDoc]().
+		Set("title", "new").
+		Set("status", false).
+		Inc("score", 0.1).
+		Push("tags", "go").
+		MustBuild()
+
+	assert.Equal(t, bson.M{
+		"$set":  bson.M{"title": "new", "status": false},
+		"$inc":  bson.M{"score": 0.1},
+		"$push": bson.M{"tags": "go"},
+	}, update)
+
+	_, err := NewUpdate[mockDoc]().Set("titel", "x").Build()
+	assert.Error(t, err)
+}
+
+func TestSort_Build(t *testing.T) {
+	sort := NewSort[mockDoc]().Desc("createdAt").Asc("score").MustBuild()
+	assert.Equal(t, bson.D{{Key: "createdAt", Value: -1}, {Key: "score", Value: 1}}, sort)
+
+	_, err := NewSort[mockDoc]().Asc("updatedAt").Build()
+	assert.Error(t, err)
+}
+
+func TestCheckIndexes(t *testing.T) {
+	valid := []mongod.IndexModel{{Keys: bson.D{{Key: "title", Value: "text"}, {Key: "status", Value: 1}}}}
+	assert.NoError(t, CheckIndexes[mockDoc](valid))
+
+	invalid := []mongod.IndexModel{{Keys: bson.D{{Key: "code", Value: 1}, {Key: "status", Value: 1}}}}
+	assert.Error(t, CheckIndexes[mockDoc](invalid))
+}
@@ -0,0 +1,597 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultIdIndexName = "_id_"
+
+var ErrIndexConflict = errors.New("index conflict")
+
+const (
+	ValidationLevelOff      = "off"
+	ValidationLevelStrict   = "strict"
+	ValidationLevelModerate = "moderate"
+
+	ValidationActionError = "error"
+	ValidationActionWarn  = "warn"
+)
+
+/*
+ * ValidationLevel enables the $jsonSchema validators generated from the documents, empty skips them
+ * ValidationAction defaults to error when the level is set
+ */
+type IndexConfig struct {
+	DryRun           bool
+	DropUndeclared   bool
+	Timeout          time.Duration
+	ValidationLevel  string
+	ValidationAction string
+}
+
+type IndexConflict struct {
+	Name     string
+	Declared string
+	Existing string
+}
+
+type IndexPlan struct {
+	Collection string
+	Create     []string
+	Drop       []string
+	Unchanged  []string
+	Conflicts  []IndexConflict
+	Validator  *ValidatorPlan
+	create     []mongo.IndexModel
+}
+
+type ValidatorPlan struct {
+	Schema  bson.M
+	Level   string
+	Action  string
+	Changed bool
+	exists  bool
+}
+
+func (p *IndexPlan) HasChanges() bool {
+	return len(p.Create) > 0 || len(p.Drop) > 0 || (p.Validator != nil && p.Validator.Changed)
+}
+
+func (p *IndexPlan) String() string {
+	var sb strings.Builder
+	sb.WriteString("indexes for " + p.Collection + ":")
+	for _, n := range p.Unchanged {
+		sb.WriteString("\n  = " + n)
+	}
+	for _, n := range p.Create {
+		sb.WriteString("\n  + " + n)
+	}
+	for _, n := range p.Drop {
+		sb.WriteString("\n  - " + n)
+	}
+	for _, c := range p.Conflicts {
+		sb.WriteString(fmt.Sprintf("\n  ! %s declared %s but exists as %s", c.Name, c.Declared, c.Existing))
+	}
+	if v := p.Validator; v != nil {
+		mark := "="
+		if v.Changed {
+			mark = "~"
+		}
+		sb.WriteString(fmt.Sprintf("\n  %s validator $jsonSchema level=%s action=%s", mark, v.Level, v.Action))
+	}
+	return sb.String()
+}
+
+type IndexReconciler interface {
+	Plan(ctx context.Context, docs ...Indexed) ([]*IndexPlan, error)
+	Reconcile(ctx context.Context, docs ...Indexed) ([]*IndexPlan, error)
+}
+
+type indexReconciler struct {
+	db     Database
+	config IndexConfig
+}
+
+func NewIndexReconciler(db Database, config IndexConfig) IndexReconciler {
+	if config.ValidationLevel != "" && config.ValidationAction == "" {
+		config.ValidationAction = ValidationActionError
+	}
+	return &indexReconciler{
+		db:     db,
+		config: config,
+	}
+}
+
+func (r *indexReconciler) Plan(ctx context.Context, docs ...Indexed) ([]*IndexPlan, error) {
+	if r.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.config.Timeout)
+		defer cancel()
+	}
+	return r.plan(ctx, docs)
+}
+
+func (r *indexReconciler) Reconcile(ctx context.Context, docs ...Indexed) ([]*IndexPlan, error) {
+	if r.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.config.Timeout)
+		defer cancel()
+	}
+
+	plans, err := r.plan(ctx, docs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range plans {
+		fmt.Println(p)
+	}
+
+	var conflicts []string
+	for _, p := range plans {
+		for _, c := range p.Conflicts {
+			conflicts = append(conflicts, p.Collection+"."+c.Name)
+		}
+	}
+	if len(conflicts) > 0 {
+		return plans, fmt.Errorf("%w: %s", ErrIndexConflict, strings.Join(conflicts, ", "))
+	}
+
+	if r.config.DryRun {
+		fmt.Println("index reconciliation dry run: no changes applied")
+		return plans, nil
+	}
+
+	for _, p := range plans {
+		if err := r.apply(ctx, p); err != nil {
+			return plans, err
+		}
+	}
+
+	return plans, nil
+}
+
+// the memory database has no driver connection to list, drop or validate the indexes with
+func (r *indexReconciler) plan(ctx context.Context, docs []Indexed) ([]*IndexPlan, error) {
+	if err := r.checkValidation(); err != nil {
+		return nil, err
+	}
+	if r.db.GetInstance().memory != nil {
+		return nil, fmt.Errorf("index reconciliation is %w", ErrMemoryUnsupported)
+	}
+
+	declared := map[string][]mongo.IndexModel{}
+	schemas := map[string]bson.M{}
+	var collections []string
+
+	for _, doc := range docs {
+		name := doc.GetCollectionName()
+		indexes := doc.GetIndexes()
+		if err := fieldsOfType(reflect.TypeOf(doc)).checkIndexes(indexes); err != nil {
+			return nil, fmt.Errorf("invalid index for %s: %w", name, err)
+		}
+		if _, ok := declared[name]; !ok {
+			collections = append(collections, name)
+			schemas[name] = schemaOfType(reflect.TypeOf(doc))
+		}
+		declared[name] = append(declared[name], indexes...)
+	}
+
+	plans := make([]*IndexPlan, 0, len(collections))
+	for _, name := range collections {
+		existing, err := r.listIndexes(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		plan, err := planIndexes(name, declared[name], existing, r.config.DropUndeclared)
+		if err != nil {
+			return nil, err
+		}
+		if r.config.ValidationLevel != "" {
+			if plan.Validator, err = r.planValidator(ctx, name, schemas[name]); err != nil {
+				return nil, err
+			}
+		}
+		plans = append(plans, plan)
+	}
+
+	return plans, nil
+}
+
+func (r *indexReconciler) listIndexes(ctx context.Context, collection string) ([]bson.D, error) {
+	cursor, err := r.db.GetInstance().Collection(collection).Indexes().List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing indexes for %s: %w", collection, err)
+	}
+	defer cursor.Close(ctx)
+
+	// decoded as bson.D to keep the order of the index keys
+	var indexes []bson.D
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return nil, fmt.Errorf("error decoding indexes for %s: %w", collection, err)
+	}
+	return indexes, nil
+}
+
+func (r *indexReconciler) checkValidation() error {
+	switch r.config.ValidationLevel {
+	case "", ValidationLevelOff, ValidationLevelStrict, ValidationLevelModerate:
+	default:
+		return fmt.Errorf("invalid validation level: %s", r.config.ValidationLevel)
+	}
+	switch r.config.ValidationAction {
+	case "", ValidationActionError, ValidationActionWarn:
+	default:
+		return fmt.Errorf("invalid validation action: %s", r.config.ValidationAction)
+	}
+	return nil
+}
+
+func (r *indexReconciler) planValidator(ctx context.Context, collection string, schema bson.M) (*ValidatorPlan, error) {
+	plan := &ValidatorPlan{
+		Schema: schema,
+		Level:  r.config.ValidationLevel,
+		Action: r.config.ValidationAction,
+	}
+
+	specs, err := r.db.GetInstance().ListCollectionSpecifications(ctx, bson.M{"name": collection})
+	if err != nil {
+		return nil, fmt.Errorf("error listing collection %s: %w", collection, err)
+	}
+	if len(specs) == 0 {
+		plan.Changed = true
+		return plan, nil
+	}
+	plan.exists = true
+
+	var current bson.M
+	if err := bson.Unmarshal(specs[0].Options, &current); err != nil {
+		return nil, fmt.Errorf("error decoding options of %s: %w", collection, err)
+	}
+	plan.Changed = !sameValidator(current, plan)
+	return plan, nil
+}
+
+// the server returns the defaults strict and error when they were never set
+func sameValidator(current bson.M, plan *ValidatorPlan) bool {
+	level, ok := current["validationLevel"].(string)
+	if !ok {
+		level = ValidationLevelStrict
+	}
+	action, ok := current["validationAction"].(string)
+	if !ok {
+		action = ValidationActionError
+	}
+	if level != plan.Level || action != plan.Action {
+		return false
+	}
+
+	declared, err := canonical(bson.M{"$jsonSchema": plan.Schema})
+	if err != nil {
+		return false
+	}
+	existing, err := canonical(current["validator"])
+	if err != nil {
+		return false
+	}
+	return valueKey(declared) == valueKey(existing)
+}
+
+func (r *indexReconciler) applyValidator(ctx context.Context, collection string, plan *ValidatorPlan) error {
+	validator := bson.M{"$jsonSchema": plan.Schema}
+
+	if !plan.exists {
+		opts := options.CreateCollection().
+			SetValidator(validator).
+			SetValidationLevel(plan.Level).
+			SetValidationAction(plan.Action)
+		if err := r.db.GetInstance().CreateCollection(ctx, collection, opts); err != nil {
+			return fmt.Errorf("error creating collection %s: %w", collection, err)
+		}
+		return nil
+	}
+
+	cmd := bson.D{
+		{Key: "collMod", Value: collection},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: plan.Level},
+		{Key: "validationAction", Value: plan.Action},
+	}
+	if err := r.db.GetInstance().RunCommand(ctx, cmd).Err(); err != nil {
+		return fmt.Errorf("error updating validator for %s: %w", collection, err)
+	}
+	return nil
+}
+
+func (r *indexReconciler) apply(ctx context.Context, plan *IndexPlan) error {
+	// before the indexes, those create the collection without the validator
+	if v := plan.Validator; v != nil && v.Changed {
+		if err := r.applyValidator(ctx, plan.Collection, v); err != nil {
+			return err
+		}
+	}
+
+	view := r.db.GetInstance().Collection(plan.Collection).Indexes()
+
+	if len(plan.create) > 0 {
+		if _, err := view.CreateMany(ctx, plan.create); err != nil {
+			return fmt.Errorf("error creating indexes for %s: %w", plan.Collection, err)
+		}
+	}
+
+	for _, name := range plan.Drop {
+		if _, err := view.DropOne(ctx, name); err != nil {
+			return fmt.Errorf("error dropping index %s for %s: %w", name, plan.Collection, err)
+		}
+	}
+
+	return nil
+}
+
+func planIndexes(collection string, declared []mongo.IndexModel, existing []bson.D, dropUndeclared bool) (*IndexPlan, error) {
+	plan := &IndexPlan{Collection: collection}
+
+	existingSpecs := map[string]*indexSpec{}
+	for _, e := range existing {
+		spec := specFromExisting(e)
+		existingSpecs[spec.name] = spec
+	}
+
+	declaredNames := map[string]bool{}
+	for _, model := range declared {
+		spec, err := specFromModel(model)
+		if err != nil {
+			return nil, fmt.Errorf("invalid index for %s: %w", collection, err)
+		}
+		declaredNames[spec.name] = true
+
+		if current, ok := existingSpecs[spec.name]; ok {
+			if current.String() == spec.String() {
+				plan.Unchanged = append(plan.Unchanged, spec.name)
+			} else {
+				plan.Conflicts = append(plan.Conflicts, IndexConflict{
+					Name:     spec.name,
+					Declared: spec.String(),
+					Existing: current.String(),
+				})
+			}
+			continue
+		}
+
+		if same := findSameKeys(existingSpecs, spec); same != nil {
+			plan.Conflicts = append(plan.Conflicts, IndexConflict{
+				Name:     spec.name,
+				Declared: spec.String(),
+				Existing: same.name + " " + same.String(),
+			})
+			continue
+		}
+
+		plan.Create = append(plan.Create, spec.name)
+		plan.create = append(plan.create, spec.model())
+	}
+
+	if dropUndeclared {
+		for name := range existingSpecs {
+			if name != defaultIdIndexName && !declaredNames[name] {
+				plan.Drop = append(plan.Drop, name)
+			}
+		}
+		sort.Strings(plan.Drop)
+	}
+
+	return plan, nil
+}
+
+func findSameKeys(specs map[string]*indexSpec, spec *indexSpec) *indexSpec {
+	for _, s := range specs {
+		if s.keysString() == spec.keysString() {
+			return s
+		}
+	}
+	return nil
+}
+
+type indexSpec struct {
+	name    string
+	keys    bson.D
+	unique  bool
+	sparse  bool
+	ttl     *int64
+	weights map[string]float64
+	source  mongo.IndexModel
+}
+
+func (s *indexSpec) keysString() string {
+	parts := make([]string, len(s.keys))
+	for i, k := range s.keys {
+		parts[i] = fmt.Sprintf("%s:%v", k.Key, k.Value)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func (s *indexSpec) String() string {
+	str := s.keysString()
+	if s.unique {
+		str += " unique"
+	}
+	if s.sparse {
+		str += " sparse"
+	}
+	if s.ttl != nil {
+		str += fmt.Sprintf(" ttl=%ds", *s.ttl)
+	}
+	if len(s.weights) > 0 {
+		fields := make([]string, 0, len(s.weights))
+		for f := range s.weights {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+		for i, f := range fields {
+			fields[i] = fmt.Sprintf("%s=%v", f, s.weights[f])
+		}
+		str += " weights(" + strings.Join(fields, ",") + ")"
+	}
+	return str
+}
+
+func (s *indexSpec) model() mongo.IndexModel {
+	opts := s.source.Options
+	if opts == nil {
+		opts = options.Index()
+	}
+	opts.SetName(s.name)
+	return mongo.IndexModel{Keys: s.source.Keys, Options: opts}
+}
+
+func specFromModel(model mongo.IndexModel) (*indexSpec, error) {
+	keys, ok := model.Keys.(bson.D)
+	if !ok {
+		return nil, errors.New("index keys must be a bson.D")
+	}
+
+	spec := &indexSpec{source: model}
+
+	var nameParts []string
+	var textFields []string
+	for _, k := range keys {
+		nameParts = append(nameParts, fmt.Sprintf("%s_%v", k.Key, k.Value))
+		if k.Value == "text" {
+			textFields = append(textFields, k.Key)
+			continue
+		}
+		spec.keys = append(spec.keys, bson.E{Key: k.Key, Value: normalizeIndexValue(k.Value)})
+	}
+	spec.name = strings.Join(nameParts, "_")
+
+	if len(textFields) > 0 {
+		spec.keys = append(spec.keys, bson.E{Key: "$text", Value: "text"})
+		spec.weights = map[string]float64{}
+		for _, f := range textFields {
+			spec.weights[f] = 1
+		}
+	}
+
+	if opts := model.Options; opts != nil {
+		if opts.Name != nil {
+			spec.name = *opts.Name
+		}
+		spec.unique = opts.Unique != nil && *opts.Unique
+		spec.sparse = opts.Sparse != nil && *opts.Sparse
+		if opts.ExpireAfterSeconds != nil {
+			ttl := int64(*opts.ExpireAfterSeconds)
+			spec.ttl = &ttl
+		}
+		if opts.Weights != nil && spec.weights != nil {
+			for f, w := range toWeights(opts.Weights) {
+				spec.weights[f] = w
+			}
+		}
+	}
+
+	return spec, nil
+}
+
+func specFromExisting(doc bson.D) *indexSpec {
+	index := make(map[string]any, len(doc))
+	for _, e := range doc {
+		index[e.Key] = e.Value
+	}
+
+	spec := &indexSpec{}
+	spec.name, _ = index["name"].(string)
+	spec.unique, _ = index["unique"].(bool)
+	spec.sparse, _ = index["sparse"].(bool)
+
+	if ttl, ok := toFloat(index["expireAfterSeconds"]); ok {
+		t := int64(ttl)
+		spec.ttl = &t
+	}
+
+	text := false
+	for _, k := range toD(index["key"]) {
+		if k.Key == "_fts" || k.Key == "_ftsx" {
+			text = true
+			continue
+		}
+		spec.keys = append(spec.keys, bson.E{Key: k.Key, Value: normalizeIndexValue(k.Value)})
+	}
+
+	if text {
+		spec.keys = append(spec.keys, bson.E{Key: "$text", Value: "text"})
+		spec.weights = toWeights(index["weights"])
+	}
+
+	return spec
+}
+
+func normalizeIndexValue(v any) any {
+	if f, ok := toFloat(v); ok {
+		return f
+	}
+	return v
+}
+
+func toWeights(v any) map[string]float64 {
+	weights := map[string]float64{}
+	switch w := v.(type) {
+	case bson.M:
+		for f, val := range w {
+			if n, ok := toFloat(val); ok {
+				weights[f] = n
+			}
+		}
+	case bson.D:
+		for _, e := range w {
+			if n, ok := toFloat(e.Value); ok {
+				weights[e.Key] = n
+			}
+		}
+	case map[string]int:
+		for f, n := range w {
+			weights[f] = float64(n)
+		}
+	}
+	return weights
+}
+
+func toD(v any) bson.D {
+	switch d := v.(type) {
+	case bson.D:
+		return d
+	case bson.M:
+		keys := sortedKeys(d)
+		result := make(bson.D, len(keys))
+		for i, k := range keys {
+			result[i] = bson.E{Key: k, Value: d[k]}
+		}
+		return result
+	}
+	return nil
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
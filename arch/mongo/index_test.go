@@ -0,0 +1,146 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func existingIndex(name string, keys bson.D, extra ...bson.E) bson.D {
+	doc := bson.D{{Key: "v", Value: int32(2)}, {Key: "key", Value: keys}, {Key: "name", Value: name}}
+	return append(doc, extra...)
+}
+
+func TestPlanIndexes_CreateMissing(t *testing.T) {
+	declared := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "_id", Value: 1}, {Key: "status", Value: 1}}},
+	}
+	existing := []bson.D{
+		existingIndex("_id_", bson.D{{Key: "_id", Value: int32(1)}}),
+		existingIndex("email_1", bson.D{{Key: "email", Value: int32(1)}}, bson.E{Key: "unique", Value: true}),
+	}
+
+	plan, err := planIndexes("users", declared, existing, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"email_1"}, plan.Unchanged)
+	assert.Equal(t, []string{"_id_1_status_1"}, plan.Create)
+	assert.Empty(t, plan.Drop)
+	assert.Empty(t, plan.Conflicts)
+	assert.True(t, plan.HasChanges())
+	assert.Equal(t, "_id_1_status_1", *plan.create[0].Options.Name)
+}
+
+func TestPlanIndexes_DropUndeclared(t *testing.T) {
+	declared := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}}},
+	}
+	existing := []bson.D{
+		existingIndex("_id_", bson.D{{Key: "_id", Value: int32(1)}}),
+		existingIndex("email_1", bson.D{{Key: "email", Value: int32(1)}}),
+		existingIndex("name_1", bson.D{{Key: "name", Value: int32(1)}}),
+	}
+
+	plan, err := planIndexes("users", declared, existing, false)
+	assert.NoError(t, err)
+	assert.Empty(t, plan.Drop)
+	assert.False(t, plan.HasChanges())
+
+	plan, err = planIndexes("users", declared, existing, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"name_1"}, plan.Drop)
+}
+
+func TestPlanIndexes_OptionConflict(t *testing.T) {
+	declared := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+	}
+	existing := []bson.D{
+		existingIndex("email_1", bson.D{{Key: "email", Value: int32(1)}}),
+	}
+
+	plan, err := planIndexes("users", declared, existing, false)
+	assert.NoError(t, err)
+	assert.Empty(t, plan.Create)
+	assert.Len(t, plan.Conflicts, 1)
+	assert.Equal(t, "email_1", plan.Conflicts[0].Name)
+	assert.Equal(t, "{email:1} unique", plan.Conflicts[0].Declared)
+	assert.Equal(t, "{email:1}", plan.Conflicts[0].Existing)
+}
+
+func TestPlanIndexes_SameKeysDifferentName(t *testing.T) {
+	declared := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetName("email_unique")},
+	}
+	existing := []bson.D{
+		existingIndex("email_1", bson.D{{Key: "email", Value: int32(1)}}),
+	}
+
+	plan, err := planIndexes("users", declared, existing, false)
+	assert.NoError(t, err)
+	assert.Empty(t, plan.Create)
+	assert.Len(t, plan.Conflicts, 1)
+	assert.Equal(t, "email_unique", plan.Conflicts[0].Name)
+}
+
+func TestPlanIndexes_TextIndex(t *testing.T) {
+	declared := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "title", Value: "text"}, {Key: "description", Value: "text"}},
+			Options: options.Index().SetWeights(bson.M{"title": 3, "description": 1}),
+		},
+	}
+	existing := []bson.D{
+		existingIndex("title_text_description_text",
+			bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}},
+			bson.E{Key: "weights", Value: bson.D{{Key: "description", Value: int32(1)}, {Key: "title", Value: int32(3)}}},
+		),
+	}
+
+	plan, err := planIndexes("blogs", declared, existing, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"title_text_description_text"}, plan.Unchanged)
+	assert.Empty(t, plan.Conflicts)
+
+	declared[0].Options = options.Index().SetWeights(bson.M{"title": 5, "description": 1})
+	plan, err = planIndexes("blogs", declared, existing, false)
+	assert.NoError(t, err)
+	assert.Len(t, plan.Conflicts, 1)
+}
+
+func TestPlanIndexes_TTL(t *testing.T) {
+	declared := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "expireAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(3600)},
+	}
+	existing := []bson.D{
+		existingIndex("expireAt_1", bson.D{{Key: "expireAt", Value: int32(1)}}, bson.E{Key: "expireAfterSeconds", Value: int32(3600)}),
+	}
+
+	plan, err := planIndexes("sessions", declared, existing, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"expireAt_1"}, plan.Unchanged)
+}
+
+func TestPlanIndexes_InvalidKeys(t *testing.T) {
+	declared := []mongo.IndexModel{
+		{Keys: bson.M{"email": 1}},
+	}
+
+	_, err := planIndexes("users", declared, nil, false)
+	assert.Error(t, err)
+}
+
+func TestIndexReconciler_MemoryUnsupported(t *testing.T) {
+	r := NewIndexReconciler(NewMemoryDatabase(), IndexConfig{})
+	docs := []Indexed{&encryptedDoc{}}
+
+	_, err := r.Plan(context.Background(), docs...)
+	assert.ErrorIs(t, err, ErrMemoryUnsupported)
+
+	_, err = r.Reconcile(context.Background(), docs...)
+	assert.ErrorIs(t, err, ErrMemoryUnsupported)
+}
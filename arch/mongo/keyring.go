@@ -0,0 +1,228 @@
+package mongo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	encryptedPrefix  = "enc:"
+	blindIndexKeyID  = "blind"
+	encryptionKeyLen = 32
+)
+
+var (
+	ErrNoKeyring       = errors.New("field encryption needs a keyring in the DbConfig")
+	ErrUnknownKey      = errors.New("unknown encryption key")
+	ErrEncryptedField  = errors.New("encrypted field")
+	ErrInvalidKeyValue = errors.New("invalid encryption key")
+)
+
+/*
+ * Envelope encryption: the data keys are stored wrapped by the master key, which only unwraps them
+ * rotate by adding a new data key, making it active and running `dbctl reencrypt`
+ * the blind index key can't be rotated without rebuilding the blind indexes
+ */
+type KeyringConfig struct {
+	MasterKey []byte
+	// the wrapped data keys by id, the old ones are needed to decrypt the values written with them
+	DataKeys      map[string]string
+	ActiveKey     string
+	BlindIndexKey string
+}
+
+type Keyring interface {
+	ActiveKey() string
+	Encrypt(field string, plaintext string) (string, error)
+	Decrypt(field string, value string) (string, error)
+	BlindIndex(field string, value string) string
+	KeyOf(value string) string
+}
+
+type keyring struct {
+	active string
+	keys   map[string]cipher.AEAD
+	blind  []byte
+}
+
+func NewKeyring(config KeyringConfig) (Keyring, error) {
+	master, err := newGCM(config.MasterKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: master key: %v", ErrInvalidKeyValue, err)
+	}
+
+	if _, ok := config.DataKeys[config.ActiveKey]; !ok {
+		return nil, fmt.Errorf("%w: active key %q", ErrUnknownKey, config.ActiveKey)
+	}
+
+	k := &keyring{
+		active: config.ActiveKey,
+		keys:   make(map[string]cipher.AEAD, len(config.DataKeys)),
+	}
+
+	for id, wrapped := range config.DataKeys {
+		if id == "" || id == blindIndexKeyID || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("%w: key id %q", ErrInvalidKeyValue, id)
+		}
+		key, err := unwrapKey(master, id, wrapped)
+		if err != nil {
+			return nil, err
+		}
+		if k.keys[id], err = newGCM(key); err != nil {
+			return nil, fmt.Errorf("%w: data key %s: %v", ErrInvalidKeyValue, id, err)
+		}
+	}
+
+	if k.blind, err = unwrapKey(master, blindIndexKeyID, config.BlindIndexKey); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+func newEphemeralKeyring() Keyring {
+	master := make([]byte, encryptionKeyLen)
+	if _, err := rand.Read(master); err != nil {
+		panic(err)
+	}
+	dataKey, err := GenerateDataKey(master, "ephemeral")
+	if err != nil {
+		panic(err)
+	}
+	blindKey, err := GenerateDataKey(master, blindIndexKeyID)
+	if err != nil {
+		panic(err)
+	}
+
+	keyring, err := NewKeyring(KeyringConfig{
+		MasterKey:     master,
+		DataKeys:      map[string]string{"ephemeral": dataKey},
+		ActiveKey:     "ephemeral",
+		BlindIndexKey: blindKey,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return keyring
+}
+
+/*
+ * Example -> GenerateDataKey(masterKey, "v2") gives a new wrapped key for KeyringConfig.DataKeys
+ * use the id "blind" for the BlindIndexKey
+ */
+func GenerateDataKey(masterKey []byte, id string) (string, error) {
+	key := make([]byte, encryptionKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return WrapKey(masterKey, id, key)
+}
+
+// the key id is authenticated with the key so that the wrapped keys can't be swapped
+func WrapKey(masterKey []byte, id string, key []byte) (string, error) {
+	master, err := newGCM(masterKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: master key: %v", ErrInvalidKeyValue, err)
+	}
+	return base64.StdEncoding.EncodeToString(seal(master, key, []byte(id))), nil
+}
+
+func unwrapKey(master cipher.AEAD, id string, wrapped string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("%w: key %s: %v", ErrInvalidKeyValue, id, err)
+	}
+	key, err := open(master, data, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("%w: key %s is not wrapped by the master key", ErrInvalidKeyValue, id)
+	}
+	return key, nil
+}
+
+func (k *keyring) ActiveKey() string {
+	return k.active
+}
+
+// the field name is authenticated with the value so that the values can't be moved between fields
+func (k *keyring) Encrypt(field string, plaintext string) (string, error) {
+	data := seal(k.keys[k.active], []byte(plaintext), []byte(field))
+	return encryptedPrefix + k.active + ":" + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// the values written before the field was encrypted are returned as they are
+func (k *keyring) Decrypt(field string, value string) (string, error) {
+	id := k.KeyOf(value)
+	if id == "" {
+		return value, nil
+	}
+
+	aead, ok := k.keys[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %s for %s", ErrUnknownKey, id, field)
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(value[len(encryptedPrefix)+len(id)+1:])
+	if err != nil {
+		return "", fmt.Errorf("error decoding %s: %w", field, err)
+	}
+	plaintext, err := open(aead, data, []byte(field))
+	if err != nil {
+		return "", fmt.Errorf("error decrypting %s: %w", field, err)
+	}
+	return string(plaintext), nil
+}
+
+// deterministic, so the equality lookups can query the blind index instead of the ciphertext
+func (k *keyring) BlindIndex(field string, value string) string {
+	mac := hmac.New(sha256.New, k.blind)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// the id of the key that encrypted the value, empty for a plaintext
+func (k *keyring) KeyOf(value string) string {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return ""
+	}
+	id, _, found := strings.Cut(value[len(encryptedPrefix):], ":")
+	if !found {
+		return ""
+	}
+	return id
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != encryptionKeyLen {
+		return nil, fmt.Errorf("needs %d bytes, got %d", encryptionKeyLen, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext []byte, aad []byte) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad)
+}
+
+func open(aead cipher.AEAD, data []byte, aad []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
@@ -0,0 +1,702 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const duplicateKeyCode = 11000
+
+var ErrMemoryUnsupported = errors.New("not supported by the memory database")
+
+/*
+ * Example -> db := NewMemoryDatabase(); service := blog.NewService(db, store, userService)
+ * only the operations of Query[T] and QueryBuilder[T] are supported, the Database.GetInstance()
+ * has no driver connection i.e. index reconciliation and change streams need a mongo server
+ * QueryBuilder.GetCollection() gives a collection of a client never connected, its operations fail with mongo.ErrClientDisconnected
+ * the documents live only in the process, so the encrypted fields use random keys
+ */
+func NewMemoryDatabase() Database {
+	// never connected, it only backs the collections of GetCollection()
+	client, err := mongo.NewClient(options.Client())
+	if err != nil {
+		panic(err)
+	}
+
+	return &database{
+		context: context.Background(),
+		config:  DbConfig{Name: "memory", Timeout: 10 * time.Second, Keyring: newEphemeralKeyring()},
+		memory:  &memoryStore{collections: map[string]*memoryCollection{}, driver: client.Database("memory")},
+	}
+}
+
+type memoryStore struct {
+	mutex       sync.Mutex
+	collections map[string]*memoryCollection
+	driver      *mongo.Database
+}
+
+func (s *memoryStore) collection(name string) *memoryCollection {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	c, ok := s.collections[name]
+	if !ok {
+		c = &memoryCollection{name: name, store: s}
+		s.collections[name] = c
+	}
+	return c
+}
+
+type memoryIndex struct {
+	name   string
+	keys   []string
+	sparse bool
+}
+
+type memoryCollection struct {
+	mutex   sync.RWMutex
+	name    string
+	store   *memoryStore
+	docs    []bson.M
+	uniques []memoryIndex
+	text    map[string]float64
+}
+
+func (c *memoryCollection) Name() string {
+	return c.name
+}
+
+// a copy of the matched documents in insertion order
+func (c *memoryCollection) snapshot(filter any) ([]bson.M, error) {
+	f, err := toFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	m := &matcher{text: c.text}
+	search, text := f["$text"]
+
+	var docs []bson.M
+	for _, doc := range c.docs {
+		ok, err := m.match(doc, f)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		doc = copyDocument(doc)
+		if text {
+			doc[textScoreKey], _ = m.textScore(doc, search)
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+func (c *memoryCollection) match(doc bson.M, filter bson.M) (bool, error) {
+	return (&matcher{text: c.text}).match(doc, filter)
+}
+
+func (c *memoryCollection) find(ctx context.Context, filter any, sortSpec any, skip *int64, limit *int64, projection any) ([]bson.M, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	docs, err := c.snapshot(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if sortSpec != nil {
+		if err := sortDocuments(docs, sortSpec); err != nil {
+			return nil, err
+		}
+	}
+
+	if skip != nil && *skip > 0 {
+		if *skip >= int64(len(docs)) {
+			docs = nil
+		} else {
+			docs = docs[*skip:]
+		}
+	}
+
+	if limit != nil && *limit > 0 && *limit < int64(len(docs)) {
+		docs = docs[:*limit]
+	}
+
+	if projection != nil {
+		for i, doc := range docs {
+			if docs[i], err = projectDocument(doc, projection); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return stripTextScore(docs), nil
+}
+
+func (c *memoryCollection) FindOne(ctx context.Context, filter any, opts ...*options.FindOneOptions) *mongo.SingleResult {
+	opt := options.MergeFindOneOptions(opts...)
+	limit := int64(1)
+	docs, err := c.find(ctx, filter, opt.Sort, opt.Skip, &limit, opt.Projection)
+	return singleResult(docs, err)
+}
+
+func (c *memoryCollection) Find(ctx context.Context, filter any, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	opt := options.MergeFindOptions(opts...)
+	docs, err := c.find(ctx, filter, opt.Sort, opt.Skip, opt.Limit, opt.Projection)
+	if err != nil {
+		return nil, err
+	}
+	return cursor(docs)
+}
+
+func (c *memoryCollection) InsertOne(ctx context.Context, document any, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	doc, err := toDocument(document)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.insert(doc); err != nil {
+		return nil, err
+	}
+	return &mongo.InsertOneResult{InsertedID: doc["_id"]}, nil
+}
+
+func (c *memoryCollection) InsertMany(ctx context.Context, documents []any, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	result := &mongo.InsertManyResult{}
+	for _, document := range documents {
+		doc, err := toDocument(document)
+		if err != nil {
+			return result, err
+		}
+		if err := c.insert(doc); err != nil {
+			return result, err
+		}
+		result.InsertedIDs = append(result.InsertedIDs, doc["_id"])
+	}
+	return result, nil
+}
+
+func (c *memoryCollection) UpdateOne(ctx context.Context, filter any, update any, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	opt := options.MergeUpdateOptions(opts...)
+	return c.update(ctx, filter, update, opt.Upsert != nil && *opt.Upsert, false)
+}
+
+func (c *memoryCollection) UpdateMany(ctx context.Context, filter any, update any, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	opt := options.MergeUpdateOptions(opts...)
+	return c.update(ctx, filter, update, opt.Upsert != nil && *opt.Upsert, true)
+}
+
+func (c *memoryCollection) update(ctx context.Context, filter any, update any, upsert bool, many bool) (*mongo.UpdateResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f, err := toFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	result := &mongo.UpdateResult{}
+	for i, doc := range c.docs {
+		ok, err := c.match(doc, f)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		result.MatchedCount++
+		updated := copyDocument(doc)
+		if err := applyUpdate(updated, update, false); err != nil {
+			return nil, err
+		}
+		if err := c.replaceAt(i, updated); err != nil {
+			return nil, err
+		}
+		if !valuesEqual(doc, updated) {
+			result.ModifiedCount++
+		}
+
+		if !many {
+			break
+		}
+	}
+
+	if result.MatchedCount == 0 && upsert {
+		doc, err := c.upsert(f, func(doc bson.M) error { return applyUpdate(doc, update, true) })
+		if err != nil {
+			return nil, err
+		}
+		result.UpsertedCount = 1
+		result.UpsertedID = doc["_id"]
+	}
+
+	return result, nil
+}
+
+func (c *memoryCollection) ReplaceOne(ctx context.Context, filter any, replacement any, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	opt := options.MergeReplaceOptions(opts...)
+	f, err := toFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	replace, err := toDocument(replacement)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkReplacement(replace); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	result := &mongo.UpdateResult{}
+	for i, doc := range c.docs {
+		ok, err := c.match(doc, f)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		updated := copyDocument(replace)
+		updated["_id"] = doc["_id"]
+		if err := c.replaceAt(i, updated); err != nil {
+			return nil, err
+		}
+		result.MatchedCount = 1
+		if !valuesEqual(doc, updated) {
+			result.ModifiedCount = 1
+		}
+		return result, nil
+	}
+
+	if opt.Upsert != nil && *opt.Upsert {
+		doc, err := c.upsert(f, func(doc bson.M) error {
+			for k, v := range replace {
+				doc[k] = v
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.UpsertedCount = 1
+		result.UpsertedID = doc["_id"]
+	}
+
+	return result, nil
+}
+
+func (c *memoryCollection) FindOneAndUpdate(ctx context.Context, filter any, update any, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+	if err := ctx.Err(); err != nil {
+		return singleResult(nil, err)
+	}
+
+	opt := options.MergeFindOneAndUpdateOptions(opts...)
+	f, err := toFilter(filter)
+	if err != nil {
+		return singleResult(nil, err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	index, err := c.first(f, opt.Sort)
+	if err != nil {
+		return singleResult(nil, err)
+	}
+
+	var before, after bson.M
+	if index >= 0 {
+		before = c.docs[index]
+		after = copyDocument(before)
+		if err := applyUpdate(after, update, false); err != nil {
+			return singleResult(nil, err)
+		}
+		if err := c.replaceAt(index, after); err != nil {
+			return singleResult(nil, err)
+		}
+	} else if opt.Upsert != nil && *opt.Upsert {
+		after, err = c.upsert(f, func(doc bson.M) error { return applyUpdate(doc, update, true) })
+		if err != nil {
+			return singleResult(nil, err)
+		}
+	}
+
+	result := before
+	if opt.ReturnDocument != nil && *opt.ReturnDocument == options.After {
+		result = after
+	}
+	if result == nil {
+		return singleResult(nil, nil)
+	}
+
+	result = copyDocument(result)
+	if opt.Projection != nil {
+		if result, err = projectDocument(result, opt.Projection); err != nil {
+			return singleResult(nil, err)
+		}
+	}
+	return singleResult([]bson.M{result}, nil)
+}
+
+func (c *memoryCollection) DeleteOne(ctx context.Context, filter any, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return c.delete(ctx, filter, false)
+}
+
+func (c *memoryCollection) DeleteMany(ctx context.Context, filter any, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return c.delete(ctx, filter, true)
+}
+
+func (c *memoryCollection) delete(ctx context.Context, filter any, many bool) (*mongo.DeleteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f, err := toFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	result := &mongo.DeleteResult{}
+	kept := c.docs[:0]
+	for _, doc := range c.docs {
+		if many || result.DeletedCount == 0 {
+			ok, err := c.match(doc, f)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				result.DeletedCount++
+				continue
+			}
+		}
+		kept = append(kept, doc)
+	}
+	c.docs = kept
+
+	return result, nil
+}
+
+func (c *memoryCollection) CountDocuments(ctx context.Context, filter any, opts ...*options.CountOptions) (int64, error) {
+	opt := options.MergeCountOptions(opts...)
+	docs, err := c.find(ctx, filter, nil, opt.Skip, opt.Limit, nil)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(docs)), nil
+}
+
+func (c *memoryCollection) Distinct(ctx context.Context, fieldName string, filter any, opts ...*options.DistinctOptions) ([]any, error) {
+	docs, err := c.find(ctx, filter, nil, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	values := []any{}
+	for _, doc := range docs {
+		for _, v := range expandArrays(resolvePath(doc, fieldName)) {
+			key := valueKey(v)
+			if !seen[key] {
+				seen[key] = true
+				values = append(values, v)
+			}
+		}
+	}
+	return values, nil
+}
+
+func (c *memoryCollection) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+	result := &mongo.BulkWriteResult{UpsertedIDs: map[int64]any{}}
+	for i, model := range models {
+		var err error
+		var updated *mongo.UpdateResult
+
+		switch m := model.(type) {
+		case *mongo.InsertOneModel:
+			_, err = c.InsertOne(ctx, m.Document)
+			if err == nil {
+				result.InsertedCount++
+			}
+		case *mongo.UpdateOneModel:
+			updated, err = c.update(ctx, m.Filter, m.Update, m.Upsert != nil && *m.Upsert, false)
+		case *mongo.UpdateManyModel:
+			updated, err = c.update(ctx, m.Filter, m.Update, m.Upsert != nil && *m.Upsert, true)
+		case *mongo.ReplaceOneModel:
+			opt := options.Replace()
+			if m.Upsert != nil {
+				opt.SetUpsert(*m.Upsert)
+			}
+			updated, err = c.ReplaceOne(ctx, m.Filter, m.Replacement, opt)
+		case *mongo.DeleteOneModel:
+			var deleted *mongo.DeleteResult
+			if deleted, err = c.delete(ctx, m.Filter, false); err == nil {
+				result.DeletedCount += deleted.DeletedCount
+			}
+		case *mongo.DeleteManyModel:
+			var deleted *mongo.DeleteResult
+			if deleted, err = c.delete(ctx, m.Filter, true); err == nil {
+				result.DeletedCount += deleted.DeletedCount
+			}
+		default:
+			err = fmt.Errorf("bulk write model %T is %w", model, ErrMemoryUnsupported)
+		}
+
+		if err != nil {
+			return result, err
+		}
+
+		if updated != nil {
+			result.MatchedCount += updated.MatchedCount
+			result.ModifiedCount += updated.ModifiedCount
+			result.UpsertedCount += updated.UpsertedCount
+			if updated.UpsertedID != nil {
+				result.UpsertedIDs[int64(i)] = updated.UpsertedID
+			}
+		}
+	}
+	return result, nil
+}
+
+func (c *memoryCollection) Aggregate(ctx context.Context, pipeline any, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+	docs, err := c.find(ctx, bson.M{}, nil, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	stages, err := toStages(pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err = runPipeline(c, docs, stages)
+	if err != nil {
+		return nil, err
+	}
+	return cursor(stripTextScore(docs))
+}
+
+func (c *memoryCollection) Watch(ctx context.Context, pipeline any, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	return nil, fmt.Errorf("change streams are %w", ErrMemoryUnsupported)
+}
+
+func (c *memoryCollection) CreateIndexes(ctx context.Context, models []mongo.IndexModel) ([]string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var names []string
+	for _, model := range models {
+		spec, err := specFromModel(model)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, spec.name)
+
+		if spec.weights != nil {
+			c.text = spec.weights
+		}
+		if !spec.unique {
+			continue
+		}
+		index := memoryIndex{name: spec.name, sparse: spec.sparse}
+		for _, k := range spec.keys {
+			if k.Key != "$text" {
+				index.keys = append(index.keys, k.Key)
+			}
+		}
+		c.uniques = append(c.uniques, index)
+	}
+	return names, nil
+}
+
+// callers hold the write lock
+func (c *memoryCollection) insert(doc bson.M) error {
+	if _, ok := doc["_id"]; !ok {
+		doc["_id"] = primitive.NewObjectID()
+	}
+	if err := c.checkUnique(doc, -1); err != nil {
+		return err
+	}
+	c.docs = append(c.docs, doc)
+	return nil
+}
+
+func (c *memoryCollection) replaceAt(index int, doc bson.M) error {
+	if !valuesEqual(c.docs[index]["_id"], doc["_id"]) {
+		return errors.New("performing an update on the path '_id' would modify the immutable field '_id'")
+	}
+	if err := c.checkUnique(doc, index); err != nil {
+		return err
+	}
+	c.docs[index] = doc
+	return nil
+}
+
+// the equality conditions of the filter are the base of the upserted document
+func (c *memoryCollection) upsert(filter bson.M, apply func(doc bson.M) error) (bson.M, error) {
+	doc := bson.M{}
+	for k, v := range filter {
+		if strings.HasPrefix(k, "$") {
+			continue
+		}
+		if ops, ok := v.(bson.M); ok && isOperatorDocument(ops) {
+			eq, ok := ops["$eq"]
+			if !ok {
+				continue
+			}
+			v = eq
+		}
+		if err := setPath(doc, k, v); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := apply(doc); err != nil {
+		return nil, err
+	}
+	if err := c.insert(doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (c *memoryCollection) first(filter bson.M, sortSpec any) (int, error) {
+	var matched []int
+	for i, doc := range c.docs {
+		ok, err := c.match(doc, filter)
+		if err != nil {
+			return -1, err
+		}
+		if ok {
+			matched = append(matched, i)
+		}
+	}
+
+	if len(matched) == 0 {
+		return -1, nil
+	}
+
+	if sortSpec != nil {
+		keys, err := toSortKeys(sortSpec)
+		if err != nil {
+			return -1, err
+		}
+		sort.SliceStable(matched, func(i, j int) bool {
+			return compareBySort(c.docs[matched[i]], c.docs[matched[j]], keys) < 0
+		})
+	}
+
+	return matched[0], nil
+}
+
+func (c *memoryCollection) checkUnique(doc bson.M, skip int) error {
+	indexes := append([]memoryIndex{{name: defaultIdIndexName, keys: []string{"_id"}}}, c.uniques...)
+	for _, index := range indexes {
+		key, ok := uniqueKey(doc, index)
+		if !ok {
+			continue
+		}
+		for i, other := range c.docs {
+			if i == skip {
+				continue
+			}
+			if otherKey, ok := uniqueKey(other, index); ok && otherKey == key {
+				return mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+					Code:    duplicateKeyCode,
+					Message: fmt.Sprintf("E11000 duplicate key error collection: %s index: %s", c.name, index.name),
+				}}}
+			}
+		}
+	}
+	return nil
+}
+
+func uniqueKey(doc bson.M, index memoryIndex) (string, bool) {
+	values := make(bson.A, len(index.keys))
+	present := false
+	for i, k := range index.keys {
+		resolved := resolvePath(doc, k)
+		if len(resolved) > 0 {
+			present = true
+			values[i] = resolved[0]
+		}
+	}
+	if index.sparse && !present {
+		return "", false
+	}
+	return valueKey(values), true
+}
+
+func checkReplacement(doc bson.M) error {
+	for k := range doc {
+		if strings.HasPrefix(k, "$") {
+			return fmt.Errorf("replacement document must not contain update operators: %s", k)
+		}
+	}
+	return nil
+}
+
+func singleResult(docs []bson.M, err error) *mongo.SingleResult {
+	if err == nil && len(docs) == 0 {
+		err = mongo.ErrNoDocuments
+	}
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.M{}, err, nil)
+	}
+	return mongo.NewSingleResultFromDocument(docs[0], nil, nil)
+}
+
+func cursor(docs []bson.M) (*mongo.Cursor, error) {
+	documents := make([]any, len(docs))
+	for i, doc := range docs {
+		documents[i] = doc
+	}
+	return mongo.NewCursorFromDocuments(documents, nil, nil)
+}
@@ -0,0 +1,613 @@
+package mongo
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// the value of $$REMOVE and of the missing fields in the expressions
+type removed struct{}
+
+func toStages(pipeline any) ([]bson.E, error) {
+	var raw []any
+	switch p := pipeline.(type) {
+	case mongo.Pipeline:
+		for _, s := range p {
+			raw = append(raw, s)
+		}
+	case []bson.D:
+		for _, s := range p {
+			raw = append(raw, s)
+		}
+	case []bson.M:
+		for _, s := range p {
+			raw = append(raw, s)
+		}
+	case bson.A:
+		raw = p
+	case []any:
+		raw = p
+	default:
+		return nil, fmt.Errorf("pipeline must be a list of stages, got %T", pipeline)
+	}
+
+	stages := make([]bson.E, len(raw))
+	for i, s := range raw {
+		var entries bson.D
+		switch stage := s.(type) {
+		case bson.D:
+			entries = stage
+		case bson.M:
+			entries = toD(stage)
+		}
+		if len(entries) != 1 {
+			return nil, fmt.Errorf("a pipeline stage must be a document with exactly one field")
+		}
+		stages[i] = entries[0]
+	}
+	return stages, nil
+}
+
+func runPipeline(c *memoryCollection, docs []bson.M, stages []bson.E) ([]bson.M, error) {
+	var err error
+	for _, stage := range stages {
+		if docs, err = runStage(c, docs, stage); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+// the stages of the Pipeline builder, the collection is nil for the update pipelines
+func runStage(c *memoryCollection, docs []bson.M, stage bson.E) ([]bson.M, error) {
+	switch stage.Key {
+	case "$sort":
+		return docs, sortDocuments(docs, stage.Value)
+	case "$lookup":
+		return lookupStage(c, docs, stage.Value)
+	case "$facet":
+		return facetStage(c, docs, stage.Value)
+	}
+
+	arg, err := canonical(stage.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch stage.Key {
+	case "$match":
+		filter, ok := arg.(bson.M)
+		if !ok {
+			return nil, fmt.Errorf("$match needs a document")
+		}
+		m := &matcher{}
+		if c != nil {
+			m.text = c.text
+		}
+		var result []bson.M
+		for _, doc := range docs {
+			ok, err := m.match(doc, filter)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			if search, ok := filter["$text"]; ok {
+				doc[textScoreKey], _ = m.textScore(doc, search)
+			}
+			result = append(result, doc)
+		}
+		return result, nil
+	case "$project":
+		return mapDocuments(docs, func(doc bson.M) (bson.M, error) {
+			return projectDocument(doc, arg)
+		})
+	case "$set":
+		fields, ok := arg.(bson.M)
+		if !ok {
+			return nil, fmt.Errorf("$set needs a document")
+		}
+		return mapDocuments(docs, func(doc bson.M) (bson.M, error) {
+			out := copyDocument(doc)
+			for _, k := range sortedKeys(fields) {
+				v, err := evaluate(fields[k], doc)
+				if err != nil {
+					return nil, err
+				}
+				if _, ok := v.(removed); ok {
+					unsetPath(out, k)
+				} else if err := setPath(out, k, v); err != nil {
+					return nil, err
+				}
+			}
+			return out, nil
+		})
+	case "$skip", "$limit":
+		n, ok := toInt64(arg)
+		if !ok || n < 0 {
+			return nil, fmt.Errorf("%s needs a non-negative integer", stage.Key)
+		}
+		if stage.Key == "$skip" {
+			if n >= int64(len(docs)) {
+				return nil, nil
+			}
+			return docs[n:], nil
+		}
+		if n < int64(len(docs)) {
+			return docs[:n], nil
+		}
+		return docs, nil
+	case "$count":
+		name, ok := arg.(string)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("$count needs a field name")
+		}
+		if len(docs) == 0 {
+			return nil, nil
+		}
+		return []bson.M{{name: int32(len(docs))}}, nil
+	case "$unwind":
+		return unwindStage(docs, arg)
+	case "$group":
+		spec, ok := arg.(bson.M)
+		if !ok {
+			return nil, fmt.Errorf("$group needs a document")
+		}
+		return groupStage(docs, spec)
+	}
+	return nil, fmt.Errorf("stage %s is %w", stage.Key, ErrMemoryUnsupported)
+}
+
+func mapDocuments(docs []bson.M, fn func(doc bson.M) (bson.M, error)) ([]bson.M, error) {
+	result := make([]bson.M, len(docs))
+	for i, doc := range docs {
+		out, err := fn(doc)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = out
+	}
+	return result, nil
+}
+
+func unwindStage(docs []bson.M, arg any) ([]bson.M, error) {
+	var path string
+	var preserve bool
+	switch spec := arg.(type) {
+	case string:
+		path = spec
+	case bson.M:
+		path, _ = spec["path"].(string)
+		preserve = truthy(spec["preserveNullAndEmptyArrays"])
+	}
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("$unwind path must start with $")
+	}
+	path = path[1:]
+
+	var result []bson.M
+	for _, doc := range docs {
+		v, _ := getPathValue(doc, path)
+		list, ok := v.(bson.A)
+		if !ok && v != nil {
+			list = bson.A{v}
+		}
+
+		if len(list) == 0 {
+			if preserve {
+				out := copyDocument(doc)
+				if ok {
+					unsetPath(out, path)
+				}
+				result = append(result, out)
+			}
+			continue
+		}
+
+		for _, e := range list {
+			out := copyDocument(doc)
+			if err := setPath(out, path, copyValue(e)); err != nil {
+				return nil, err
+			}
+			result = append(result, out)
+		}
+	}
+	return result, nil
+}
+
+// only the $sum accumulator, of numbers or of 1 to count
+func groupStage(docs []bson.M, spec bson.M) ([]bson.M, error) {
+	type group struct {
+		id   any
+		sums bson.M
+	}
+
+	fields := sortedKeys(spec)
+	var order []string
+	groups := map[string]*group{}
+
+	for _, doc := range docs {
+		id, err := evaluate(spec["_id"], doc)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := id.(removed); ok {
+			id = nil
+		}
+
+		key := valueKey(id)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{id: id, sums: bson.M{}}
+			groups[key] = g
+			order = append(order, key)
+		}
+
+		for _, f := range fields {
+			if f == "_id" {
+				continue
+			}
+			acc, ok := spec[f].(bson.M)
+			if !ok || len(acc) != 1 {
+				return nil, fmt.Errorf("the group field %s must specify one accumulator", f)
+			}
+			arg, ok := acc["$sum"]
+			if !ok {
+				return nil, fmt.Errorf("accumulator %s is %w", sortedKeys(acc)[0], ErrMemoryUnsupported)
+			}
+
+			if _, ok := g.sums[f]; !ok {
+				g.sums[f] = int32(0)
+			}
+			v, err := evaluate(arg, doc)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := toFloat(v); !ok {
+				continue
+			}
+			if g.sums[f], err = arithmetic("$add", g.sums[f], v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	result := make([]bson.M, 0, len(order))
+	for _, key := range order {
+		g := groups[key]
+		out := bson.M{"_id": g.id}
+		for f, sum := range g.sums {
+			out[f] = sum
+		}
+		result = append(result, out)
+	}
+	return result, nil
+}
+
+// the equality lookups, the pipeline lookups need a mongo server
+func lookupStage(c *memoryCollection, docs []bson.M, raw any) ([]bson.M, error) {
+	if c == nil {
+		return nil, fmt.Errorf("$lookup is not allowed in an update pipeline")
+	}
+	if stageField(raw, "pipeline") != nil {
+		return nil, fmt.Errorf("$lookup with a pipeline is %w", ErrMemoryUnsupported)
+	}
+
+	from, _ := stageField(raw, "from").(string)
+	as, _ := stageField(raw, "as").(string)
+	localField, _ := stageField(raw, "localField").(string)
+	foreignField, _ := stageField(raw, "foreignField").(string)
+	if from == "" || as == "" || localField == "" || foreignField == "" {
+		return nil, fmt.Errorf("$lookup needs from, localField, foreignField and as")
+	}
+
+	foreign, err := c.store.collection(from).snapshot(bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	return mapDocuments(docs, func(doc bson.M) (bson.M, error) {
+		list := bson.A{}
+		for _, f := range foreign {
+			if joinValuesMatch(doc, localField, f, foreignField) {
+				list = append(list, copyDocument(f))
+			}
+		}
+		out := copyDocument(doc)
+		return out, setPath(out, as, list)
+	})
+}
+
+func joinValuesMatch(local bson.M, localField string, foreign bson.M, foreignField string) bool {
+	values := func(doc bson.M, path string) []any {
+		v := expandArrays(resolvePath(doc, path))
+		if len(v) == 0 {
+			return []any{nil}
+		}
+		return v
+	}
+
+	for _, l := range values(local, localField) {
+		for _, f := range values(foreign, foreignField) {
+			if valuesEqual(l, f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func facetStage(c *memoryCollection, docs []bson.M, raw any) ([]bson.M, error) {
+	var facets bson.D
+	switch f := raw.(type) {
+	case bson.D:
+		facets = f
+	case bson.M:
+		facets = toD(f)
+	default:
+		return nil, fmt.Errorf("$facet needs a document")
+	}
+
+	out := bson.M{}
+	for _, facet := range facets {
+		stages, err := toStages(facet.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		input := make([]bson.M, len(docs))
+		for i, doc := range docs {
+			input[i] = copyDocument(doc)
+		}
+
+		result, err := runPipeline(c, input, stages)
+		if err != nil {
+			return nil, err
+		}
+
+		list := bson.A{}
+		for _, doc := range stripTextScore(result) {
+			list = append(list, doc)
+		}
+		out[facet.Key] = list
+	}
+	return []bson.M{out}, nil
+}
+
+func stageField(raw any, key string) any {
+	switch spec := raw.(type) {
+	case bson.D:
+		for _, e := range spec {
+			if e.Key == key {
+				return e.Value
+			}
+		}
+	case bson.M:
+		return spec[key]
+	}
+	return nil
+}
+
+func stripTextScore(docs []bson.M) []bson.M {
+	for _, doc := range docs {
+		delete(doc, textScoreKey)
+	}
+	return docs
+}
+
+// the find projections and the $project stage, both with inclusions, exclusions or expressions
+func projectDocument(doc bson.M, projection any) (bson.M, error) {
+	p, err := canonical(projection)
+	if err != nil {
+		return nil, err
+	}
+	spec, ok := p.(bson.M)
+	if !ok {
+		return nil, fmt.Errorf("projection must be a document")
+	}
+
+	isFlag := func(v any) bool {
+		if _, ok := v.(bool); ok {
+			return true
+		}
+		_, ok := toFloat(v)
+		return ok
+	}
+
+	inclusion, exclusion := false, false
+	for k, v := range spec {
+		if k == "_id" {
+			continue
+		}
+		if isFlag(v) && !truthy(v) {
+			exclusion = true
+		} else {
+			inclusion = true
+		}
+	}
+	if inclusion && exclusion {
+		return nil, fmt.Errorf("cannot do exclusion in an inclusion projection")
+	}
+
+	if exclusion {
+		out := copyDocument(doc)
+		for k, v := range spec {
+			if isFlag(v) && !truthy(v) {
+				unsetPath(out, k)
+			}
+		}
+		return out, nil
+	}
+
+	out := bson.M{}
+	if id, ok := spec["_id"]; !ok || (isFlag(id) && truthy(id)) {
+		if v, ok := doc["_id"]; ok {
+			out["_id"] = v
+		}
+	}
+
+	for _, k := range sortedKeys(spec) {
+		v := spec[k]
+		if isFlag(v) {
+			if k != "_id" && truthy(v) {
+				if value, ok := getPathValue(doc, k); ok {
+					if err := setPath(out, k, copyValue(value)); err != nil {
+						return nil, err
+					}
+				}
+			}
+			continue
+		}
+
+		value, err := evaluate(v, doc)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := value.(removed); ok {
+			continue
+		}
+		if err := setPath(out, k, value); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// the field paths and the operators used by the Pipeline builder, the version and the publication updates
+func evaluate(expr any, doc bson.M) (any, error) {
+	switch e := expr.(type) {
+	case string:
+		if strings.HasPrefix(e, "$$") {
+			return nil, fmt.Errorf("variable %s is %w", e, ErrMemoryUnsupported)
+		}
+		if strings.HasPrefix(e, "$") {
+			if v, ok := getField(doc, strings.Split(e[1:], ".")); ok {
+				return v, nil
+			}
+			return removed{}, nil
+		}
+		return e, nil
+	case bson.M:
+		if len(e) == 1 {
+			for op, arg := range e {
+				if strings.HasPrefix(op, "$") {
+					return evalOperator(op, arg, doc)
+				}
+			}
+		}
+		out := bson.M{}
+		for k, v := range e {
+			if strings.HasPrefix(k, "$") {
+				return nil, fmt.Errorf("an expression object must have exactly one operator: %s", k)
+			}
+			value, err := evaluate(v, doc)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := value.(removed); !ok {
+				out[k] = value
+			}
+		}
+		return out, nil
+	case bson.A:
+		return evalArgs(e, doc)
+	}
+	return expr, nil
+}
+
+// the paths through arrays collect the values of their documents
+func getField(v any, parts []string) (any, bool) {
+	if len(parts) == 0 {
+		return v, true
+	}
+
+	switch t := v.(type) {
+	case bson.M:
+		child, ok := t[parts[0]]
+		if !ok {
+			return nil, false
+		}
+		return getField(child, parts[1:])
+	case bson.A:
+		values := bson.A{}
+		for _, e := range t {
+			if _, ok := e.(bson.M); ok {
+				if value, ok := getField(e, parts); ok {
+					values = append(values, value)
+				}
+			}
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+func evalArgs(arg any, doc bson.M) (bson.A, error) {
+	list, ok := arg.(bson.A)
+	if !ok {
+		list = bson.A{arg}
+	}
+
+	args := make(bson.A, len(list))
+	for i, a := range list {
+		v, err := evaluate(a, doc)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := v.(removed); ok {
+			v = nil
+		}
+		args[i] = v
+	}
+	return args, nil
+}
+
+func evalOperator(op string, arg any, doc bson.M) (any, error) {
+	if op == "$literal" {
+		return arg, nil
+	}
+
+	args, err := evalArgs(arg, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "$ifNull":
+		for _, a := range args[:len(args)-1] {
+			if a != nil {
+				return a, nil
+			}
+		}
+		return args[len(args)-1], nil
+	case "$add":
+		var result any = int32(0)
+		for _, a := range args {
+			if a == nil {
+				return nil, nil
+			}
+			if result, err = arithmetic(op, result, a); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case "$concat":
+		var b strings.Builder
+		for _, a := range args {
+			if a == nil {
+				return nil, nil
+			}
+			s, ok := a.(string)
+			if !ok {
+				return nil, fmt.Errorf("$concat only supports strings, not %T", a)
+			}
+			b.WriteString(s)
+		}
+		return b.String(), nil
+	}
+	return nil, fmt.Errorf("expression %s is %w", op, ErrMemoryUnsupported)
+}
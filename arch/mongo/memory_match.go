@@ -0,0 +1,666 @@
+package mongo
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// holds the text search score of a document while it is sorted and projected
+const textScoreKey = "$textScore"
+
+type matcher struct {
+	text map[string]float64
+}
+
+func (m *matcher) match(doc bson.M, filter bson.M) (bool, error) {
+	for _, k := range sortedKeys(filter) {
+		cond := filter[k]
+
+		var ok bool
+		var err error
+		switch k {
+		case "$and", "$or", "$nor":
+			ok, err = m.matchLogical(doc, k, cond)
+		case "$text":
+			var score float64
+			if score, err = m.textScore(doc, cond); err == nil {
+				ok = score > 0
+			}
+		case "$comment":
+			ok = true
+		default:
+			if strings.HasPrefix(k, "$") {
+				return false, fmt.Errorf("query operator %s is %w", k, ErrMemoryUnsupported)
+			}
+			ok, err = m.matchField(resolvePath(doc, k), cond)
+		}
+
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (m *matcher) matchLogical(doc bson.M, op string, cond any) (bool, error) {
+	filters, ok := cond.(bson.A)
+	if !ok || len(filters) == 0 {
+		return false, fmt.Errorf("%s must be a nonempty array", op)
+	}
+
+	for _, f := range filters {
+		filter, ok := f.(bson.M)
+		if !ok {
+			return false, fmt.Errorf("%s entries must be documents", op)
+		}
+		matched, err := m.match(doc, filter)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case op == "$and" && !matched:
+			return false, nil
+		case op == "$or" && matched:
+			return true, nil
+		case op == "$nor" && matched:
+			return false, nil
+		}
+	}
+	return op != "$or", nil
+}
+
+func (m *matcher) matchField(values []any, cond any) (bool, error) {
+	ops, ok := cond.(bson.M)
+	if !ok || !isOperatorDocument(ops) {
+		return matchEq(values, cond), nil
+	}
+
+	for _, op := range sortedKeys(ops) {
+		if op == "$options" {
+			continue
+		}
+		ok, err := m.matchOperator(values, op, ops[op], ops)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (m *matcher) matchOperator(values []any, op string, arg any, ops bson.M) (bool, error) {
+	switch op {
+	case "$eq":
+		return matchEq(values, arg), nil
+	case "$ne":
+		return !matchEq(values, arg), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		return matchCompare(values, op, arg), nil
+	case "$in", "$nin":
+		list, ok := arg.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("%s needs an array", op)
+		}
+		in := false
+		for _, v := range list {
+			if matchEq(values, v) {
+				in = true
+				break
+			}
+		}
+		return in == (op == "$in"), nil
+	case "$exists":
+		return truthy(arg) == (len(values) > 0), nil
+	case "$regex":
+		re, err := toRegexp(arg, ops["$options"])
+		if err != nil {
+			return false, err
+		}
+		return matchRegexp(values, re), nil
+	case "$not":
+		if sub, ok := arg.(bson.M); ok {
+			matched, err := m.matchField(values, sub)
+			return !matched, err
+		}
+		if _, ok := arg.(primitive.Regex); ok {
+			return !matchEq(values, arg), nil
+		}
+		return false, fmt.Errorf("$not needs a regex or a document")
+	case "$size":
+		n, ok := toFloat(arg)
+		if !ok {
+			return false, fmt.Errorf("$size needs a number")
+		}
+		for _, v := range values {
+			if a, ok := v.(bson.A); ok && float64(len(a)) == n {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$all":
+		list, ok := arg.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("$all needs an array")
+		}
+		for _, v := range list {
+			if !matchEq(values, v) {
+				return false, nil
+			}
+		}
+		return len(list) > 0, nil
+	case "$elemMatch":
+		sub, ok := arg.(bson.M)
+		if !ok {
+			return false, fmt.Errorf("$elemMatch needs an object")
+		}
+		for _, v := range values {
+			a, ok := v.(bson.A)
+			if !ok {
+				continue
+			}
+			for _, e := range a {
+				var matched bool
+				var err error
+				if isOperatorDocument(sub) {
+					matched, err = m.matchField([]any{e}, sub)
+				} else if doc, ok := e.(bson.M); ok {
+					matched, err = m.match(doc, sub)
+				}
+				if err != nil {
+					return false, err
+				}
+				if matched {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("query operator %s is %w", op, ErrMemoryUnsupported)
+}
+
+// the text search matches any of the terms in the fields of the text index
+func (m *matcher) textScore(doc bson.M, cond any) (float64, error) {
+	if len(m.text) == 0 {
+		return 0, fmt.Errorf("text index required for $text query")
+	}
+
+	search, ok := cond.(bson.M)
+	if !ok {
+		return 0, fmt.Errorf("$text needs an object")
+	}
+	s, ok := search["$search"].(string)
+	if !ok {
+		return 0, fmt.Errorf("$text needs a $search string")
+	}
+	caseSensitive := truthy(search["$caseSensitive"])
+
+	var terms []string
+	for _, t := range tokenize(s, caseSensitive) {
+		if !strings.HasPrefix(t, "-") {
+			terms = append(terms, t)
+		}
+	}
+
+	score := 0.0
+	for field, weight := range m.text {
+		var values []any
+		if field == "$**" {
+			values = stringValues(doc)
+		} else {
+			values = expandArrays(resolvePath(doc, field))
+		}
+		for _, v := range values {
+			str, ok := v.(string)
+			if !ok {
+				continue
+			}
+			for _, word := range tokenize(str, caseSensitive) {
+				for _, t := range terms {
+					if word == t {
+						score += weight
+					}
+				}
+			}
+		}
+	}
+	return score, nil
+}
+
+func tokenize(s string, caseSensitive bool) []string {
+	if !caseSensitive {
+		s = strings.ToLower(s)
+	}
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	})
+}
+
+func stringValues(v any) []any {
+	var values []any
+	switch t := v.(type) {
+	case string:
+		values = append(values, t)
+	case bson.M:
+		for _, e := range t {
+			values = append(values, stringValues(e)...)
+		}
+	case bson.A:
+		for _, e := range t {
+			values = append(values, stringValues(e)...)
+		}
+	}
+	return values
+}
+
+// a field matches when its value or any element of its array value matches
+func candidates(values []any) []any {
+	result := make([]any, 0, len(values))
+	for _, v := range values {
+		result = append(result, v)
+		if a, ok := v.(bson.A); ok {
+			result = append(result, a...)
+		}
+	}
+	return result
+}
+
+func matchEq(values []any, cond any) bool {
+	if cond == nil && len(values) == 0 {
+		return true
+	}
+	if re, ok := cond.(primitive.Regex); ok {
+		compiled, err := toRegexp(re, nil)
+		return err == nil && matchRegexp(values, compiled)
+	}
+	for _, v := range candidates(values) {
+		if valuesEqual(v, cond) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchCompare(values []any, op string, arg any) bool {
+	if arg == nil {
+		return (op == "$gte" || op == "$lte") && matchEq(values, nil)
+	}
+	for _, v := range candidates(values) {
+		if typeRank(v) != typeRank(arg) {
+			continue
+		}
+		c := compareValues(v, arg)
+		if (op == "$gt" && c > 0) || (op == "$gte" && c >= 0) || (op == "$lt" && c < 0) || (op == "$lte" && c <= 0) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRegexp(values []any, re *regexp.Regexp) bool {
+	for _, v := range candidates(values) {
+		if s, ok := v.(string); ok && re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func toRegexp(pattern any, opts any) (*regexp.Regexp, error) {
+	var expr, flags string
+	switch p := pattern.(type) {
+	case string:
+		expr = p
+	case primitive.Regex:
+		expr, flags = p.Pattern, p.Options
+	default:
+		return nil, fmt.Errorf("$regex needs a string")
+	}
+	if o, ok := opts.(string); ok {
+		flags += o
+	}
+
+	var prefix string
+	for _, f := range flags {
+		if strings.ContainsRune("ims", f) && !strings.ContainsRune(prefix, f) {
+			prefix += string(f)
+		}
+	}
+	if prefix != "" {
+		expr = "(?" + prefix + ")" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+func isOperatorDocument(m bson.M) bool {
+	for k := range m {
+		if strings.HasPrefix(k, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+func truthy(v any) bool {
+	switch t := v.(type) {
+	case nil, removed:
+		return false
+	case bool:
+		return t
+	}
+	if n, ok := toFloat(v); ok {
+		return n != 0
+	}
+	return true
+}
+
+// the values at the path, following the documents inside arrays
+func resolvePath(doc bson.M, path string) []any {
+	return lookupPath(doc, strings.Split(path, "."))
+}
+
+func lookupPath(v any, parts []string) []any {
+	if len(parts) == 0 {
+		return []any{v}
+	}
+
+	switch t := v.(type) {
+	case bson.M:
+		child, ok := t[parts[0]]
+		if !ok {
+			return nil
+		}
+		return lookupPath(child, parts[1:])
+	case bson.A:
+		var values []any
+		if i, err := strconv.Atoi(parts[0]); err == nil {
+			if i >= 0 && i < len(t) {
+				values = append(values, lookupPath(t[i], parts[1:])...)
+			}
+			return values
+		}
+		for _, e := range t {
+			if _, ok := e.(bson.M); ok {
+				values = append(values, lookupPath(e, parts)...)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func expandArrays(values []any) []any {
+	var result []any
+	for _, v := range values {
+		if a, ok := v.(bson.A); ok {
+			result = append(result, a...)
+		} else {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// the bson comparison order of the types
+func typeRank(v any) int {
+	switch v.(type) {
+	case nil, primitive.Null, primitive.Undefined, removed:
+		return 1
+	case int, int32, int64, float32, float64:
+		return 2
+	case string, primitive.Symbol:
+		return 3
+	case bson.M:
+		return 4
+	case bson.A:
+		return 5
+	case primitive.Binary:
+		return 6
+	case primitive.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case primitive.DateTime, time.Time:
+		return 9
+	case primitive.Timestamp:
+		return 10
+	case primitive.Regex:
+		return 11
+	}
+	return 12
+}
+
+func compareValues(a, b any) int {
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+
+	switch x := a.(type) {
+	case string:
+		return strings.Compare(x, b.(string))
+	case primitive.Symbol:
+		return strings.Compare(string(x), string(b.(primitive.Symbol)))
+	case bson.M:
+		y := b.(bson.M)
+		xk, yk := sortedKeys(x), sortedKeys(y)
+		for i := 0; i < len(xk) && i < len(yk); i++ {
+			if c := strings.Compare(xk[i], yk[i]); c != 0 {
+				return c
+			}
+			if c := compareValues(x[xk[i]], y[yk[i]]); c != 0 {
+				return c
+			}
+		}
+		return len(xk) - len(yk)
+	case bson.A:
+		y := b.(bson.A)
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if c := compareValues(x[i], y[i]); c != 0 {
+				return c
+			}
+		}
+		return len(x) - len(y)
+	case primitive.Binary:
+		return bytes.Compare(x.Data, b.(primitive.Binary).Data)
+	case primitive.ObjectID:
+		y := b.(primitive.ObjectID)
+		return bytes.Compare(x[:], y[:])
+	case bool:
+		y := b.(bool)
+		if x == y {
+			return 0
+		}
+		if !x {
+			return -1
+		}
+		return 1
+	case primitive.Timestamp:
+		y := b.(primitive.Timestamp)
+		if x.T != y.T {
+			return compareNumbers(float64(x.T), float64(y.T))
+		}
+		return compareNumbers(float64(x.I), float64(y.I))
+	}
+
+	if ra == 1 {
+		return 0
+	}
+	if ra == 9 {
+		return compareNumbers(float64(toDateTime(a)), float64(toDateTime(b)))
+	}
+	if ia, ok := toInt64(a); ok {
+		if ib, ok := toInt64(b); ok {
+			switch {
+			case ia < ib:
+				return -1
+			case ia > ib:
+				return 1
+			}
+			return 0
+		}
+	}
+	if fa, ok := toFloat(a); ok {
+		fb, _ := toFloat(b)
+		return compareNumbers(fa, fb)
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func compareNumbers(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func valuesEqual(a, b any) bool {
+	return compareValues(a, b) == 0
+}
+
+// a key identifying equal values, used for the unique indexes and distinct values
+func valueKey(v any) string {
+	switch t := v.(type) {
+	case nil, primitive.Null, primitive.Undefined, removed:
+		return "null"
+	case string:
+		return strconv.Quote(t)
+	case bool:
+		return strconv.FormatBool(t)
+	case primitive.ObjectID:
+		return "ObjectId(" + t.Hex() + ")"
+	case primitive.DateTime, time.Time:
+		return fmt.Sprintf("Date(%d)", toDateTime(t))
+	case bson.M:
+		parts := make([]string, 0, len(t))
+		for _, k := range sortedKeys(t) {
+			parts = append(parts, strconv.Quote(k)+":"+valueKey(t[k]))
+		}
+		return "{" + strings.Join(parts, ",") + "}"
+	case bson.A:
+		parts := make([]string, len(t))
+		for i, e := range t {
+			parts[i] = valueKey(e)
+		}
+		return "[" + strings.Join(parts, ",") + "]"
+	}
+	if n, ok := toFloat(v); ok {
+		return strconv.FormatFloat(n, 'g', -1, 64)
+	}
+	return fmt.Sprintf("%T(%v)", v, v)
+}
+
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	}
+	return 0, false
+}
+
+func toDateTime(v any) primitive.DateTime {
+	switch t := v.(type) {
+	case primitive.DateTime:
+		return t
+	case time.Time:
+		return primitive.NewDateTimeFromTime(t)
+	}
+	return 0
+}
+
+type sortKey struct {
+	path string
+	desc bool
+	meta bool
+}
+
+func toSortKeys(spec any) ([]sortKey, error) {
+	var entries bson.D
+	switch s := spec.(type) {
+	case bson.D:
+		entries = s
+	case bson.M:
+		entries = toD(s)
+	case map[string]int:
+		m := bson.M{}
+		for k, v := range s {
+			m[k] = v
+		}
+		entries = toD(m)
+	default:
+		return nil, fmt.Errorf("sort must be a bson.D or bson.M, got %T", spec)
+	}
+
+	keys := make([]sortKey, 0, len(entries))
+	for _, e := range entries {
+		if meta, ok := e.Value.(bson.M); ok && meta["$meta"] == "textScore" {
+			keys = append(keys, sortKey{path: e.Key, desc: true, meta: true})
+			continue
+		}
+		dir, ok := toFloat(e.Value)
+		if !ok || (dir != 1 && dir != -1) {
+			return nil, fmt.Errorf("invalid sort direction %v for %s", e.Value, e.Key)
+		}
+		keys = append(keys, sortKey{path: e.Key, desc: dir < 0})
+	}
+	return keys, nil
+}
+
+func sortDocuments(docs []bson.M, spec any) error {
+	keys, err := toSortKeys(spec)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		return compareBySort(docs[i], docs[j], keys) < 0
+	})
+	return nil
+}
+
+func compareBySort(a, b bson.M, keys []sortKey) int {
+	for _, k := range keys {
+		c := compareValues(sortValue(a, k), sortValue(b, k))
+		if k.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// arrays sort by their smallest element ascending and by their largest descending
+func sortValue(doc bson.M, key sortKey) any {
+	if key.meta {
+		return doc[textScoreKey]
+	}
+
+	values := expandArrays(resolvePath(doc, key.path))
+	if len(values) == 0 {
+		return nil
+	}
+	value := values[0]
+	for _, v := range values[1:] {
+		c := compareValues(v, value)
+		if (key.desc && c > 0) || (!key.desc && c < 0) {
+			value = v
+		}
+	}
+	return value
+}
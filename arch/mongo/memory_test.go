@@ -0,0 +1,262 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongod "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type memoryPost struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Slug      string             `bson:"slug"`
+	Title     string             `bson:"title"`
+	Tags      []string           `bson:"tags"`
+	Views     int64              `bson:"views"`
+	Author    primitive.ObjectID `bson:"author"`
+	Version   int64              `bson:"version"`
+	CreatedAt time.Time          `bson:"createdAt"`
+}
+
+type memoryAuthor struct {
+	ID   primitive.ObjectID `bson:"_id,omitempty"`
+	Name string             `bson:"name"`
+}
+
+func newMemoryPosts(t *testing.T, posts ...*memoryPost) QueryBuilder[memoryPost] {
+	builder := NewQueryBuilder[memoryPost](NewMemoryDatabase(), "posts")
+	if len(posts) > 0 {
+		_, err := builder.SingleQuery().InsertMany(posts)
+		assert.NoError(t, err)
+	}
+	return builder
+}
+
+func TestMemory_InsertAndFind(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	builder := newMemoryPosts(t,
+		&memoryPost{Slug: "a", Title: "Go", Tags: []string{"go"}, Views: 3, CreatedAt: now},
+		&memoryPost{Slug: "b", Title: "Mongo", Tags: []string{"db", "go"}, Views: 7, CreatedAt: now.Add(time.Hour)},
+		&memoryPost{Slug: "c", Title: "Redis", Tags: []string{"db"}, Views: 5, CreatedAt: now.Add(2 * time.Hour)},
+	)
+
+	post, err := builder.SingleQuery().FindOne(bson.M{"slug": "a"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Go", post.Title)
+	assert.False(t, post.ID.IsZero())
+	assert.Equal(t, now, post.CreatedAt)
+
+	_, err = builder.SingleQuery().FindOne(bson.M{"slug": "x"}, nil)
+	assert.ErrorIs(t, err, mongod.ErrNoDocuments)
+
+	posts, err := builder.SingleQuery().FindAll(bson.M{"tags": "go", "views": bson.M{"$gte": 3}}, options.Find().SetSort(bson.D{{Key: "views", Value: -1}}))
+	assert.NoError(t, err)
+	assert.Len(t, posts, 2)
+	assert.Equal(t, "b", posts[0].Slug)
+
+	posts, err = builder.SingleQuery().FindPaginated(bson.M{}, 2, 2, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	assert.NoError(t, err)
+	assert.Len(t, posts, 1)
+	assert.Equal(t, "c", posts[0].Slug)
+
+	posts, err = builder.SingleQuery().FindAll(
+		bson.M{"$or": bson.A{bson.M{"tags": bson.M{"$in": bson.A{"db"}}}, bson.M{"title": bson.M{"$regex": "^g", "$options": "i"}}}},
+		options.Find().SetProjection(bson.M{"slug": 1}).SetSort(bson.D{{Key: "slug", Value: 1}}),
+	)
+	assert.NoError(t, err)
+	assert.Len(t, posts, 3)
+	assert.Equal(t, "a", posts[0].Slug)
+	assert.Empty(t, posts[0].Title)
+
+	count, err := builder.SingleQuery().CountDocuments(bson.M{"tags": bson.M{"$all": bson.A{"db", "go"}}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestMemory_Update(t *testing.T) {
+	builder := newMemoryPosts(t, &memoryPost{Slug: "a", Title: "Go", Tags: []string{"go"}})
+
+	result, err := builder.SingleQuery().UpdateOne(bson.M{"slug": "a"}, bson.M{
+		"$set":      bson.M{"title": "Go 1.22"},
+		"$inc":      bson.M{"views": 2},
+		"$addToSet": bson.M{"tags": bson.M{"$each": bson.A{"go", "gin"}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.ModifiedCount)
+
+	post, err := builder.SingleQuery().FindOneAndUpdate(bson.M{"slug": "a"}, bson.M{"$pull": bson.M{"tags": "go"}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Go 1.22", post.Title)
+	assert.Equal(t, int64(2), post.Views)
+	assert.Equal(t, []string{"gin"}, post.Tags)
+
+	result, err = builder.SingleQuery().UpsertOne(bson.M{"slug": "b"}, bson.M{
+		"$set":         bson.M{"title": "Mongo"},
+		"$setOnInsert": bson.M{"views": 1},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.UpsertedCount)
+
+	post, err = builder.SingleQuery().FindOne(bson.M{"slug": "b"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Mongo", post.Title)
+	assert.Equal(t, int64(1), post.Views)
+
+	deleted, err := builder.SingleQuery().DeleteMany(bson.M{"slug": bson.M{"$in": bson.A{"a", "b"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), deleted.DeletedCount)
+}
+
+func TestMemory_Versioned(t *testing.T) {
+	builder := newMemoryPosts(t, &memoryPost{Slug: "a", Title: "Go"})
+
+	post, err := builder.SingleQuery().FindOneAndUpdateVersioned(bson.M{"slug": "a"}, 0, bson.M{"$set": bson.M{"title": "Gin"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), post.Version)
+
+	pipeline := NewPipeline().Set(bson.M{"title": bson.M{"$concat": bson.A{"$title", "!"}}})
+	post, err = builder.SingleQuery().FindOneAndUpdateVersioned(bson.M{"slug": "a"}, 1, pipeline.Stages())
+	assert.NoError(t, err)
+	assert.Equal(t, "Gin!", post.Title)
+	assert.Equal(t, int64(2), post.Version)
+
+	_, err = builder.SingleQuery().UpdateOneVersioned(bson.M{"slug": "a"}, 1, bson.M{"$set": bson.M{"title": "Echo"}})
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	_, err = builder.SingleQuery().UpdateOneVersioned(bson.M{"slug": "x"}, 1, bson.M{"$set": bson.M{"title": "Echo"}})
+	assert.ErrorIs(t, err, mongod.ErrNoDocuments)
+}
+
+func TestMemory_UniqueIndex(t *testing.T) {
+	builder := newMemoryPosts(t)
+	err := builder.SingleQuery().CreateIndexes([]mongod.IndexModel{
+		{Keys: bson.D{{Key: "slug", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+	assert.NoError(t, err)
+
+	_, err = builder.SingleQuery().InsertOne(&memoryPost{Slug: "a"})
+	assert.NoError(t, err)
+
+	_, err = builder.SingleQuery().InsertOne(&memoryPost{Slug: "a"})
+	assert.True(t, mongod.IsDuplicateKeyError(err))
+
+	_, err = builder.SingleQuery().InsertOne(&memoryPost{Slug: "b"})
+	assert.NoError(t, err)
+
+	_, err = builder.SingleQuery().UpdateOne(bson.M{"slug": "b"}, bson.M{"$set": bson.M{"slug": "a"}})
+	assert.True(t, mongod.IsDuplicateKeyError(err))
+}
+
+func TestMemory_TextSearch(t *testing.T) {
+	builder := newMemoryPosts(t,
+		&memoryPost{Slug: "a", Title: "Learning Go generics"},
+		&memoryPost{Slug: "b", Title: "Go and Mongo with Go"},
+		&memoryPost{Slug: "c", Title: "Redis"},
+	)
+
+	_, err := builder.SingleQuery().FindAll(bson.M{"$text": bson.M{"$search": "go"}}, nil)
+	assert.Error(t, err)
+
+	err = builder.SingleQuery().CreateIndexes([]mongod.IndexModel{{Keys: bson.D{{Key: "title", Value: "text"}}}})
+	assert.NoError(t, err)
+
+	opts := options.Find().
+		SetProjection(bson.M{"slug": 1}).
+		SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}})
+	posts, err := builder.SingleQuery().FindAll(bson.M{"$text": bson.M{"$search": "GO"}}, opts)
+	assert.NoError(t, err)
+	assert.Len(t, posts, 2)
+	assert.Equal(t, "b", posts[0].Slug)
+}
+
+func TestMemory_AggregateAndDistinct(t *testing.T) {
+	db := NewMemoryDatabase()
+	authors := NewQueryBuilder[memoryAuthor](db, "authors")
+	alice, err := authors.SingleQuery().InsertOne(&memoryAuthor{Name: "alice"})
+	assert.NoError(t, err)
+
+	posts := NewQueryBuilder[memoryPost](db, "posts")
+	_, err = posts.SingleQuery().InsertMany([]*memoryPost{
+		{Slug: "a", Tags: []string{"go", "db"}, Views: 1, Author: *alice},
+		{Slug: "b", Tags: []string{"go"}, Views: 4, Author: *alice},
+		{Slug: "c", Tags: []string{"db"}, Views: 2},
+	})
+	assert.NoError(t, err)
+
+	type tagCount struct {
+		Tag   string `bson:"_id"`
+		Count int64  `bson:"count"`
+		Views int64  `bson:"views"`
+	}
+	pipeline := NewPipeline().
+		Unwind("$tags", false).
+		Group("$tags", bson.M{"count": bson.M{"$sum": 1}, "views": bson.M{"$sum": "$views"}}).
+		Sort(bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}})
+	counts, err := Aggregate[tagCount](posts.SingleQuery(), pipeline, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []*tagCount{{Tag: "db", Count: 2, Views: 3}, {Tag: "go", Count: 2, Views: 5}}, counts)
+
+	type authored struct {
+		Slug    string         `bson:"slug"`
+		Authors []memoryAuthor `bson:"authors"`
+	}
+	pipeline = NewPipeline().
+		Match(bson.M{"views": bson.M{"$gt": 1}}).
+		Lookup("authors", "author", "_id", "authors").
+		Sort(bson.D{{Key: "slug", Value: 1}})
+	joined, err := Aggregate[authored](posts.SingleQuery(), pipeline, nil)
+	assert.NoError(t, err)
+	assert.Len(t, joined, 2)
+	assert.Equal(t, "alice", joined[0].Authors[0].Name)
+	assert.Empty(t, joined[1].Authors)
+
+	type page struct {
+		Total []bson.M      `bson:"total"`
+		Data  []*memoryPost `bson:"data"`
+	}
+	pipeline = NewPipeline().Facet(map[string]Pipeline{
+		"total": NewPipeline().Count("count"),
+		"data":  NewPipeline().Sort(bson.D{{Key: "views", Value: -1}}).Limit(1),
+	})
+	pages, err := Aggregate[page](posts.SingleQuery(), pipeline, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), pages[0].Total[0]["count"])
+	assert.Equal(t, "b", pages[0].Data[0].Slug)
+
+	tags, err := Distinct[string](posts.SingleQuery(), "tags", bson.M{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"go", "db"}, tags)
+}
+
+func TestMemory_BulkWrite(t *testing.T) {
+	builder := newMemoryPosts(t, &memoryPost{Slug: "a"}, &memoryPost{Slug: "b"})
+
+	result, err := builder.SingleQuery().BulkWrite([]mongod.WriteModel{
+		mongod.NewUpdateOneModel().SetFilter(bson.M{"slug": "a"}).SetUpdate(bson.M{"$inc": bson.M{"views": 1}}),
+		mongod.NewUpdateOneModel().SetFilter(bson.M{"slug": "c"}).SetUpdate(bson.M{"$set": bson.M{"title": "C"}}).SetUpsert(true),
+		mongod.NewDeleteOneModel().SetFilter(bson.M{"slug": "b"}),
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.ModifiedCount)
+	assert.Equal(t, int64(1), result.UpsertedCount)
+	assert.Equal(t, int64(1), result.DeletedCount)
+
+	slugs, err := Distinct[string](builder.SingleQuery(), "slug", bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, slugs)
+}
+
+func TestMemory_Unsupported(t *testing.T) {
+	builder := newMemoryPosts(t, &memoryPost{Slug: "a"})
+
+	_, err := builder.SingleQuery().FindAll(bson.M{"title": bson.M{"$type": "string"}}, nil)
+	assert.ErrorIs(t, err, ErrMemoryUnsupported)
+
+	err = builder.Watch(context.Background(), WatchConfig{}, func(*ChangeEvent[memoryPost]) error { return nil })
+	assert.ErrorIs(t, err, ErrMemoryUnsupported)
+}
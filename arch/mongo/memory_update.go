@@ -0,0 +1,451 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// applies an update document or an update pipeline to the doc in place
+func applyUpdate(doc bson.M, update any, inserting bool) error {
+	if isPipeline(update) {
+		stages, err := toStages(update)
+		if err != nil {
+			return err
+		}
+		return applyPipelineUpdate(doc, stages)
+	}
+
+	u, err := toDocument(update)
+	if err != nil {
+		return err
+	}
+	if len(u) == 0 {
+		return errors.New("update document must not be empty")
+	}
+
+	for _, op := range sortedKeys(u) {
+		if !strings.HasPrefix(op, "$") {
+			return fmt.Errorf("update document requires atomic operators, found %s", op)
+		}
+		fields, ok := u[op].(bson.M)
+		if !ok {
+			return fmt.Errorf("modifier %s needs a document", op)
+		}
+		for _, path := range sortedKeys(fields) {
+			if path == "_id" && op != "$setOnInsert" && !(op == "$set" && inserting) {
+				return errors.New("performing an update on the path '_id' would modify the immutable field '_id'")
+			}
+			if err := applyOperator(doc, op, path, fields[path], inserting); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func applyOperator(doc bson.M, op string, path string, arg any, inserting bool) error {
+	current, exists := getPathValue(doc, path)
+
+	switch op {
+	case "$set":
+		return setPath(doc, path, arg)
+	case "$setOnInsert":
+		if inserting {
+			return setPath(doc, path, arg)
+		}
+		return nil
+	case "$unset":
+		unsetPath(doc, path)
+		return nil
+	case "$inc", "$mul":
+		if !exists || current == nil {
+			current = int32(0)
+			if op == "$mul" {
+				arg, _ = arithmetic("$multiply", int32(0), arg)
+			}
+		}
+		if _, ok := toFloat(current); !ok {
+			return fmt.Errorf("cannot apply %s to the non-numeric field %s", op, path)
+		}
+		expr := "$add"
+		if op == "$mul" {
+			expr = "$multiply"
+		}
+		result, err := arithmetic(expr, current, arg)
+		if err != nil {
+			return err
+		}
+		return setPath(doc, path, result)
+	case "$min", "$max":
+		c := compareValues(arg, current)
+		if !exists || (op == "$min" && c < 0) || (op == "$max" && c > 0) {
+			return setPath(doc, path, arg)
+		}
+		return nil
+	case "$currentDate":
+		var now any = primitive.NewDateTimeFromTime(time.Now())
+		if spec, ok := arg.(bson.M); ok && spec["$type"] == "timestamp" {
+			now = primitive.Timestamp{T: uint32(time.Now().Unix())}
+		}
+		return setPath(doc, path, now)
+	case "$rename":
+		to, ok := arg.(string)
+		if !ok {
+			return fmt.Errorf("$rename target of %s must be a string", path)
+		}
+		if !exists {
+			return nil
+		}
+		unsetPath(doc, path)
+		return setPath(doc, to, current)
+	case "$push", "$addToSet", "$pull", "$pullAll", "$pop":
+		list := bson.A{}
+		if exists && current != nil {
+			a, ok := current.(bson.A)
+			if !ok {
+				return fmt.Errorf("cannot apply %s to the non-array field %s", op, path)
+			}
+			list = append(list, a...)
+		} else if op != "$push" && op != "$addToSet" {
+			return nil
+		}
+
+		list, err := updateArray(op, list, arg)
+		if err != nil {
+			return err
+		}
+		return setPath(doc, path, list)
+	}
+	return fmt.Errorf("update operator %s is %w", op, ErrMemoryUnsupported)
+}
+
+func updateArray(op string, list bson.A, arg any) (bson.A, error) {
+	switch op {
+	case "$push":
+		each := bson.A{arg}
+		modifiers := bson.M{}
+		if spec, ok := arg.(bson.M); ok && spec["$each"] != nil {
+			if each, ok = spec["$each"].(bson.A); !ok {
+				return nil, errors.New("$each needs an array")
+			}
+			modifiers = spec
+		}
+
+		position := len(list)
+		if p, ok := toInt64(modifiers["$position"]); ok {
+			position = clampIndex(int(p), len(list))
+		}
+		list = append(list[:position], append(append(bson.A{}, each...), list[position:]...)...)
+
+		if n, ok := toInt64(modifiers["$slice"]); ok {
+			if n >= 0 && int(n) < len(list) {
+				list = list[:n]
+			} else if n < 0 && int(-n) < len(list) {
+				list = list[len(list)+int(n):]
+			}
+		}
+		return list, nil
+	case "$addToSet":
+		each := bson.A{arg}
+		if spec, ok := arg.(bson.M); ok && spec["$each"] != nil {
+			if each, ok = spec["$each"].(bson.A); !ok {
+				return nil, errors.New("$each needs an array")
+			}
+		}
+		for _, v := range each {
+			if !containsValue(list, v) {
+				list = append(list, v)
+			}
+		}
+		return list, nil
+	case "$pull", "$pullAll":
+		remove := func(v any) (bool, error) { return valuesEqual(v, arg), nil }
+		if op == "$pullAll" {
+			values, ok := arg.(bson.A)
+			if !ok {
+				return nil, errors.New("$pullAll needs an array")
+			}
+			remove = func(v any) (bool, error) { return containsValue(values, v), nil }
+		} else if cond, ok := arg.(bson.M); ok {
+			m := &matcher{}
+			remove = func(v any) (bool, error) {
+				if isOperatorDocument(cond) {
+					return m.matchField([]any{v}, cond)
+				}
+				if doc, ok := v.(bson.M); ok {
+					return m.match(doc, cond)
+				}
+				return false, nil
+			}
+		}
+
+		kept := bson.A{}
+		for _, v := range list {
+			removed, err := remove(v)
+			if err != nil {
+				return nil, err
+			}
+			if !removed {
+				kept = append(kept, v)
+			}
+		}
+		return kept, nil
+	case "$pop":
+		if len(list) == 0 {
+			return list, nil
+		}
+		if n, _ := toFloat(arg); n < 0 {
+			return list[1:], nil
+		}
+		return list[:len(list)-1], nil
+	}
+	return list, nil
+}
+
+func applyPipelineUpdate(doc bson.M, stages []bson.E) error {
+	result := doc
+	for _, stage := range stages {
+		switch stage.Key {
+		case "$set", "$addFields", "$unset", "$project", "$replaceRoot", "$replaceWith":
+		default:
+			return fmt.Errorf("stage %s is not allowed in an update pipeline", stage.Key)
+		}
+
+		docs, err := runStage(nil, []bson.M{result}, stage)
+		if err != nil {
+			return err
+		}
+		result = docs[0]
+	}
+
+	id := doc["_id"]
+	for k := range doc {
+		delete(doc, k)
+	}
+	for k, v := range result {
+		doc[k] = v
+	}
+	if _, ok := doc["_id"]; !ok && id != nil {
+		doc["_id"] = id
+	}
+	return nil
+}
+
+func isPipeline(v any) bool {
+	switch v.(type) {
+	case mongo.Pipeline, []bson.D, []bson.M, bson.A, []any:
+		return true
+	}
+	return false
+}
+
+func containsValue(list bson.A, v any) bool {
+	for _, e := range list {
+		if valuesEqual(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func clampIndex(i int, length int) int {
+	if i < 0 {
+		i += length
+	}
+	return int(math.Max(0, math.Min(float64(i), float64(length))))
+}
+
+// the numbers keep the narrowest integer type that holds the result like mongo does
+func arithmetic(op string, a, b any) (any, error) {
+	if op != "$divide" {
+		if x, ok := toInt64(a); ok {
+			if y, ok := toInt64(b); ok {
+				var r int64
+				switch op {
+				case "$add":
+					r = x + y
+				case "$subtract":
+					r = x - y
+				case "$multiply":
+					r = x * y
+				}
+				_, a32 := a.(int32)
+				_, b32 := b.(int32)
+				if a32 && b32 && r >= math.MinInt32 && r <= math.MaxInt32 {
+					return int32(r), nil
+				}
+				return r, nil
+			}
+		}
+	}
+
+	x, okx := toFloat(a)
+	y, oky := toFloat(b)
+	if !okx || !oky {
+		return nil, fmt.Errorf("%s only supports numeric types, not %T and %T", op, a, b)
+	}
+	switch op {
+	case "$add":
+		return x + y, nil
+	case "$subtract":
+		return x - y, nil
+	case "$multiply":
+		return x * y, nil
+	}
+	if y == 0 {
+		return nil, errors.New("can't $divide by zero")
+	}
+	return x / y, nil
+}
+
+func setPath(doc bson.M, path string, v any) error {
+	_, err := setValue(doc, strings.Split(path, "."), v)
+	return err
+}
+
+func setValue(current any, parts []string, v any) (any, error) {
+	if len(parts) == 0 {
+		return v, nil
+	}
+
+	switch t := current.(type) {
+	case nil:
+		return setValue(bson.M{}, parts, v)
+	case bson.M:
+		child, err := setValue(t[parts[0]], parts[1:], v)
+		if err != nil {
+			return nil, err
+		}
+		t[parts[0]] = child
+		return t, nil
+	case bson.A:
+		i, err := strconv.Atoi(parts[0])
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("cannot create field %q in an array", parts[0])
+		}
+		for len(t) <= i {
+			t = append(t, nil)
+		}
+		if t[i], err = setValue(t[i], parts[1:], v); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("cannot create field %q in element %v", parts[0], current)
+}
+
+func unsetPath(doc bson.M, path string) {
+	parts := strings.Split(path, ".")
+	var current any = doc
+	for i, p := range parts {
+		last := i == len(parts)-1
+		switch t := current.(type) {
+		case bson.M:
+			if last {
+				delete(t, p)
+				return
+			}
+			current = t[p]
+		case bson.A:
+			n, err := strconv.Atoi(p)
+			if err != nil || n < 0 || n >= len(t) {
+				return
+			}
+			if last {
+				t[n] = nil
+				return
+			}
+			current = t[n]
+		default:
+			return
+		}
+	}
+}
+
+// the value at the exact path, arrays are only entered with an index
+func getPathValue(doc bson.M, path string) (any, bool) {
+	var current any = doc
+	for _, p := range strings.Split(path, ".") {
+		switch t := current.(type) {
+		case bson.M:
+			v, ok := t[p]
+			if !ok {
+				return nil, false
+			}
+			current = v
+		case bson.A:
+			n, err := strconv.Atoi(p)
+			if err != nil || n < 0 || n >= len(t) {
+				return nil, false
+			}
+			current = t[n]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// documents are kept as they would come back from mongo e.g. nested bson.M, bson.A and int32
+func toDocument(v any) (bson.M, error) {
+	if v == nil {
+		return nil, errors.New("document must not be nil")
+	}
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.M{}
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func toFilter(filter any) (bson.M, error) {
+	if filter == nil {
+		return bson.M{}, nil
+	}
+	return toDocument(filter)
+}
+
+func canonical(v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	doc, err := toDocument(bson.M{"v": v})
+	if err != nil {
+		return nil, err
+	}
+	return doc["v"], nil
+}
+
+func copyDocument(doc bson.M) bson.M {
+	return copyValue(doc).(bson.M)
+}
+
+func copyValue(v any) any {
+	switch t := v.(type) {
+	case bson.M:
+		c := make(bson.M, len(t))
+		for k, e := range t {
+			c[k] = copyValue(e)
+		}
+		return c
+	case bson.A:
+		c := make(bson.A, len(t))
+		for i, e := range t {
+			c[i] = copyValue(e)
+		}
+		return c
+	}
+	return v
+}
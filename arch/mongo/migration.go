@@ -0,0 +1,298 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	MigrationsCollectionName     = "migrations"
+	MigrationsLockCollectionName = "migrations_lock"
+	migrationsLockId             = "migrations"
+)
+
+var (
+	ErrMigrationLocked   = errors.New("migrations are locked by another runner")
+	ErrMigrationLockLost = errors.New("migration lock was lost")
+)
+
+type MigrationFunc = func(ctx context.Context, db Database) error
+
+type Migration struct {
+	Version     uint
+	Description string
+	Up          MigrationFunc
+	Down        MigrationFunc
+}
+
+type MigrationRecord struct {
+	Version     uint      `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+}
+
+type MigrationStatus struct {
+	Version     uint
+	Description string
+	Applied     bool
+	AppliedAt   *time.Time
+}
+
+type Migrator interface {
+	Up(ctx context.Context) error
+	Down(ctx context.Context, steps int) error
+	Status(ctx context.Context) ([]*MigrationStatus, error)
+}
+
+type migrator struct {
+	db         Database
+	migrations []Migration
+	owner      string
+	lockTTL    time.Duration
+	lockPoll   time.Duration
+}
+
+func NewMigrator(db Database, migrations []Migration) Migrator {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	host, _ := os.Hostname()
+
+	return &migrator{
+		db:         db,
+		migrations: sorted,
+		owner:      fmt.Sprintf("%s:%d:%d", host, os.Getpid(), time.Now().UnixNano()),
+		lockTTL:    10 * time.Minute,
+		lockPoll:   time.Second,
+	}
+}
+
+func (m *migrator) Up(ctx context.Context) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+
+	return m.locked(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			fmt.Printf("migrating up %d: %s\n", migration.Version, migration.Description)
+			if err := migration.Up(ctx, m.db); err != nil {
+				return fmt.Errorf("migration %d failed: %w", migration.Version, err)
+			}
+
+			record := MigrationRecord{
+				Version:     migration.Version,
+				Description: migration.Description,
+				AppliedAt:   time.Now(),
+			}
+			if _, err := m.records().InsertOne(ctx, record); err != nil {
+				return fmt.Errorf("migration %d could not be recorded: %w", migration.Version, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (m *migrator) Down(ctx context.Context, steps int) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+
+	return m.locked(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			if migration.Down == nil {
+				return fmt.Errorf("migration %d is irreversible", migration.Version)
+			}
+
+			fmt.Printf("migrating down %d: %s\n", migration.Version, migration.Description)
+			if err := migration.Down(ctx, m.db); err != nil {
+				return fmt.Errorf("migration %d rollback failed: %w", migration.Version, err)
+			}
+
+			if _, err := m.records().DeleteOne(ctx, bson.M{"_id": migration.Version}); err != nil {
+				return fmt.Errorf("migration %d rollback could not be recorded: %w", migration.Version, err)
+			}
+			steps--
+		}
+
+		return nil
+	})
+}
+
+func (m *migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		status := &MigrationStatus{
+			Version:     migration.Version,
+			Description: migration.Description,
+		}
+		if record, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &record.AppliedAt
+		}
+		statuses[i] = status
+	}
+
+	return statuses, nil
+}
+
+func (m *migrator) validate() error {
+	for i, migration := range m.migrations {
+		if migration.Version == 0 {
+			return errors.New("migration version must be greater than 0")
+		}
+		if migration.Up == nil {
+			return fmt.Errorf("migration %d has no up function", migration.Version)
+		}
+		if i > 0 && m.migrations[i-1].Version == migration.Version {
+			return fmt.Errorf("migration %d is declared more than once", migration.Version)
+		}
+	}
+	return nil
+}
+
+func (m *migrator) applied(ctx context.Context) (map[uint]*MigrationRecord, error) {
+	cursor, err := m.records().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("error executing query: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var records []*MigrationRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("error decoding result: %w", err)
+	}
+
+	applied := make(map[uint]*MigrationRecord, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// the lock is renewed while run is migrating, run is cancelled if it is lost so that no other runner migrates too
+func (m *migrator) locked(ctx context.Context, run func(ctx context.Context) error) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.unlock()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go m.renew(ctx, cancel)
+
+	err := run(ctx)
+	if cause := context.Cause(ctx); errors.Is(cause, ErrMigrationLockLost) {
+		return fmt.Errorf("%w: %v", cause, err)
+	}
+	return err
+}
+
+// the lock is deemed lost once it could not be renewed for lockTTL, another runner may have taken it
+func (m *migrator) renew(ctx context.Context, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(m.lockTTL / 3)
+	defer ticker.Stop()
+	renewed := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		filter := bson.M{"_id": migrationsLockId, "owner": m.owner}
+		update := bson.M{"$set": bson.M{"expiresAt": now.Add(m.lockTTL)}}
+		result, err := m.lockCollection().UpdateOne(ctx, filter, update)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err == nil && result.MatchedCount == 0:
+			cancel(ErrMigrationLockLost)
+			return
+		case err == nil:
+			renewed = now
+		case now.Sub(renewed) >= m.lockTTL:
+			cancel(fmt.Errorf("%w: %v", ErrMigrationLockLost, err))
+			return
+		default:
+			fmt.Println("error renewing migration lock:", err)
+		}
+	}
+}
+
+// waits for the lock held by other runners until it is released, expired or ctx is done
+func (m *migrator) lock(ctx context.Context) error {
+	for {
+		now := time.Now()
+		filter := bson.M{"_id": migrationsLockId, "expiresAt": bson.M{"$lt": now}}
+		// the upsert takes the _id from the filter
+		update := bson.M{"$set": bson.M{"owner": m.owner, "expiresAt": now.Add(m.lockTTL)}}
+		_, err := m.lockCollection().UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if err == nil {
+			return nil
+		}
+
+		if !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("error acquiring migration lock: %w", err)
+		}
+
+		fmt.Println("waiting for migration lock...")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %v", ErrMigrationLocked, ctx.Err())
+		case <-time.After(m.lockPoll):
+		}
+	}
+}
+
+func (m *migrator) unlock() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	filter := bson.M{"_id": migrationsLockId, "owner": m.owner}
+	if _, err := m.lockCollection().DeleteOne(ctx, filter); err != nil {
+		fmt.Println("error releasing migration lock:", err)
+	}
+}
+
+func (m *migrator) records() collection {
+	return m.db.GetInstance().collection(MigrationsCollectionName)
+}
+
+func (m *migrator) lockCollection() collection {
+	return m.db.GetInstance().collection(MigrationsLockCollectionName)
+}
@@ -0,0 +1,170 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type migrationLog struct {
+	mutex sync.Mutex
+	steps []string
+}
+
+func (l *migrationLog) step(name string) MigrationFunc {
+	return func(ctx context.Context, db Database) error {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		l.steps = append(l.steps, name)
+		return nil
+	}
+}
+
+func newTestMigrator(db Database, migrations []Migration) *migrator {
+	m := NewMigrator(db, migrations).(*migrator)
+	m.lockTTL = 60 * time.Millisecond
+	m.lockPoll = 5 * time.Millisecond
+	return m
+}
+
+func appliedVersions(t *testing.T, m Migrator) []uint {
+	statuses, err := m.Status(context.Background())
+	assert.NoError(t, err)
+	var versions []uint
+	for _, s := range statuses {
+		if s.Applied {
+			versions = append(versions, s.Version)
+		}
+	}
+	return versions
+}
+
+func TestMigrator_UpInVersionOrder(t *testing.T) {
+	db := NewMemoryDatabase()
+	log := &migrationLog{}
+	migrations := []Migration{
+		{Version: 3, Description: "third", Up: log.step("up 3")},
+		{Version: 1, Description: "first", Up: log.step("up 1")},
+		{Version: 2, Description: "second", Up: log.step("up 2")},
+	}
+
+	m := newTestMigrator(db, migrations)
+	assert.NoError(t, m.Up(context.Background()))
+	assert.Equal(t, []string{"up 1", "up 2", "up 3"}, log.steps)
+	assert.Equal(t, []uint{1, 2, 3}, appliedVersions(t, m))
+
+	// the recorded versions are not applied again
+	migrations = append(migrations, Migration{Version: 4, Description: "fourth", Up: log.step("up 4")})
+	m = newTestMigrator(db, migrations)
+	assert.NoError(t, m.Up(context.Background()))
+	assert.Equal(t, []string{"up 1", "up 2", "up 3", "up 4"}, log.steps)
+	assert.Equal(t, []uint{1, 2, 3, 4}, appliedVersions(t, m))
+}
+
+func TestMigrator_UpStopsAtFailure(t *testing.T) {
+	m := newTestMigrator(NewMemoryDatabase(), []Migration{
+		{Version: 1, Up: func(ctx context.Context, db Database) error { return nil }},
+		{Version: 2, Up: func(ctx context.Context, db Database) error { return errors.New("boom") }},
+		{Version: 3, Up: func(ctx context.Context, db Database) error { return nil }},
+	})
+
+	err := m.Up(context.Background())
+	assert.ErrorContains(t, err, "migration 2 failed")
+	assert.Equal(t, []uint{1}, appliedVersions(t, m))
+}
+
+func TestMigrator_Down(t *testing.T) {
+	log := &migrationLog{}
+	m := newTestMigrator(NewMemoryDatabase(), []Migration{
+		{Version: 1, Up: log.step("up 1")},
+		{Version: 2, Up: log.step("up 2"), Down: log.step("down 2")},
+		{Version: 3, Up: log.step("up 3"), Down: log.step("down 3")},
+	})
+	assert.NoError(t, m.Up(context.Background()))
+
+	assert.NoError(t, m.Down(context.Background(), 2))
+	assert.Equal(t, []string{"up 1", "up 2", "up 3", "down 3", "down 2"}, log.steps)
+	assert.Equal(t, []uint{1}, appliedVersions(t, m))
+
+	err := m.Down(context.Background(), 1)
+	assert.ErrorContains(t, err, "migration 1 is irreversible")
+	assert.Equal(t, []uint{1}, appliedVersions(t, m))
+}
+
+func TestMigrator_Validate(t *testing.T) {
+	noop := func(ctx context.Context, db Database) error { return nil }
+
+	err := newTestMigrator(NewMemoryDatabase(), []Migration{{Version: 0, Up: noop}}).Up(context.Background())
+	assert.ErrorContains(t, err, "greater than 0")
+
+	err = newTestMigrator(NewMemoryDatabase(), []Migration{{Version: 1, Up: noop}, {Version: 1, Up: noop}}).Up(context.Background())
+	assert.ErrorContains(t, err, "declared more than once")
+
+	err = newTestMigrator(NewMemoryDatabase(), []Migration{{Version: 1}}).Up(context.Background())
+	assert.ErrorContains(t, err, "no up function")
+}
+
+func TestMigrator_LockContention(t *testing.T) {
+	db := NewMemoryDatabase()
+	other := newTestMigrator(db, nil)
+	assert.NoError(t, other.lock(context.Background()))
+
+	m := newTestMigrator(db, []Migration{{Version: 1, Up: func(ctx context.Context, db Database) error { return nil }}})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, m.Up(ctx), ErrMigrationLocked)
+	assert.Empty(t, appliedVersions(t, m))
+
+	// taken over once the lock of the other runner expires
+	assert.NoError(t, m.Up(context.Background()))
+	assert.Equal(t, []uint{1}, appliedVersions(t, m))
+}
+
+func TestMigrator_LockRenewedWhileMigrating(t *testing.T) {
+	db := NewMemoryDatabase()
+	started := make(chan struct{})
+	m := newTestMigrator(db, []Migration{{Version: 1, Up: func(ctx context.Context, db Database) error {
+		close(started)
+		// runs for more than twice the lock ttl
+		select {
+		case <-time.After(150 * time.Millisecond):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}}})
+
+	done := make(chan error, 1)
+	go func() { done <- m.Up(context.Background()) }()
+	<-started
+
+	other := newTestMigrator(db, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, other.lock(ctx), ErrMigrationLocked)
+
+	assert.NoError(t, <-done)
+	assert.Equal(t, []uint{1}, appliedVersions(t, m))
+}
+
+func TestMigrator_LockLostCancelsMigration(t *testing.T) {
+	db := NewMemoryDatabase()
+	m := newTestMigrator(db, []Migration{{Version: 1, Up: func(ctx context.Context, db Database) error {
+		// another runner took the lock e.g. after a long pause of this process
+		_, err := db.GetInstance().collection(MigrationsLockCollectionName).UpdateOne(ctx,
+			bson.M{"_id": migrationsLockId}, bson.M{"$set": bson.M{"owner": "other"}})
+		if err != nil {
+			return err
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}}})
+
+	assert.ErrorIs(t, m.Up(context.Background()), ErrMigrationLockLost)
+	assert.Empty(t, appliedVersions(t, m))
+}
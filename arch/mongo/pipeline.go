@@ -0,0 +1,138 @@
+package mongo
+
+import (
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Pipeline interface {
+	Match(filter bson.M) Pipeline
+	Lookup(from string, localField string, foreignField string, as string) Pipeline
+	LookupPipeline(from string, let bson.M, pipeline Pipeline, as string) Pipeline
+	Unwind(path string, preserveNullAndEmpty bool) Pipeline
+	Group(id any, accumulators bson.M) Pipeline
+	Project(projection bson.D) Pipeline
+	Set(fields bson.M) Pipeline
+	Sort(sort bson.D) Pipeline
+	Skip(skip int64) Pipeline
+	Limit(limit int64) Pipeline
+	Count(field string) Pipeline
+	Facet(facets map[string]Pipeline) Pipeline
+	Stage(stage bson.D) Pipeline
+	Stages() mongo.Pipeline
+}
+
+type pipeline struct {
+	stages mongo.Pipeline
+}
+
+func NewPipeline() Pipeline {
+	return &pipeline{
+		stages: mongo.Pipeline{},
+	}
+}
+
+func (p *pipeline) Match(filter bson.M) Pipeline {
+	return p.Stage(bson.D{{Key: "$match", Value: filter}})
+}
+
+func (p *pipeline) Lookup(from string, localField string, foreignField string, as string) Pipeline {
+	return p.Stage(bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: from},
+		{Key: "localField", Value: localField},
+		{Key: "foreignField", Value: foreignField},
+		{Key: "as", Value: as},
+	}}})
+}
+
+/*
+ * Example -> let := bson.M{"authorId": "$author"}
+ * pipeline := NewPipeline().Match(bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$authorId"}}})
+ */
+func (p *pipeline) LookupPipeline(from string, let bson.M, pipeline Pipeline, as string) Pipeline {
+	return p.Stage(bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: from},
+		{Key: "let", Value: let},
+		{Key: "pipeline", Value: pipeline.Stages()},
+		{Key: "as", Value: as},
+	}}})
+}
+
+func (p *pipeline) Unwind(path string, preserveNullAndEmpty bool) Pipeline {
+	return p.Stage(bson.D{{Key: "$unwind", Value: bson.D{
+		{Key: "path", Value: path},
+		{Key: "preserveNullAndEmptyArrays", Value: preserveNullAndEmpty},
+	}}})
+}
+
+/*
+ * Example -> Group("$tags", bson.M{"count": bson.M{"$sum": 1}})
+ */
+func (p *pipeline) Group(id any, accumulators bson.M) Pipeline {
+	group := bson.D{{Key: "_id", Value: id}}
+	for _, k := range sortedKeys(accumulators) {
+		group = append(group, bson.E{Key: k, Value: accumulators[k]})
+	}
+	return p.Stage(bson.D{{Key: "$group", Value: group}})
+}
+
+func (p *pipeline) Project(projection bson.D) Pipeline {
+	return p.Stage(bson.D{{Key: "$project", Value: projection}})
+}
+
+/*
+ * Example -> Set(bson.M{"text": "$draftText"}) also usable as an update pipeline
+ */
+func (p *pipeline) Set(fields bson.M) Pipeline {
+	return p.Stage(bson.D{{Key: "$set", Value: fields}})
+}
+
+func (p *pipeline) Sort(sort bson.D) Pipeline {
+	return p.Stage(bson.D{{Key: "$sort", Value: sort}})
+}
+
+func (p *pipeline) Skip(skip int64) Pipeline {
+	return p.Stage(bson.D{{Key: "$skip", Value: skip}})
+}
+
+func (p *pipeline) Limit(limit int64) Pipeline {
+	return p.Stage(bson.D{{Key: "$limit", Value: limit}})
+}
+
+func (p *pipeline) Count(field string) Pipeline {
+	return p.Stage(bson.D{{Key: "$count", Value: field}})
+}
+
+func (p *pipeline) Facet(facets map[string]Pipeline) Pipeline {
+	names := make([]string, 0, len(facets))
+	for name := range facets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	facet := bson.D{}
+	for _, name := range names {
+		facet = append(facet, bson.E{Key: name, Value: facets[name].Stages()})
+	}
+	return p.Stage(bson.D{{Key: "$facet", Value: facet}})
+}
+
+func (p *pipeline) Stage(stage bson.D) Pipeline {
+	p.stages = append(p.stages, stage)
+	return p
+}
+
+func (p *pipeline) Stages() mongo.Pipeline {
+	return p.stages
+}
+
+func sortedKeys(m bson.M) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,55 @@
+package mongo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPipeline_Stages(t *testing.T) {
+	p := NewPipeline().
+		Match(bson.M{"status": true}).
+		Unwind("$tags", false).
+		Group("$tags", bson.M{"count": bson.M{"$sum": 1}}).
+		Sort(bson.D{{Key: "count", Value: -1}}).
+		Skip(10).
+		Limit(5)
+
+	stages := p.Stages()
+	assert.Len(t, stages, 6)
+	assert.Equal(t, "$match", stages[0][0].Key)
+	assert.Equal(t, "$unwind", stages[1][0].Key)
+	assert.Equal(t, bson.D{{Key: "_id", Value: "$tags"}, {Key: "count", Value: bson.M{"$sum": 1}}}, stages[2][0].Value)
+	assert.Equal(t, "$sort", stages[3][0].Key)
+	assert.Equal(t, bson.D{{Key: "$skip", Value: int64(10)}}, stages[4])
+	assert.Equal(t, bson.D{{Key: "$limit", Value: int64(5)}}, stages[5])
+}
+
+func TestPipeline_Lookup(t *testing.T) {
+	p := NewPipeline().Lookup("users", "author", "_id", "author")
+
+	lookup := p.Stages()[0][0]
+	assert.Equal(t, "$lookup", lookup.Key)
+	assert.Equal(t, bson.D{
+		{Key: "from", Value: "users"},
+		{Key: "localField", Value: "author"},
+		{Key: "foreignField", Value: "_id"},
+		{Key: "as", Value: "author"},
+	}, lookup.Value)
+}
+
+func TestPipeline_Facet(t *testing.T) {
+	p := NewPipeline().Facet(map[string]Pipeline{
+		"total": NewPipeline().Count("count"),
+		"items": NewPipeline().Limit(2),
+	})
+
+	facet := p.Stages()[0][0]
+	assert.Equal(t, "$facet", facet.Key)
+
+	value := facet.Value.(bson.D)
+	assert.Equal(t, "items", value[0].Key)
+	assert.Equal(t, "total", value[1].Key)
+	assert.Len(t, value[1].Value, 1)
+}
@@ -0,0 +1,149 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// logs the operations slower than the SlowQueryThreshold and explains each query shape once when enabled
+// find and aggregate are timed until the cursor returns the first batch, the getMore of the next batches are not
+type profiledCollection struct {
+	collection
+	db *database
+}
+
+func newProfiledCollection(c collection, db *database) collection {
+	return &profiledCollection{collection: c, db: db}
+}
+
+func (c *profiledCollection) observe(op string, filter any, sort bson.D, start time.Time) {
+	duration := time.Since(start)
+	if threshold := c.db.config.SlowQueryThreshold; threshold > 0 && duration >= threshold {
+		fmt.Println(slowQueryMessage(c.Name(), op, filter, duration))
+	}
+
+	if c.db.config.Explain && c.db.memory == nil && filter != nil {
+		c.explain(op, filter, sort)
+	}
+}
+
+func (c *profiledCollection) explain(op string, filter any, sort bson.D) {
+	shape := filterShape(filter)
+	if _, done := c.db.explained.LoadOrStore(c.Name()+" "+shape, true); done {
+		return
+	}
+
+	q := ExplainQuery{Name: op, Collection: c.Name(), Sort: sort}
+	if stages, ok := filter.(mongo.Pipeline); ok {
+		q.Pipeline = &pipeline{stages: stages}
+	} else if f, err := toFilter(filter); err == nil {
+		q.Filter = f
+	} else {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), c.db.config.Timeout)
+		defer cancel()
+
+		result, err := Explain(ctx, c.db, q)
+		if err != nil {
+			fmt.Printf("explain failed for %s.%s %s: %v\n", c.Name(), op, shape, err)
+			return
+		}
+		if result.CollScan {
+			fmt.Printf("collection scan: %s.%s %s plan: %v\n", c.Name(), op, shape, result.Stages)
+		}
+	}()
+}
+
+func slowQueryMessage(collection string, op string, filter any, duration time.Duration) string {
+	shape := ""
+	if filter != nil {
+		shape = " " + filterShape(filter)
+	}
+	return fmt.Sprintf("slow query: %s.%s%s took %s", collection, op, shape, duration.Round(time.Millisecond))
+}
+
+func findSort(sort any) bson.D {
+	if d, ok := sort.(bson.D); ok {
+		return d
+	}
+	return nil
+}
+
+func (c *profiledCollection) FindOne(ctx context.Context, filter any, opts ...*options.FindOneOptions) *mongo.SingleResult {
+	defer c.observe("findOne", filter, findSort(options.MergeFindOneOptions(opts...).Sort), time.Now())
+	return c.collection.FindOne(ctx, filter, opts...)
+}
+
+// the iteration of the cursor is not measured, see profiledCollection
+func (c *profiledCollection) Find(ctx context.Context, filter any, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	defer c.observe("find", filter, findSort(options.MergeFindOptions(opts...).Sort), time.Now())
+	return c.collection.Find(ctx, filter, opts...)
+}
+
+func (c *profiledCollection) InsertOne(ctx context.Context, document any, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	defer c.observe("insertOne", nil, nil, time.Now())
+	return c.collection.InsertOne(ctx, document, opts...)
+}
+
+func (c *profiledCollection) InsertMany(ctx context.Context, documents []any, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
+	defer c.observe("insertMany", nil, nil, time.Now())
+	return c.collection.InsertMany(ctx, documents, opts...)
+}
+
+func (c *profiledCollection) UpdateOne(ctx context.Context, filter any, update any, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	defer c.observe("updateOne", filter, nil, time.Now())
+	return c.collection.UpdateOne(ctx, filter, update, opts...)
+}
+
+func (c *profiledCollection) UpdateMany(ctx context.Context, filter any, update any, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	defer c.observe("updateMany", filter, nil, time.Now())
+	return c.collection.UpdateMany(ctx, filter, update, opts...)
+}
+
+func (c *profiledCollection) ReplaceOne(ctx context.Context, filter any, replacement any, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error) {
+	defer c.observe("replaceOne", filter, nil, time.Now())
+	return c.collection.ReplaceOne(ctx, filter, replacement, opts...)
+}
+
+func (c *profiledCollection) FindOneAndUpdate(ctx context.Context, filter any, update any, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+	defer c.observe("findOneAndUpdate", filter, findSort(options.MergeFindOneAndUpdateOptions(opts...).Sort), time.Now())
+	return c.collection.FindOneAndUpdate(ctx, filter, update, opts...)
+}
+
+func (c *profiledCollection) DeleteOne(ctx context.Context, filter any, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	defer c.observe("deleteOne", filter, nil, time.Now())
+	return c.collection.DeleteOne(ctx, filter, opts...)
+}
+
+func (c *profiledCollection) DeleteMany(ctx context.Context, filter any, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	defer c.observe("deleteMany", filter, nil, time.Now())
+	return c.collection.DeleteMany(ctx, filter, opts...)
+}
+
+func (c *profiledCollection) CountDocuments(ctx context.Context, filter any, opts ...*options.CountOptions) (int64, error) {
+	defer c.observe("countDocuments", filter, nil, time.Now())
+	return c.collection.CountDocuments(ctx, filter, opts...)
+}
+
+func (c *profiledCollection) Distinct(ctx context.Context, fieldName string, filter any, opts ...*options.DistinctOptions) ([]any, error) {
+	defer c.observe("distinct", filter, nil, time.Now())
+	return c.collection.Distinct(ctx, fieldName, filter, opts...)
+}
+
+func (c *profiledCollection) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+	defer c.observe("bulkWrite", nil, nil, time.Now())
+	return c.collection.BulkWrite(ctx, models, opts...)
+}
+
+func (c *profiledCollection) Aggregate(ctx context.Context, pipeline any, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+	defer c.observe("aggregate", pipeline, nil, time.Now())
+	return c.collection.Aggregate(ctx, pipeline, opts...)
+}
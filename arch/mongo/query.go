@@ -2,7 +2,9 @@ package mongo
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -17,35 +19,102 @@ type Query[T any] interface {
 	FindOne(filter bson.M, opts *options.FindOneOptions) (*T, error)
 	FindAll(filter bson.M, opts *options.FindOptions) ([]*T, error)
 	FindPaginated(filter bson.M, page int64, limit int64, opts *options.FindOptions) ([]*T, error)
+	ForEach(filter bson.M, opts *options.FindOptions, fn func(doc *T) error) error
+	Stream(filter bson.M, opts *options.FindOptions) (<-chan *T, <-chan error)
 	InsertOne(doc *T) (*primitive.ObjectID, error)
 	InsertAndRetrieveOne(doc *T) (*T, error)
 	InsertMany(doc []*T) ([]primitive.ObjectID, error)
 	InsertAndRetrieveMany(doc []*T) ([]*T, error)
 	UpdateOne(filter bson.M, update bson.M) (*mongo.UpdateResult, error)
 	UpdateMany(filter bson.M, update bson.M) (*mongo.UpdateResult, error)
+	UpsertOne(filter bson.M, update bson.M) (*mongo.UpdateResult, error)
+	ReplaceOne(filter bson.M, doc *T, opts *options.ReplaceOptions) (*mongo.UpdateResult, error)
+	FindOneAndUpdate(filter bson.M, update any, opts *options.FindOneAndUpdateOptions) (*T, error)
+	UpdateOneVersioned(filter bson.M, version int64, update bson.M) (*mongo.UpdateResult, error)
+	FindOneAndUpdateVersioned(filter bson.M, version int64, update any) (*T, error)
 	DeleteOne(filter bson.M) (*mongo.DeleteResult, error)
+	DeleteMany(filter bson.M) (*mongo.DeleteResult, error)
+	CountDocuments(filter bson.M, opts *options.CountOptions) (int64, error)
+	BulkWrite(models []mongo.WriteModel, opts *options.BulkWriteOptions) (*mongo.BulkWriteResult, error)
+	// decodes into results, a pointer to a slice, see Aggregate for the typed results
+	AggregateInto(pipeline Pipeline, opts *options.AggregateOptions, results any) error
+	// the raw values of the field, see Distinct for the typed values
+	DistinctValues(field string, filter bson.M) ([]any, error)
 }
 
+// the documents fetched from the server per round trip when streaming
+const DefaultBatchSize int32 = 100
+
+// returned by a ForEach callback to stop the iteration without an error
+var ErrStopIteration = errors.New("stop iteration")
+
 type query[T any] struct {
-	collection *mongo.Collection
+	collection collection
 	context    context.Context
 	cancel     context.CancelFunc
+	keyring    Keyring
+	cipher     *fieldCipher
 }
 
-func newSingleQuery[T any](collection *mongo.Collection, timeout time.Duration) Query[T] {
+func newSingleQuery[T any](collection collection, timeout time.Duration, keyring Keyring) Query[T] {
 	context, cancel := context.WithTimeout(context.Background(), timeout)
 	return &query[T]{
 		context:    context,
 		cancel:     cancel,
 		collection: collection,
+		keyring:    keyring,
+		cipher:     newFieldCipher(reflect.TypeOf((*T)(nil)).Elem(), keyring),
 	}
 }
 
-func newQuery[T any](context context.Context, collection *mongo.Collection) Query[T] {
+func newQuery[T any](context context.Context, collection collection, keyring Keyring) Query[T] {
 	return &query[T]{
 		context:    context,
 		collection: collection,
+		keyring:    keyring,
+		cipher:     newFieldCipher(reflect.TypeOf((*T)(nil)).Elem(), keyring),
+	}
+}
+
+// the encrypted fields of T are handled here, the others pass through unchanged
+func (q *query[T]) encryptFilter(filter bson.M) (bson.M, error) {
+	if q.cipher == nil {
+		return filter, nil
+	}
+	return q.cipher.filter(filter)
+}
+
+func (q *query[T]) encryptUpdate(update any) (any, error) {
+	if q.cipher == nil {
+		return update, nil
+	}
+	return q.cipher.update(update)
+}
+
+func (q *query[T]) encryptDocument(doc *T) (any, error) {
+	if q.cipher == nil {
+		return doc, nil
+	}
+	return q.cipher.encryptDocument(doc)
+}
+
+func (q *query[T]) encryptFilterAndUpdate(filter bson.M, update any) (bson.M, any, error) {
+	filter, err := q.encryptFilter(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	update, err = q.encryptUpdate(update)
+	if err != nil {
+		return nil, nil, err
+	}
+	return filter, update, nil
+}
+
+func (q *query[T]) decrypt(doc *T) error {
+	if q.cipher == nil {
+		return nil
 	}
+	return q.cipher.decrypt(doc)
 }
 
 func (q *query[T]) Close() {
@@ -56,25 +125,41 @@ func (q *query[T]) Close() {
 
 func (q *query[T]) CreateIndexes(indexes []mongo.IndexModel) error {
 	defer q.Close()
+	if err := CheckIndexes[T](indexes); err != nil {
+		return fmt.Errorf("invalid index for %s: %w", q.collection.Name(), err)
+	}
 	fmt.Println("database indexing for: " + q.collection.Name())
-	result, err := q.collection.Indexes().CreateMany(q.context, indexes)
+	result, err := q.collection.CreateIndexes(q.context, indexes)
 	fmt.Println(q.collection.Name(), result)
 	return err
 }
 
 func (q *query[T]) FindOne(filter bson.M, opts *options.FindOneOptions) (*T, error) {
 	defer q.Close()
+	filter, err := q.encryptFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
 	var doc T
-	err := q.collection.FindOne(q.context, filter, opts).Decode(&doc)
+	err = q.collection.FindOne(q.context, filter, opts).Decode(&doc)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := q.decrypt(&doc); err != nil {
+		return nil, err
+	}
 	return &doc, nil
 }
 
 func (q *query[T]) FindAll(filter bson.M, opts *options.FindOptions) ([]*T, error) {
 	defer q.Close()
+	filter, err := q.encryptFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
 	cursor, err := q.collection.Find(q.context, filter, opts)
 	if err != nil {
 		return nil, fmt.Errorf("error executing query: %w", err)
@@ -89,6 +174,9 @@ func (q *query[T]) FindAll(filter bson.M, opts *options.FindOptions) ([]*T, erro
 		if err != nil {
 			return nil, fmt.Errorf("error decoding result: %w", err)
 		}
+		if err := q.decrypt(&result); err != nil {
+			return nil, err
+		}
 		docs = append(docs, &result)
 	}
 
@@ -109,6 +197,11 @@ func (q *query[T]) FindPaginated(filter bson.M, page int64, limit int64, opts *o
 	opts.SetSkip(skip)
 	opts.SetLimit(int64(limit))
 
+	filter, err := q.encryptFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
 	cursor, err := q.collection.Find(q.context, filter, opts)
 	if err != nil {
 		return nil, fmt.Errorf("error executing query: %w", err)
@@ -123,6 +216,9 @@ func (q *query[T]) FindPaginated(filter bson.M, page int64, limit int64, opts *o
 		if err != nil {
 			return nil, fmt.Errorf("error decoding result: %w", err)
 		}
+		if err := q.decrypt(&result); err != nil {
+			return nil, err
+		}
 		docs = append(docs, &result)
 	}
 
@@ -133,9 +229,117 @@ func (q *query[T]) FindPaginated(filter bson.M, page int64, limit int64, opts *o
 	return docs, nil
 }
 
+/*
+ * Example -> builder.Query(ctx).ForEach(filter, options.Find().SetBatchSize(500), func(blog *model.Blog) error {...})
+ * decodes one document at a time, only a batch of documents is held in memory
+ * the iteration stops at the first error of fn, return ErrStopIteration to stop early
+ * use Query(ctx) for long iterations since SingleQuery times out with the db timeout
+ */
+func (q *query[T]) ForEach(filter bson.M, opts *options.FindOptions, fn func(doc *T) error) error {
+	defer q.Close()
+	return q.forEach(filter, opts, fn)
+}
+
+func (q *query[T]) forEach(filter bson.M, opts *options.FindOptions, fn func(doc *T) error) error {
+	if opts == nil {
+		opts = options.Find()
+	}
+	if opts.BatchSize == nil {
+		opts.SetBatchSize(DefaultBatchSize)
+	}
+
+	filter, err := q.encryptFilter(filter)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := q.collection.Find(q.context, filter, opts)
+	if err != nil {
+		return fmt.Errorf("error executing query: %w", err)
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(q.context) {
+		var result T
+		if err := cursor.Decode(&result); err != nil {
+			return fmt.Errorf("error decoding result: %w", err)
+		}
+		if err := q.decrypt(&result); err != nil {
+			return err
+		}
+		if err := fn(&result); err != nil {
+			if errors.Is(err, ErrStopIteration) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("cursor error: %w", err)
+	}
+
+	return q.context.Err()
+}
+
+/*
+ * Example -> query := builder.Query(ctx); defer query.Close()
+ * docs, errs := query.Stream(filter, nil)
+ * for doc := range docs {...}; if err := <-errs; err != nil {...}
+ * the documents channel holds at most one batch, the query waits while the receiver is slow
+ * call Close() or cancel the context when leaving the loop early, the cursor is closed and errs gets context.Canceled
+ */
+func (q *query[T]) Stream(filter bson.M, opts *options.FindOptions) (<-chan *T, <-chan error) {
+	// Close() stops the stream of a Query(ctx) too, which has no cancel of its own
+	ctx, cancel := context.WithCancel(q.context)
+	parent := q.cancel
+	q.context = ctx
+	q.cancel = func() {
+		cancel()
+		if parent != nil {
+			parent()
+		}
+	}
+
+	if opts == nil {
+		opts = options.Find()
+	}
+	if opts.BatchSize == nil {
+		opts.SetBatchSize(DefaultBatchSize)
+	}
+
+	docs := make(chan *T, max(*opts.BatchSize, 0))
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(docs)
+		defer q.Close()
+
+		err := q.forEach(filter, opts, func(doc *T) error {
+			select {
+			case docs <- doc:
+				return nil
+			case <-q.context.Done():
+				return q.context.Err()
+			}
+		})
+		if err != nil {
+			errs <- err
+		}
+	}()
+
+	return docs, errs
+}
+
 func (q *query[T]) InsertOne(doc *T) (*primitive.ObjectID, error) {
 	defer q.Close()
-	result, err := q.collection.InsertOne(q.context, doc)
+	encrypted, err := q.encryptDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := q.collection.InsertOne(q.context, encrypted)
 	if err != nil {
 		return nil, err
 	}
@@ -150,7 +354,12 @@ func (q *query[T]) InsertOne(doc *T) (*primitive.ObjectID, error) {
 
 func (q *query[T]) InsertAndRetrieveOne(doc *T) (*T, error) {
 	defer q.Close()
-	result, err := q.collection.InsertOne(q.context, doc)
+	encrypted, err := q.encryptDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := q.collection.InsertOne(q.context, encrypted)
 	if err != nil {
 		return nil, err
 	}
@@ -168,7 +377,11 @@ func (q *query[T]) InsertMany(docs []*T) ([]primitive.ObjectID, error) {
 	defer q.Close()
 	var iDocs []any
 	for _, doc := range docs {
-		iDocs = append(iDocs, doc)
+		encrypted, err := q.encryptDocument(doc)
+		if err != nil {
+			return nil, err
+		}
+		iDocs = append(iDocs, encrypted)
 	}
 
 	result, err := q.collection.InsertMany(q.context, iDocs)
@@ -193,7 +406,11 @@ func (q *query[T]) InsertAndRetrieveMany(docs []*T) ([]*T, error) {
 	defer q.Close()
 	var iDocs []any
 	for _, doc := range docs {
-		iDocs = append(iDocs, doc)
+		encrypted, err := q.encryptDocument(doc)
+		if err != nil {
+			return nil, err
+		}
+		iDocs = append(iDocs, encrypted)
 	}
 
 	result, err := q.collection.InsertMany(q.context, iDocs)
@@ -216,7 +433,12 @@ func (q *query[T]) InsertAndRetrieveMany(docs []*T) ([]*T, error) {
  */
 func (q *query[T]) UpdateOne(filter bson.M, update bson.M) (*mongo.UpdateResult, error) {
 	defer q.Close()
-	result, err := q.collection.UpdateOne(q.context, filter, update)
+	filter, encrypted, err := q.encryptFilterAndUpdate(filter, update)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := q.collection.UpdateOne(q.context, filter, encrypted)
 	if err != nil {
 		return nil, err
 	}
@@ -228,15 +450,174 @@ func (q *query[T]) UpdateOne(filter bson.M, update bson.M) (*mongo.UpdateResult,
  */
 func (q *query[T]) UpdateMany(filter bson.M, update bson.M) (*mongo.UpdateResult, error) {
 	defer q.Close()
-	result, err := q.collection.UpdateMany(q.context, filter, update)
+	filter, encrypted, err := q.encryptFilterAndUpdate(filter, update)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := q.collection.UpdateMany(q.context, filter, encrypted)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+/*
+ * Example -> UpsertOne(bson.M{"code": code}, bson.M{"$setOnInsert": role})
+ */
+func (q *query[T]) UpsertOne(filter bson.M, update bson.M) (*mongo.UpdateResult, error) {
+	defer q.Close()
+	filter, encrypted, err := q.encryptFilterAndUpdate(filter, update)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Update().SetUpsert(true)
+	result, err := q.collection.UpdateOne(q.context, filter, encrypted, opts)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+/*
+ * Example -> ReplaceOne(bson.M{"_id": doc.ID}, doc, options.Replace().SetUpsert(true))
+ */
+func (q *query[T]) ReplaceOne(filter bson.M, doc *T, opts *options.ReplaceOptions) (*mongo.UpdateResult, error) {
+	defer q.Close()
+	filter, err := q.encryptFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := q.encryptDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := q.collection.ReplaceOne(q.context, filter, encrypted, opts)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+/*
+ * Example -> FindOneAndUpdate(filter, bson.M{"$set": bson.M{"field": "newValue"}}, nil)
+ * the update can also be a pipeline i.e. NewPipeline().Set(bson.M{"text": "$draftText"}).Stages()
+ * returns the document after the update unless opts ask for the one before it
+ */
+func (q *query[T]) FindOneAndUpdate(filter bson.M, update any, opts *options.FindOneAndUpdateOptions) (*T, error) {
+	defer q.Close()
+	if opts == nil {
+		opts = options.FindOneAndUpdate()
+	}
+	if opts.ReturnDocument == nil {
+		opts.SetReturnDocument(options.After)
+	}
+
+	filter, update, err := q.encryptFilterAndUpdate(filter, update)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc T
+	err = q.collection.FindOneAndUpdate(q.context, filter, update, opts).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := q.decrypt(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+/*
+ * Example -> UpdateOneVersioned(bson.M{"_id": id}, blog.Version, bson.M{"$set": bson.M{"title": title}})
+ * the update applies only if the document is still at the version and increments it
+ * returns ErrVersionConflict if the document has moved to another version
+ */
+func (q *query[T]) UpdateOneVersioned(filter bson.M, version int64, update bson.M) (*mongo.UpdateResult, error) {
+	defer q.Close()
+	if err := fieldsOf[T]().check(VersionField); err != nil {
+		return nil, err
+	}
+
+	filter, encrypted, err := q.encryptFilterAndUpdate(filter, update)
+	if err != nil {
+		return nil, err
+	}
+
+	versioned, err := versionedUpdate(encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := q.collection.UpdateOne(q.context, versionedFilter(filter, version), versioned)
 	if err != nil {
 		return nil, err
 	}
+
+	if result.MatchedCount == 0 {
+		return nil, q.versionMismatch(filter)
+	}
+
 	return result, nil
 }
 
+/*
+ * Same as UpdateOneVersioned but returns the document after the update
+ */
+func (q *query[T]) FindOneAndUpdateVersioned(filter bson.M, version int64, update any) (*T, error) {
+	defer q.Close()
+	if err := fieldsOf[T]().check(VersionField); err != nil {
+		return nil, err
+	}
+
+	filter, update, err := q.encryptFilterAndUpdate(filter, update)
+	if err != nil {
+		return nil, err
+	}
+
+	versioned, err := versionedUpdate(update)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var doc T
+	err = q.collection.FindOneAndUpdate(q.context, versionedFilter(filter, version), versioned, opts).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, q.versionMismatch(filter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := q.decrypt(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (q *query[T]) versionMismatch(filter bson.M) error {
+	count, err := q.collection.CountDocuments(q.context, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return ErrVersionConflict
+}
+
 func (q *query[T]) DeleteOne(filter bson.M) (*mongo.DeleteResult, error) {
 	defer q.Close()
+	filter, err := q.encryptFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
 	result, err := q.collection.DeleteOne(q.context, filter)
 	if err != nil {
 		return nil, err
@@ -244,3 +625,134 @@ func (q *query[T]) DeleteOne(filter bson.M) (*mongo.DeleteResult, error) {
 
 	return result, nil
 }
+
+func (q *query[T]) DeleteMany(filter bson.M) (*mongo.DeleteResult, error) {
+	defer q.Close()
+	filter, err := q.encryptFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := q.collection.DeleteMany(q.context, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (q *query[T]) CountDocuments(filter bson.M, opts *options.CountOptions) (int64, error) {
+	defer q.Close()
+	filter, err := q.encryptFilter(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := q.collection.CountDocuments(q.context, filter, opts)
+	if err != nil {
+		return 0, fmt.Errorf("error executing count: %w", err)
+	}
+
+	return count, nil
+}
+
+/*
+ * Example -> BulkWrite([]mongo.WriteModel{mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update)}, nil)
+ * the models are sent as they are, the encrypted fields are not handled
+ */
+func (q *query[T]) BulkWrite(models []mongo.WriteModel, opts *options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+	defer q.Close()
+	if len(models) == 0 {
+		return &mongo.BulkWriteResult{}, nil
+	}
+
+	result, err := q.collection.BulkWrite(q.context, models, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (q *query[T]) AggregateInto(pipeline Pipeline, opts *options.AggregateOptions, results any) error {
+	defer q.Close()
+	cursor, err := q.collection.Aggregate(q.context, pipeline.Stages(), opts)
+	if err != nil {
+		return fmt.Errorf("error executing aggregation: %w", err)
+	}
+	defer cursor.Close(q.context)
+
+	if err := cursor.All(q.context, results); err != nil {
+		return fmt.Errorf("error decoding result: %w", err)
+	}
+
+	// the stages can't read the encrypted values but the results are decrypted
+	return decryptAll(q.keyring, results)
+}
+
+/*
+ * Example -> counts, err := Aggregate[TagCount](builder.SingleQuery(), pipeline, nil)
+ */
+func Aggregate[R any, T any](q Query[T], pipeline Pipeline, opts *options.AggregateOptions) ([]*R, error) {
+	var docs []*R
+	err := q.AggregateInto(pipeline, opts, &docs)
+	if err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+func (q *query[T]) DistinctValues(field string, filter bson.M) ([]any, error) {
+	defer q.Close()
+	if err := fieldsOf[T]().check(field); err != nil {
+		return nil, err
+	}
+	if q.cipher != nil {
+		if err := q.cipher.check(field); err != nil {
+			return nil, err
+		}
+	}
+
+	filter, err := q.encryptFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := q.collection.Distinct(q.context, field, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error executing distinct: %w", err)
+	}
+
+	return values, nil
+}
+
+/*
+ * Example -> tags, err := Distinct[string](builder.SingleQuery(), "tags", bson.M{"status": true})
+ */
+func Distinct[R any, T any](q Query[T], field string, filter bson.M) ([]R, error) {
+	values, err := q.DistinctValues(field, filter)
+	if err != nil {
+		return nil, err
+	}
+	return decodeValues[R](values)
+}
+
+// values are round tripped through bson so that e.g. int32 decodes into an int64 result
+func decodeValues[R any](values []any) ([]R, error) {
+	results := make([]R, len(values))
+	for i, v := range values {
+		raw, err := bson.Marshal(bson.M{"v": v})
+		if err != nil {
+			return nil, fmt.Errorf("error encoding value: %w", err)
+		}
+
+		var holder struct {
+			V R `bson:"v"`
+		}
+		if err := bson.Unmarshal(raw, &holder); err != nil {
+			return nil, fmt.Errorf("error decoding value: %w", err)
+		}
+		results[i] = holder.V
+	}
+	return results, nil
+}
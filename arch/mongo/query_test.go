@@ -0,0 +1,96 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestDecodeValues(t *testing.T) {
+	strs, err := decodeValues[string]([]any{"GO", "MONGO"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"GO", "MONGO"}, strs)
+
+	nums, err := decodeValues[int64]([]any{int32(1), int64(2)})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, nums)
+
+	id := primitive.NewObjectID()
+	ids, err := decodeValues[primitive.ObjectID]([]any{id})
+	assert.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{id}, ids)
+}
+
+func TestDecodeValues_Mismatch(t *testing.T) {
+	_, err := decodeValues[int64]([]any{"GO"})
+	assert.Error(t, err)
+}
+
+func TestQuery_ForEach(t *testing.T) {
+	builder := newMemoryPosts(t, &memoryPost{Slug: "a"}, &memoryPost{Slug: "b"}, &memoryPost{Slug: "c"})
+	opts := options.Find().SetSort(bson.D{{Key: "slug", Value: 1}}).SetBatchSize(2)
+
+	var slugs []string
+	err := builder.Query(context.Background()).ForEach(bson.M{}, opts, func(doc *memoryPost) error {
+		slugs = append(slugs, doc.Slug)
+		if doc.Slug == "b" {
+			return ErrStopIteration
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, slugs)
+
+	failed := errors.New("failed")
+	err = builder.SingleQuery().ForEach(bson.M{}, nil, func(doc *memoryPost) error { return failed })
+	assert.ErrorIs(t, err, failed)
+}
+
+func TestQuery_Stream(t *testing.T) {
+	builder := newMemoryPosts(t, &memoryPost{Slug: "a"}, &memoryPost{Slug: "b"}, &memoryPost{Slug: "c"})
+
+	docs, errs := builder.SingleQuery().Stream(bson.M{"slug": bson.M{"$ne": "b"}}, options.Find().SetBatchSize(1))
+	var slugs []string
+	for doc := range docs {
+		slugs = append(slugs, doc.Slug)
+	}
+	assert.NoError(t, <-errs)
+	assert.ElementsMatch(t, []string{"a", "c"}, slugs)
+}
+
+func TestQuery_StreamCancel(t *testing.T) {
+	builder := newMemoryPosts(t, &memoryPost{Slug: "a"}, &memoryPost{Slug: "b"}, &memoryPost{Slug: "c"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	docs, errs := builder.Query(ctx).Stream(bson.M{}, options.Find().SetBatchSize(0))
+	<-docs
+	cancel()
+
+	for range docs {
+	}
+	assert.ErrorIs(t, <-errs, context.Canceled)
+}
+
+func TestQuery_StreamClose(t *testing.T) {
+	builder := newMemoryPosts(t, &memoryPost{Slug: "a"}, &memoryPost{Slug: "b"}, &memoryPost{Slug: "c"})
+
+	query := builder.Query(context.Background())
+	docs, errs := query.Stream(bson.M{}, options.Find().SetBatchSize(0))
+	<-docs
+	query.Close()
+
+	select {
+	case err := <-errs:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("the stream did not stop on Close")
+	}
+	for range docs {
+	}
+}
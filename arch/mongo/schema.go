@@ -0,0 +1,247 @@
+package mongo
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// simpler than the check of the validator, it only guards against the obviously malformed values
+const emailPattern = `^[^@\s]+@[^@\s]+\.[^@\s]+$`
+
+var byteSliceType = reflect.TypeOf([]byte(nil))
+
+/*
+ * Example -> JSONSchema[model.Blog]() gives the $jsonSchema for the collection validator
+ * built from the bson tags for the field names and types, and the validate tags for the rules
+ * supported rules: required, min, max, len, gt, gte, lt, lte, oneof, email and omitempty
+ */
+func JSONSchema[T any]() bson.M {
+	return schemaOfType(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+func schemaOfType(t reflect.Type) bson.M {
+	return objectSchema(indirectType(t), map[reflect.Type]bool{})
+}
+
+func objectSchema(t reflect.Type, visiting map[reflect.Type]bool) bson.M {
+	schema := bson.M{"bsonType": "object"}
+	if visiting[t] {
+		return schema
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	properties := bson.M{}
+	var required []string
+	collectProperties(t, properties, &required, visiting)
+
+	schema["properties"] = properties
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+func collectProperties(t reflect.Type, properties bson.M, required *[]string, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, inline, skip := bsonFieldName(f)
+		if skip {
+			continue
+		}
+		if inline {
+			if it := indirectType(f.Type); isStructType(it) {
+				collectProperties(it, properties, required, visiting)
+			}
+			continue
+		}
+
+		rules := parseValidateTag(f.Tag.Get("validate"))
+		isRequired := rules.required && !hasBsonOption(f, "omitempty")
+
+		if isEncrypted(f) {
+			// only the type of the ciphertext can be checked
+			properties[name] = fieldSchema(f.Type, validateRules{}, visiting)
+			if blind := blindIndexOf(f, name); blind != "" {
+				properties[blind] = properties[name]
+				if isRequired {
+					*required = append(*required, blind)
+				}
+			}
+		} else {
+			properties[name] = fieldSchema(f.Type, rules, visiting)
+		}
+		if isRequired {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func fieldSchema(t reflect.Type, rules validateRules, visiting map[reflect.Type]bool) bson.M {
+	nullable := false
+	if t.Kind() == reflect.Pointer {
+		nullable = !rules.required
+		t = indirectType(t)
+	}
+
+	var schema bson.M
+	switch {
+	case t == timeType || t == dateTimeType:
+		schema = bson.M{"bsonType": "date"}
+	case t == objectIdType:
+		schema = bson.M{"bsonType": "objectId"}
+	case t == byteSliceType:
+		schema = bson.M{"bsonType": "binData"}
+	case t.Kind() == reflect.String:
+		schema = bson.M{"bsonType": "string"}
+		rules.apply(schema, "minLength", "maxLength")
+		if rules.required && schema["minLength"] == nil {
+			schema["minLength"] = 1
+		}
+		if rules.email {
+			schema["pattern"] = emailPattern
+		}
+		if len(rules.oneOf) > 0 {
+			enum := bson.A{}
+			for _, v := range rules.oneOf {
+				enum = append(enum, v)
+			}
+			schema["enum"] = enum
+		}
+	case t.Kind() == reflect.Bool:
+		schema = bson.M{"bsonType": "bool"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		schema = bson.M{"bsonType": bson.A{"int", "long"}}
+		rules.applyNumeric(schema)
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		schema = bson.M{"bsonType": "number"}
+		rules.applyNumeric(schema)
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		// nil slices are stored as null
+		nullable = nullable || (t.Kind() == reflect.Slice && !rules.required)
+		schema = bson.M{"bsonType": "array", "items": fieldSchema(t.Elem(), validateRules{}, visiting)}
+		rules.apply(schema, "minItems", "maxItems")
+	case t.Kind() == reflect.Map:
+		nullable = nullable || !rules.required
+		schema = bson.M{"bsonType": "object"}
+	case t.Kind() == reflect.Struct:
+		schema = objectSchema(t, visiting)
+	default:
+		// interfaces and the other free form values
+		return bson.M{}
+	}
+
+	if nullable {
+		types := bson.A{}
+		if list, ok := schema["bsonType"].(bson.A); ok {
+			types = append(types, list...)
+		} else {
+			types = append(types, schema["bsonType"])
+		}
+		schema["bsonType"] = append(types, "null")
+	}
+	return schema
+}
+
+type validateRules struct {
+	required  bool
+	omitempty bool
+	email     bool
+	min       *float64
+	max       *float64
+	exclusive map[string]bool
+	oneOf     []string
+}
+
+// the rules with alternatives e.g. `required|email` are not translated
+func parseValidateTag(tag string) validateRules {
+	rules := validateRules{exclusive: map[string]bool{}}
+	if tag == "" || tag == "-" {
+		return rules
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		if strings.Contains(rule, "|") {
+			continue
+		}
+		key, param, _ := strings.Cut(rule, "=")
+		switch key {
+		case "required":
+			rules.required = true
+		case "omitempty":
+			rules.omitempty = true
+		case "email":
+			rules.email = true
+		case "oneof":
+			rules.oneOf = strings.Fields(param)
+		case "min", "gte", "gt":
+			if n, err := strconv.ParseFloat(param, 64); err == nil {
+				rules.min = &n
+				rules.exclusive["min"] = key == "gt"
+			}
+		case "max", "lte", "lt":
+			if n, err := strconv.ParseFloat(param, 64); err == nil {
+				rules.max = &n
+				rules.exclusive["max"] = key == "lt"
+			}
+		case "len":
+			if n, err := strconv.ParseFloat(param, 64); err == nil {
+				rules.min, rules.max = &n, &n
+			}
+		}
+	}
+	return rules
+}
+
+// a zero value passes the omitempty rules in go, so only the upper bound is kept for them
+func (r validateRules) apply(schema bson.M, minKey string, maxKey string) {
+	if r.min != nil && !r.omitempty {
+		schema[minKey] = int64(*r.min)
+	}
+	if r.max != nil {
+		schema[maxKey] = int64(*r.max)
+	}
+}
+
+func (r validateRules) applyNumeric(schema bson.M) {
+	if r.min != nil && !r.omitempty {
+		schema["minimum"] = *r.min
+		if r.exclusive["min"] {
+			schema["exclusiveMinimum"] = true
+		}
+	}
+	if r.max != nil {
+		schema["maximum"] = *r.max
+		if r.exclusive["max"] {
+			schema["exclusiveMaximum"] = true
+		}
+	}
+	if len(r.oneOf) > 0 {
+		enum := bson.A{}
+		for _, v := range r.oneOf {
+			if n, err := strconv.ParseFloat(v, 64); err == nil {
+				enum = append(enum, n)
+			}
+		}
+		schema["enum"] = enum
+	}
+}
+
+func hasBsonOption(f reflect.StructField, option string) bool {
+	parts := strings.Split(f.Tag.Get("bson"), ",")
+	for _, p := range parts[1:] {
+		if p == option {
+			return true
+		}
+	}
+	return false
+}
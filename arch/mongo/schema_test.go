@@ -0,0 +1,103 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type schemaAudit struct {
+	By primitive.ObjectID `bson:"by" validate:"required"`
+	At time.Time          `bson:"at"`
+}
+
+type schemaDoc struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	Title          string             `bson:"title" validate:"required,max=500"`
+	Email          string             `bson:"email" validate:"required,email"`
+	Note           *string            `bson:"note,omitempty" validate:"omitempty,min=3,max=50"`
+	Kind           string             `bson:"kind" validate:"oneof=post page"`
+	Tags           []string           `bson:"tags" validate:"required,max=10"`
+	Score          float64            `bson:"score" validate:"min=0,max=1"`
+	Version        int                `bson:"version" validate:"gt=0"`
+	Status         bool               `bson:"status" validate:"-"`
+	Meta           map[string]any     `bson:"meta"`
+	Audit          schemaAudit        `bson:"audit"`
+	Hidden         string             `bson:"-"`
+	SchemaEmbedded `bson:",inline"`
+}
+
+type SchemaEmbedded struct {
+	Slug string `bson:"slug" validate:"required,min=3"`
+}
+
+func TestJSONSchema(t *testing.T) {
+	schema := JSONSchema[schemaDoc]()
+	props := schema["properties"].(bson.M)
+
+	assert.Equal(t, "object", schema["bsonType"])
+	assert.Equal(t, []string{"email", "slug", "tags", "title"}, schema["required"])
+	assert.NotContains(t, props, "Hidden")
+	assert.NotContains(t, props, "-")
+
+	assert.Equal(t, bson.M{"bsonType": "objectId"}, props["_id"])
+	assert.Equal(t, bson.M{"bsonType": "string", "minLength": 1, "maxLength": int64(500)}, props["title"])
+	assert.Equal(t, bson.M{"bsonType": "string", "minLength": 1, "pattern": emailPattern}, props["email"])
+	assert.Equal(t, bson.M{"bsonType": bson.A{"string", "null"}, "maxLength": int64(50)}, props["note"])
+	assert.Equal(t, bson.M{"bsonType": "string", "enum": bson.A{"post", "page"}}, props["kind"])
+	assert.Equal(t, bson.M{"bsonType": "array", "items": bson.M{"bsonType": "string"}, "maxItems": int64(10)}, props["tags"])
+	assert.Equal(t, bson.M{"bsonType": "number", "minimum": 0.0, "maximum": 1.0}, props["score"])
+	assert.Equal(t, bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0.0, "exclusiveMinimum": true}, props["version"])
+	assert.Equal(t, bson.M{"bsonType": "bool"}, props["status"])
+	assert.Equal(t, bson.M{"bsonType": bson.A{"object", "null"}}, props["meta"])
+	assert.Equal(t, bson.M{"bsonType": "string", "minLength": int64(3)}, props["slug"])
+
+	audit := props["audit"].(bson.M)
+	assert.Equal(t, []string{"by"}, audit["required"])
+	assert.Equal(t, bson.M{"bsonType": "date"}, audit["properties"].(bson.M)["at"])
+}
+
+func TestSameValidator(t *testing.T) {
+	plan := &ValidatorPlan{
+		Schema: JSONSchema[schemaDoc](),
+		Level:  ValidationLevelModerate,
+		Action: ValidationActionError,
+	}
+
+	// the server echoes the validator back with the canonical types
+	stored, err := canonical(bson.M{"$jsonSchema": plan.Schema})
+	assert.NoError(t, err)
+	current := bson.M{"validator": stored, "validationLevel": "moderate", "validationAction": "error"}
+	assert.True(t, sameValidator(current, plan))
+
+	current["validationLevel"] = "strict"
+	assert.False(t, sameValidator(current, plan))
+
+	plan.Level = ValidationLevelStrict
+	delete(current, "validationLevel")
+	assert.True(t, sameValidator(current, plan))
+
+	current["validator"] = bson.M{"$jsonSchema": bson.M{"bsonType": "object"}}
+	assert.False(t, sameValidator(current, plan))
+}
+
+func TestIndexPlanValidator(t *testing.T) {
+	plan := &IndexPlan{Collection: "posts"}
+	assert.False(t, plan.HasChanges())
+
+	plan.Validator = &ValidatorPlan{Level: "moderate", Action: "warn"}
+	assert.False(t, plan.HasChanges())
+	assert.Equal(t, "indexes for posts:\n  = validator $jsonSchema level=moderate action=warn", plan.String())
+
+	plan.Validator.Changed = true
+	assert.True(t, plan.HasChanges())
+	assert.Equal(t, "indexes for posts:\n  ~ validator $jsonSchema level=moderate action=warn", plan.String())
+
+	r := NewIndexReconciler(NewMemoryDatabase(), IndexConfig{ValidationLevel: "loose"})
+	_, err := r.Plan(context.Background())
+	assert.ErrorContains(t, err, "invalid validation level: loose")
+}
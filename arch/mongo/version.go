@@ -0,0 +1,58 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// documents opt in to optimistic concurrency control by declaring this field
+const VersionField = "version"
+
+var ErrVersionConflict = errors.New("document version conflict")
+
+func versionedFilter(filter bson.M, version int64) bson.M {
+	result := make(bson.M, len(filter)+1)
+	for k, v := range filter {
+		result[k] = v
+	}
+	if version == 0 {
+		// documents written before the version field was added are at version 0
+		result[VersionField] = bson.M{"$in": bson.A{int64(0), nil}}
+	} else {
+		result[VersionField] = version
+	}
+	return result
+}
+
+// the next version for the updates made with a pipeline e.g. Set(bson.M{VersionField: NextVersion})
+var NextVersion = bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$" + VersionField, int64(0)}}, int64(1)}}
+
+func versionedUpdate(update any) (any, error) {
+	switch u := update.(type) {
+	case bson.M:
+		result := make(bson.M, len(u)+1)
+		for k, v := range u {
+			result[k] = v
+		}
+
+		inc := bson.M{}
+		if existing, ok := u["$inc"].(bson.M); ok {
+			for k, v := range existing {
+				inc[k] = v
+			}
+		}
+		inc[VersionField] = int64(1)
+		result["$inc"] = inc
+
+		return result, nil
+	case mongo.Pipeline:
+		result := make(mongo.Pipeline, len(u), len(u)+1)
+		copy(result, u)
+		return append(result, bson.D{{Key: "$set", Value: bson.M{VersionField: NextVersion}}}), nil
+	default:
+		return nil, fmt.Errorf("unsupported versioned update of type %T", update)
+	}
+}
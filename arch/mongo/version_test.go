@@ -0,0 +1,52 @@
+package mongo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestVersionedFilter(t *testing.T) {
+	filter := bson.M{"_id": 1, "status": true}
+
+	assert.Equal(t, bson.M{"_id": 1, "status": true, "version": int64(4)}, versionedFilter(filter, 4))
+	assert.Equal(t, bson.M{"_id": 1, "status": true}, filter)
+}
+
+func TestVersionedFilter_Unversioned(t *testing.T) {
+	result := versionedFilter(bson.M{"_id": 1}, 0)
+	assert.Equal(t, bson.M{"$in": bson.A{int64(0), nil}}, result["version"])
+}
+
+func TestVersionedUpdate(t *testing.T) {
+	update := bson.M{"$set": bson.M{"title": "t"}}
+	result, err := versionedUpdate(update)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{
+		"$set": bson.M{"title": "t"},
+		"$inc": bson.M{"version": int64(1)},
+	}, result)
+	assert.NotContains(t, update, "$inc")
+
+	update = bson.M{"$inc": bson.M{"views": 1}}
+	result, err = versionedUpdate(update)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{"$inc": bson.M{"views": 1, "version": int64(1)}}, result)
+	assert.Equal(t, bson.M{"views": 1}, update["$inc"])
+}
+
+func TestVersionedUpdate_Pipeline(t *testing.T) {
+	stages := NewPipeline().Set(bson.M{"text": "$draftText"}).Stages()
+	result, err := versionedUpdate(stages)
+	assert.NoError(t, err)
+	assert.Equal(t, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"text": "$draftText"}}},
+		{{Key: "$set", Value: bson.M{"version": NextVersion}}},
+	}, result)
+	assert.Len(t, stages, 1)
+
+	_, err = versionedUpdate(bson.D{{Key: "$set", Value: bson.M{}}})
+	assert.Error(t, err)
+}
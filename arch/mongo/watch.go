@@ -0,0 +1,280 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const ResumeTokensCollectionName = "resume_tokens"
+
+const (
+	changeStreamUnsupportedCode = 40573
+	invalidResumeTokenCode      = 260
+	changeStreamFatalCode       = 280
+	changeStreamHistoryLostCode = 286
+)
+
+type OperationType string
+
+const (
+	OperationInsert  OperationType = "insert"
+	OperationUpdate  OperationType = "update"
+	OperationReplace OperationType = "replace"
+	OperationDelete  OperationType = "delete"
+)
+
+type ChangeEvent[T any] struct {
+	Operation     OperationType
+	ID            any
+	Document      *T
+	Previous      *T
+	UpdatedFields bson.M
+	RemovedFields []string
+	ResumeToken   bson.Raw
+}
+
+type ChangeHandler[T any] func(event *ChangeEvent[T]) error
+
+type ResumeTokenStore interface {
+	Load(ctx context.Context, name string) (bson.Raw, error)
+	Save(ctx context.Context, name string, token bson.Raw) error
+}
+
+type WatchConfig struct {
+	// identifies the subscription for the persisted resume token
+	Name       string
+	Operations []OperationType
+	Pipeline   Pipeline
+	// looks up the current document for the update events
+	FullDocument bool
+	// needs changeStreamPreAndPostImages enabled on the collection else Previous is nil
+	FullDocumentBeforeChange bool
+	TokenStore               ResumeTokenStore
+	MinRetryDelay            time.Duration
+	MaxRetryDelay            time.Duration
+}
+
+type changeEvent[T any] struct {
+	Operation   OperationType `bson:"operationType"`
+	DocumentKey struct {
+		ID any `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument             *T `bson:"fullDocument"`
+	FullDocumentBeforeChange *T `bson:"fullDocumentBeforeChange"`
+	UpdateDescription        *struct {
+		UpdatedFields bson.M   `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+}
+
+type watcher[T any] struct {
+	collection collection
+	cipher     *fieldCipher
+	config     WatchConfig
+	handler    ChangeHandler[T]
+	token      bson.Raw
+	received   bool
+}
+
+func newWatcher[T any](collection collection, keyring Keyring, config WatchConfig, handler ChangeHandler[T]) *watcher[T] {
+	if config.MinRetryDelay <= 0 {
+		config.MinRetryDelay = time.Second
+	}
+	if config.MaxRetryDelay < config.MinRetryDelay {
+		config.MaxRetryDelay = 30 * time.Second
+	}
+	return &watcher[T]{
+		collection: collection,
+		cipher:     newFieldCipher(reflect.TypeOf((*T)(nil)).Elem(), keyring),
+		config:     config,
+		handler:    handler,
+	}
+}
+
+// blocks until ctx is done, reconnecting from the last resume token when the stream breaks
+func (w *watcher[T]) run(ctx context.Context) error {
+	if w.config.TokenStore != nil {
+		token, err := w.config.TokenStore.Load(ctx, w.config.Name)
+		if err != nil {
+			return fmt.Errorf("error loading resume token for %s: %w", w.config.Name, err)
+		}
+		w.token = token
+	}
+
+	delay := w.config.MinRetryDelay
+	for {
+		w.received = false
+		err := w.stream(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if hasErrorCode(err, changeStreamUnsupportedCode) || errors.Is(err, ErrMemoryUnsupported) {
+			return fmt.Errorf("change streams are not available for %s: %w", w.collection.Name(), err)
+		}
+
+		if hasErrorCode(err, invalidResumeTokenCode, changeStreamFatalCode, changeStreamHistoryLostCode) {
+			fmt.Printf("change stream %s can not resume, restarting from now: %v\n", w.config.Name, err)
+			w.token = nil
+		}
+
+		if w.received {
+			delay = w.config.MinRetryDelay
+		}
+
+		fmt.Printf("change stream %s interrupted, reconnecting in %s: %v\n", w.config.Name, delay, err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > w.config.MaxRetryDelay {
+			delay = w.config.MaxRetryDelay
+		}
+	}
+}
+
+func (w *watcher[T]) stream(ctx context.Context) error {
+	opts := options.ChangeStream()
+	if w.config.FullDocument {
+		opts.SetFullDocument(options.UpdateLookup)
+	}
+	if w.config.FullDocumentBeforeChange {
+		opts.SetFullDocumentBeforeChange(options.WhenAvailable)
+	}
+	if w.token != nil {
+		opts.SetStartAfter(w.token)
+	}
+
+	cs, err := w.collection.Watch(ctx, watchPipeline(w.config), opts)
+	if err != nil {
+		return err
+	}
+	defer cs.Close(context.Background())
+
+	for cs.Next(ctx) {
+		w.received = true
+
+		var raw changeEvent[T]
+		if err := cs.Decode(&raw); err != nil {
+			return fmt.Errorf("error decoding change event: %w", err)
+		}
+
+		event := &ChangeEvent[T]{
+			Operation:   raw.Operation,
+			ID:          raw.DocumentKey.ID,
+			Document:    raw.FullDocument,
+			Previous:    raw.FullDocumentBeforeChange,
+			ResumeToken: cs.ResumeToken(),
+		}
+		if raw.UpdateDescription != nil {
+			event.UpdatedFields = raw.UpdateDescription.UpdatedFields
+			event.RemovedFields = raw.UpdateDescription.RemovedFields
+		}
+		// the UpdatedFields keep the encrypted values
+		if err := w.decrypt(event.Document, event.Previous); err != nil {
+			return err
+		}
+
+		// the event is delivered again after reconnect since the token is not advanced
+		if err := w.handler(event); err != nil {
+			return fmt.Errorf("error handling change event: %w", err)
+		}
+
+		w.token = event.ResumeToken
+		if w.config.TokenStore != nil {
+			if err := w.config.TokenStore.Save(ctx, w.config.Name, w.token); err != nil {
+				fmt.Printf("error saving resume token for %s: %v\n", w.config.Name, err)
+			}
+		}
+	}
+
+	if err := cs.Err(); err != nil {
+		return err
+	}
+	return errors.New("change stream closed")
+}
+
+func (w *watcher[T]) decrypt(docs ...*T) error {
+	if w.cipher == nil {
+		return nil
+	}
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		if err := w.cipher.decrypt(doc); err != nil {
+			return fmt.Errorf("error decrypting change event: %w", err)
+		}
+	}
+	return nil
+}
+
+func watchPipeline(config WatchConfig) mongo.Pipeline {
+	stages := mongo.Pipeline{}
+	if len(config.Operations) > 0 {
+		stages = append(stages, bson.D{{Key: "$match", Value: bson.M{"operationType": bson.M{"$in": config.Operations}}}})
+	}
+	if config.Pipeline != nil {
+		stages = append(stages, config.Pipeline.Stages()...)
+	}
+	return stages
+}
+
+func hasErrorCode(err error, codes ...int) bool {
+	var se mongo.ServerError
+	if !errors.As(err, &se) {
+		return false
+	}
+	for _, code := range codes {
+		if se.HasErrorCode(code) {
+			return true
+		}
+	}
+	return false
+}
+
+type resumeToken struct {
+	Name      string    `bson:"_id"`
+	Token     bson.Raw  `bson:"token"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+type resumeTokenStore struct {
+	db Database
+}
+
+func NewResumeTokenStore(db Database) ResumeTokenStore {
+	return &resumeTokenStore{db: db}
+}
+
+func (s *resumeTokenStore) Load(ctx context.Context, name string) (bson.Raw, error) {
+	var doc resumeToken
+	err := s.collection().FindOne(ctx, bson.M{"_id": name}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.Token, nil
+}
+
+func (s *resumeTokenStore) Save(ctx context.Context, name string, token bson.Raw) error {
+	update := bson.M{"$set": resumeToken{Name: name, Token: token, UpdatedAt: time.Now()}}
+	_, err := s.collection().UpdateOne(ctx, bson.M{"_id": name}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *resumeTokenStore) collection() *mongo.Collection {
+	return s.db.GetInstance().Collection(ResumeTokensCollectionName)
+}
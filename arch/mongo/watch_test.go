@@ -0,0 +1,54 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestWatchPipeline(t *testing.T) {
+	assert.Empty(t, watchPipeline(WatchConfig{}))
+
+	config := WatchConfig{
+		Operations: []OperationType{OperationUpdate, OperationDelete},
+		Pipeline:   NewPipeline().Match(bson.M{"ns.coll": "blogs"}),
+	}
+	assert.Equal(t, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"operationType": bson.M{"$in": []OperationType{OperationUpdate, OperationDelete}}}}},
+		{{Key: "$match", Value: bson.M{"ns.coll": "blogs"}}},
+	}, watchPipeline(config))
+}
+
+func TestChangeEvent_Decode(t *testing.T) {
+	id := primitive.NewObjectID()
+	raw, err := bson.Marshal(bson.M{
+		"operationType": "update",
+		"documentKey":   bson.M{"_id": id},
+		"fullDocument":  bson.M{"_id": id, "title": "new"},
+		"updateDescription": bson.M{
+			"updatedFields": bson.M{"title": "new"},
+			"removedFields": bson.A{"profile"},
+		},
+	})
+	assert.NoError(t, err)
+
+	var event changeEvent[mockDoc]
+	assert.NoError(t, bson.Unmarshal(raw, &event))
+	assert.Equal(t, OperationUpdate, event.Operation)
+	assert.Equal(t, id, event.DocumentKey.ID)
+	assert.Equal(t, "new", event.FullDocument.Title)
+	assert.Nil(t, event.FullDocumentBeforeChange)
+	assert.Equal(t, []string{"profile"}, event.UpdateDescription.RemovedFields)
+}
+
+func TestHasErrorCode(t *testing.T) {
+	err := fmt.Errorf("watch: %w", mongo.CommandError{Code: changeStreamHistoryLostCode})
+	assert.True(t, hasErrorCode(err, invalidResumeTokenCode, changeStreamHistoryLostCode))
+	assert.False(t, hasErrorCode(err, changeStreamUnsupportedCode))
+	assert.False(t, hasErrorCode(errors.New("network"), changeStreamUnsupportedCode))
+}
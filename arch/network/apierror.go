@@ -43,6 +43,11 @@ func newApiError(code int, message string, err error) ApiError {
 	return &apiError
 }
 
+// rebuilds an ApiError received from another service e.g. over nats
+func NewApiError(code int, message string, err error) ApiError {
+	return newApiError(code, message, err)
+}
+
 func NewBadRequestError(message string, err error) ApiError {
 	return newApiError(http.StatusBadRequest, message, err)
 }
@@ -59,6 +64,10 @@ func NewNotFoundError(message string, err error) ApiError {
 	return newApiError(http.StatusNotFound, message, err)
 }
 
+func NewConflictError(message string, err error) ApiError {
+	return newApiError(http.StatusConflict, message, err)
+}
+
 func NewInternalServerError(message string, err error) ApiError {
 	return newApiError(http.StatusInternalServerError, message, err)
 }
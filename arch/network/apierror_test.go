@@ -62,4 +62,15 @@ func TestNewInternalServerError(t *testing.T) {
 	assert.Equal(t, message, apiErr.GetMessage())
 	assert.EqualError(t, apiErr, fmt.Sprintf("%d - %s: %v", http.StatusInternalServerError, message, err))
 	assert.ErrorIs(t, apiErr, err)
-}
\ No newline at end of file
+}
+
+func TestNewConflictError(t *testing.T) {
+	message := "Conflict"
+	err := errors.New("version mismatch")
+	apiErr := NewConflictError(message, err)
+
+	assert.Equal(t, http.StatusConflict, apiErr.GetCode())
+	assert.Equal(t, message, apiErr.GetMessage())
+	assert.EqualError(t, apiErr, fmt.Sprintf("%d - %s: %v", http.StatusConflict, message, err))
+	assert.ErrorIs(t, apiErr, err)
+}
@@ -0,0 +1,44 @@
+package network
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+func SetETag(ctx *gin.Context, version int64) {
+	ctx.Header(ETagHeader, ETag(version))
+}
+
+/*
+ * Example -> If-Match: 3, If-Match: "3" and If-Match: W/"3" all give 3
+ * an empty header or * gives nil i.e. no precondition on the version
+ */
+func ParseIfMatch(value string) (*int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "*" {
+		return nil, nil
+	}
+
+	tag := strings.TrimPrefix(value, "W/")
+	if len(tag) >= 2 && strings.HasPrefix(tag, `"`) && strings.HasSuffix(tag, `"`) {
+		tag = tag[1 : len(tag)-1]
+	}
+
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version < 0 {
+		return nil, fmt.Errorf("%s must be a version or an etag", IfMatchHeader)
+	}
+
+	return &version, nil
+}
+
+func ReqIfMatch(ctx *gin.Context) (*int64, error) {
+	return ParseIfMatch(ctx.GetHeader(IfMatchHeader))
+}
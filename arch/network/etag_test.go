@@ -0,0 +1,50 @@
+package network
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	for _, value := range []string{"3", `"3"`, `W/"3"`, ` "3" `} {
+		version, err := ParseIfMatch(value)
+		assert.NoError(t, err, value)
+		if assert.NotNil(t, version, value) {
+			assert.Equal(t, int64(3), *version)
+		}
+	}
+}
+
+func TestParseIfMatch_NoPrecondition(t *testing.T) {
+	for _, value := range []string{"", "*"} {
+		version, err := ParseIfMatch(value)
+		assert.NoError(t, err)
+		assert.Nil(t, version)
+	}
+}
+
+func TestParseIfMatch_Invalid(t *testing.T) {
+	for _, value := range []string{"abc", `"-1"`, `"3`, "1.5"} {
+		_, err := ParseIfMatch(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestETag_RoundTrip(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	resp := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(resp)
+	ctx.Request = httptest.NewRequest(http.MethodPut, "/", nil)
+
+	SetETag(ctx, 7)
+	assert.Equal(t, `"7"`, resp.Header().Get(ETagHeader))
+
+	ctx.Request.Header.Set(IfMatchHeader, resp.Header().Get(ETagHeader))
+	version, err := ReqIfMatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), *version)
+}
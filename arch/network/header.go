@@ -3,4 +3,6 @@ package network
 const (
 	ApiKeyHeader        = "x-api-key"
 	AuthorizationHeader = "Authorization"
+	IfMatchHeader       = "If-Match"
+	ETagHeader          = "ETag"
 )
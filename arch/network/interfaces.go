@@ -28,6 +28,7 @@ type SendResponse interface {
 	ForbiddenError(message string, err error)
 	UnauthorizedError(message string, err error)
 	NotFoundError(message string, err error)
+	ConflictError(message string, err error)
 	InternalServerError(message string, err error)
 	MixedError(err error)
 }
@@ -85,6 +85,14 @@ func NewNotFoundResponse(message string) Response {
 	}
 }
 
+func NewConflictResponse(message string) Response {
+	return &response{
+		ResCode: failue_code,
+		Status:  http.StatusConflict,
+		Message: message,
+	}
+}
+
 func NewInternalServerErrorResponse(message string) Response {
 	return &response{
 		ResCode: failue_code,
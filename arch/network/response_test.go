@@ -78,3 +78,13 @@ func TestNewInternalServerErrorResponse(t *testing.T) {
 	assert.Equal(t, 500, resp.GetStatus())
 	assert.Nil(t, resp.GetData())
 }
+
+func TestNewConflictResponse(t *testing.T) {
+	message := "Conflict"
+	resp := NewConflictResponse(message)
+
+	assert.Equal(t, failue_code, resp.GetResCode())
+	assert.Equal(t, "Conflict", resp.GetMessage())
+	assert.Equal(t, 409, resp.GetStatus())
+	assert.Nil(t, resp.GetData())
+}
@@ -1,7 +1,14 @@
 package network
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
@@ -38,9 +45,37 @@ func (r *router) LoadControllers(controllers []Controller) {
 	}
 }
 
+/*
+ * returns on SIGINT or SIGTERM after the requests in progress are served, so that the deferred shutdown runs
+ * e.g. the background jobs are drained after the last request enqueued them
+ */
 func (r *router) Start(ip string, port uint16) {
 	address := fmt.Sprintf("%s:%d", ip, port)
-	r.engine.Run(address)
+	server := &http.Server{Addr: address, Handler: r.engine}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	failed := make(chan error, 1)
+	go func() {
+		fmt.Println("listening on", address)
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
+		}
+	}()
+
+	select {
+	case err := <-failed:
+		fmt.Println("server failed:", err)
+		return
+	case <-ctx.Done():
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		fmt.Println("server shutdown:", err)
+	}
 }
 
 func (r *router) RegisterValidationParsers(tagNameFunc validator.TagNameFunc) {
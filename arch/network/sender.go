@@ -53,6 +53,10 @@ func (s *send) NotFoundError(message string, err error) {
 	s.sendError(NewNotFoundError(message, err))
 }
 
+func (s *send) ConflictError(message string, err error) {
+	s.sendError(NewConflictError(message, err))
+}
+
 func (s *send) InternalServerError(message string, err error) {
 	s.sendError(NewInternalServerError(message, err))
 }
@@ -91,6 +95,8 @@ func (s *send) sendError(err ApiError) {
 		res = NewUnauthorizedResponse(err.GetMessage())
 	case http.StatusNotFound:
 		res = NewNotFoundResponse(err.GetMessage())
+	case http.StatusConflict:
+		res = NewConflictResponse(err.GetMessage())
 	case http.StatusInternalServerError:
 		if s.debug {
 			res = NewInternalServerErrorResponse(err.Unwrap().Error())
@@ -53,6 +53,20 @@ func TestSend_MixedError_UnauthorizedError(t *testing.T) {
 	assert.Contains(t, resp.Body.String(), fmt.Sprintf(`"message":"%s"`, "test message"))
 }
 
+func TestSend_MixedError_ConflictError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sender := NewResponseSender()
+	resp := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(resp)
+
+	err := NewConflictError("test message", nil)
+	sender.Send(ctx).MixedError(err)
+
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	assert.Contains(t, resp.Body.String(), fmt.Sprintf(`"code":"%s"`, failue_code))
+	assert.Contains(t, resp.Body.String(), fmt.Sprintf(`"message":"%s"`, "test message"))
+}
+
 func TestSend_SuccessMsgResponse(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	sender := NewResponseSender()
@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/unusualcodeorg/goserve/arch/breaker"
+)
+
+// the commands fail fast with it while the breaker of the store is open
+var ErrUnavailable = fmt.Errorf("redis unavailable: %w", breaker.ErrOpen)
+
+// a cache miss, any other error of the Cache[T] reads is a redis failure
+func IsMiss(err error) bool {
+	return errors.Is(err, redis.Nil)
+}
+
+type bypassBreakerKey struct{}
+
+// the probes and the health checks reach redis while the breaker is open
+func bypassBreaker(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassBreakerKey{}, true)
+}
+
+// the replies of redis, including a miss, show that it is up
+func isFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var reply redis.Error
+	return !errors.As(err, &reply)
+}
+
+/*
+ * Wraps every command of the client, so all the Cache[T], Locker and tag operations share the breaker
+ */
+type breakerHook struct {
+	breaker breaker.Breaker
+}
+
+func (h breakerHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h breakerHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if ctx.Value(bypassBreakerKey{}) != nil {
+			return next(ctx, cmd)
+		}
+		done, err := h.breaker.Allow()
+		if err != nil {
+			cmd.SetErr(ErrUnavailable)
+			return ErrUnavailable
+		}
+		err = next(ctx, cmd)
+		done(err)
+		return err
+	}
+}
+
+func (h breakerHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if ctx.Value(bypassBreakerKey{}) != nil {
+			return next(ctx, cmds)
+		}
+		done, err := h.breaker.Allow()
+		if err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(ErrUnavailable)
+			}
+			return ErrUnavailable
+		}
+		err = next(ctx, cmds)
+		done(err)
+		return err
+	}
+}
@@ -2,88 +2,493 @@ package redis
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"math/rand"
+	"sync/atomic"
 	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
 )
 
+// stored for the keys whose loader found nothing, read back as a miss by GetJSON
+var negativeValue = []byte("null")
+
 type Cache[T any] interface {
 	SetJSON(key string, value *T, expiration time.Duration) error
 	GetJSON(key string) (*T, error)
 	SetJSONList(key string, values []*T, expiration time.Duration) error
 	GetJSONList(key string) ([]*T, error)
+	GetOrLoad(key string, ttl time.Duration, loader func() (*T, error)) (*T, error)
+	GetOrLoadTagged(key string, ttl time.Duration, loader func() (*T, []string, error)) (*T, error)
+	GetOrLoadList(key string, ttl time.Duration, loader func() ([]*T, error)) ([]*T, error)
+	GetOrLoadListTagged(key string, ttl time.Duration, loader func() ([]*T, []string, error)) ([]*T, error)
+	Delete(keys ...string) error
+	Tag(key string, ttl time.Duration, tags ...string) error
+	InvalidateTag(tags ...string) error
+	Stats() CacheStats
+}
+
+type CacheConfig struct {
+	// caches the not found results of GetOrLoad for this long, 0 disables it
+	NegativeTTL time.Duration
+	// adds up to this fraction of the ttl at random so that the keys set together don't expire together
+	Jitter float64
+	// coalesces the loads across the instances with a redis lock, the loads are always coalesced in-process
+	Lock bool
+	// the lock expires after LockTTL if its holder dies, the others wait up to LockWait for its value
+	LockTTL  time.Duration
+	LockWait time.Duration
+	// keeps up to LocalSize decoded values in memory for at most LocalTTL, 0 disables it
+	// the local values are shared by the callers and must not be modified
+	// the writes and deletes evict the key from the local caches of all the instances over redis pub/sub
+	LocalSize int
+	LocalTTL  time.Duration
+	// encodes the values, JSONCodec when nil, the values are read with the codec they were written with
+	Codec Codec
+	// compresses the encoded values of CompressThreshold bytes or more, the smaller ones gain little for the cpu
+	Compression       Compression
+	CompressThreshold int
+}
+
+type TierStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+type CacheStats struct {
+	Local TierStats
+	Redis TierStats
+	// the entries in the local cache and the ones dropped to stay within LocalSize
+	LocalSize      int
+	LocalEvictions uint64
+}
+
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		NegativeTTL:       time.Minute,
+		Jitter:            0.1,
+		Lock:              true,
+		LockTTL:           5 * time.Second,
+		LockWait:          3 * time.Second,
+		LocalTTL:          time.Minute,
+		Codec:             JSONCodec,
+		CompressThreshold: 1024,
+	}
 }
 
 type cache[T any] struct {
-	context context.Context
-	store   Store
+	context     context.Context
+	store       Store
+	config      CacheConfig
+	group       singleflight.Group
+	locker      Locker
+	local       *localCache
+	localHits   atomic.Uint64
+	localMisses atomic.Uint64
+	redisHits   atomic.Uint64
+	redisMisses atomic.Uint64
 }
 
 func NewCache[T any](store Store) Cache[T] {
-	return &cache[T]{
+	return NewCacheWithConfig[T](store, DefaultCacheConfig())
+}
+
+/*
+ * Example -> config := redis.DefaultCacheConfig(); config.LocalSize = 1000
+ * redis.NewCacheWithConfig[dto.PublicBlog](store, config)
+ */
+func NewCacheWithConfig[T any](store Store, config CacheConfig) Cache[T] {
+	if config.Codec == nil {
+		config.Codec = JSONCodec
+	}
+	c := &cache[T]{
 		context: context.Background(),
 		store:   store,
+		config:  config,
 	}
+	if config.Lock {
+		// the loads are short, they don't need the extension, and the keys come from the requests so no fence is kept per key
+		c.locker = newUnfencedLocker(store, LockConfig{TTL: config.LockTTL})
+	}
+	if config.LocalSize > 0 && config.LocalTTL > 0 {
+		c.local = newLocalCache(config.LocalSize)
+		store.GetInstance().invalidations().register(c.local)
+	}
+	return c
 }
 
+/*
+ * The JSON methods encode with the codec of the CacheConfig, the names are kept for the existing callers
+ */
 func (c *cache[T]) SetJSON(key string, value *T, expiration time.Duration) error {
-	data, err := json.Marshal(value)
+	data, err := c.encode(value)
 	if err != nil {
 		return err
 	}
 
-	return c.store.GetInstance().Set(c.context, key, data, expiration).Err()
+	return c.write(key, data, expiration)
 }
 
 func (c *cache[T]) GetJSON(key string) (*T, error) {
+	if value, ok := c.fromLocal(key); ok {
+		if dest, ok := value.(*T); ok {
+			if dest == nil {
+				return nil, redis.Nil
+			}
+			return dest, nil
+		}
+	}
+
 	data, err := c.store.GetInstance().Get(c.context, key).Bytes()
+	c.countRedis(err)
 	if err != nil {
 		return nil, err
 	}
+	if isNegative(data) {
+		c.toLocal(key, (*T)(nil), c.config.LocalTTL)
+		return nil, redis.Nil
+	}
 
 	var dest T
-	err = json.Unmarshal(data, &dest)
+	err = decodeValue(data, &dest)
 	if err != nil {
 		return nil, err
 	}
 
+	c.toLocal(key, &dest, c.config.LocalTTL)
 	return &dest, nil
 }
 
 func (c *cache[T]) SetJSONList(key string, values []*T, expiration time.Duration) error {
-	var list []json.RawMessage
-	for _, value := range values {
-		data, err := json.Marshal(value)
-		if err != nil {
-			return err
+	data, err := c.encode(values)
+	if err != nil {
+		return err
+	}
+
+	return c.write(key, data, expiration)
+}
+
+func (c *cache[T]) GetJSONList(key string) ([]*T, error) {
+	if value, ok := c.fromLocal(key); ok {
+		if dest, ok := value.([]*T); ok {
+			if dest == nil {
+				return nil, redis.Nil
+			}
+			return dest, nil
 		}
-		list = append(list, data)
 	}
 
-	str, err := json.Marshal(list)
+	data, err := c.store.GetInstance().Get(c.context, key).Bytes()
+	c.countRedis(err)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if isNegative(data) {
+		c.toLocal(key, []*T(nil), c.config.LocalTTL)
+		return nil, redis.Nil
+	}
+
+	dest, err := c.decodeList(data)
+	if err != nil {
+		return nil, err
 	}
 
-	return c.store.GetInstance().Set(c.context, key, str, expiration).Err()
+	c.toLocal(key, dest, c.config.LocalTTL)
+	return dest, nil
 }
 
-func (c *cache[T]) GetJSONList(key string) ([]*T, error) {
-	str, err := c.store.GetInstance().Get(c.context, key).Result()
+// the keys are evicted from the local caches even when redis fails
+func (c *cache[T]) Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	// one key per command, the keys may be in different cluster slots
+	_, err := c.store.GetInstance().Pipelined(c.context, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(c.context, key)
+		}
+		return nil
+	})
+	return errors.Join(err, c.invalidate(keys...))
+}
+
+/*
+ * Example -> cache.Tag("blog_"+slug, 10*time.Minute, "blog:"+id)
+ * registers the key under the tags so that InvalidateTag("blog:"+id) deletes it
+ * the ttl is the one the key was set with, the tags of any cache share the same sets
+ */
+func (c *cache[T]) Tag(key string, ttl time.Duration, tags ...string) error {
+	if ttl > 0 {
+		ttl += time.Duration(max(c.config.Jitter, 0) * float64(ttl))
+	}
+	return addTags(c.context, c.store, key, ttl, tags...)
+}
+
+// deletes the keys of all the caches tagged with the tags
+func (c *cache[T]) InvalidateTag(tags ...string) error {
+	keys, err := invalidateTags(c.context, c.store, tags...)
+	return errors.Join(err, c.invalidate(keys...))
+}
+
+func (c *cache[T]) Stats() CacheStats {
+	stats := CacheStats{
+		Local: TierStats{Hits: c.localHits.Load(), Misses: c.localMisses.Load()},
+		Redis: TierStats{Hits: c.redisHits.Load(), Misses: c.redisMisses.Load()},
+	}
+	if c.local != nil {
+		stats.LocalSize, stats.LocalEvictions = c.local.stats()
+	}
+	return stats
+}
+
+/*
+ * Example -> blog, err := cache.GetOrLoad("blog_"+slug, 10*time.Minute, func() (*dto.PublicBlog, error) {...})
+ * the loader returns nil, nil when nothing is found, which is cached for NegativeTTL and returned as nil, nil
+ * the concurrent misses of a key wait for a single load, the loader errors are returned and not cached
+ * when redis fails the value is loaded without the cache
+ */
+func (c *cache[T]) GetOrLoad(key string, ttl time.Duration, loader func() (*T, error)) (*T, error) {
+	return c.GetOrLoadTagged(key, ttl, func() (*T, []string, error) {
+		value, err := loader()
+		return value, nil, err
+	})
+}
+
+/*
+ * Same as GetOrLoad, the loaded value is tagged with the tags from the loader once it is written, see Tag
+ * Example -> cache.GetOrLoadTagged(key, ttl, func() (*dto.PublicBlog, []string, error) {...; return blog, []string{"blog:"+id}, nil})
+ */
+func (c *cache[T]) GetOrLoadTagged(key string, ttl time.Duration, loader func() (*T, []string, error)) (*T, error) {
+	if value, ok := c.fromLocal(key); ok {
+		if dest, ok := value.(*T); ok {
+			return dest, nil
+		}
+	}
+
+	data, err := c.getOrLoad(key, ttl, func() ([]byte, []string, error) {
+		value, tags, err := loader()
+		if err != nil || value == nil {
+			return nil, tags, err
+		}
+		data, err := c.encode(value)
+		return data, tags, err
+	})
 	if err != nil {
 		return nil, err
 	}
+	if data == nil {
+		c.toLocal(key, (*T)(nil), c.localTTL(c.config.NegativeTTL))
+		return nil, nil
+	}
 
-	var list []json.RawMessage
-	if err := json.Unmarshal([]byte(str), &list); err != nil {
+	// decoded per caller so that the callers sharing a load don't share the value, unless it is kept locally
+	var dest T
+	if err := decodeValue(data, &dest); err != nil {
 		return nil, err
 	}
+	c.toLocal(key, &dest, c.localTTL(ttl))
+	return &dest, nil
+}
 
-	dest := make([]*T, len(list))
-	for i, data := range list {
-		if err := json.Unmarshal(data, &dest[i]); err != nil {
-			return nil, err
+/*
+ * Same as GetOrLoad for a list, a nil list from the loader is the not found result
+ */
+func (c *cache[T]) GetOrLoadList(key string, ttl time.Duration, loader func() ([]*T, error)) ([]*T, error) {
+	return c.GetOrLoadListTagged(key, ttl, func() ([]*T, []string, error) {
+		values, err := loader()
+		return values, nil, err
+	})
+}
+
+// same as GetOrLoadTagged for a list
+func (c *cache[T]) GetOrLoadListTagged(key string, ttl time.Duration, loader func() ([]*T, []string, error)) ([]*T, error) {
+	if value, ok := c.fromLocal(key); ok {
+		if dest, ok := value.([]*T); ok {
+			return dest, nil
+		}
+	}
+
+	data, err := c.getOrLoad(key, ttl, func() ([]byte, []string, error) {
+		values, tags, err := loader()
+		if err != nil || values == nil {
+			return nil, tags, err
 		}
+		data, err := c.encode(values)
+		return data, tags, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		c.toLocal(key, []*T(nil), c.localTTL(c.config.NegativeTTL))
+		return nil, nil
 	}
 
+	dest, err := c.decodeList(data)
+	if err != nil {
+		return nil, err
+	}
+	c.toLocal(key, dest, c.localTTL(ttl))
 	return dest, nil
 }
+
+// returns the encoded value, nil for not found
+func (c *cache[T]) getOrLoad(key string, ttl time.Duration, load func() ([]byte, []string, error)) ([]byte, error) {
+	if data, ok := c.cached(key); ok {
+		return data, nil
+	}
+
+	result, err, _ := c.group.Do(key, func() (any, error) {
+		if c.locker == nil {
+			return c.load(key, ttl, load)
+		}
+
+		lock, err := c.locker.TryLock(c.context, key)
+		if errors.Is(err, ErrNotAcquired) {
+			if data, ok := c.waitFor(key); ok {
+				return data, nil
+			}
+			// the holder is slow or gone, load without the lock rather than fail
+			return c.load(key, ttl, load)
+		}
+		if err != nil {
+			// redis is down, the load can't be coalesced across the instances
+			return c.load(key, ttl, load)
+		}
+		defer lock.Release(c.context)
+
+		// filled by the previous holder between the miss and the lock
+		if data, ok := c.cached(key); ok {
+			return data, nil
+		}
+		return c.load(key, ttl, load)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]byte), nil
+}
+
+func (c *cache[T]) load(key string, ttl time.Duration, load func() ([]byte, []string, error)) ([]byte, error) {
+	data, tags, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	value, ttl := data, c.jitter(ttl)
+	if data == nil {
+		if c.config.NegativeTTL <= 0 {
+			return nil, nil
+		}
+		value, ttl = negativeValue, c.config.NegativeTTL
+	}
+
+	// the value is served even if it can't be cached, it is tagged once written and the tag sets live as long as it
+	if err := c.write(key, value, ttl); err == nil {
+		addTags(c.context, c.store, key, ttl, tags...)
+	}
+	return data, nil
+}
+
+// with a local tier the other instances are told to drop their copy of the key
+func (c *cache[T]) write(key string, data []byte, ttl time.Duration) error {
+	if err := c.store.GetInstance().Set(c.context, key, data, ttl).Err(); err != nil {
+		return err
+	}
+	if c.local != nil {
+		return c.invalidate(key)
+	}
+	return nil
+}
+
+func (c *cache[T]) invalidate(keys ...string) error {
+	return c.store.GetInstance().invalidations().publish(c.context, keys...)
+}
+
+// ok is false on a miss, data is nil for a cached not found
+func (c *cache[T]) cached(key string) ([]byte, bool) {
+	data, err := c.store.GetInstance().Get(c.context, key).Bytes()
+	c.countRedis(err)
+	if err != nil {
+		return nil, false
+	}
+	if isNegative(data) {
+		return nil, true
+	}
+	return data, true
+}
+
+func (c *cache[T]) waitFor(key string) ([]byte, bool) {
+	deadline := time.Now().Add(c.config.LockWait)
+	for delay := 10 * time.Millisecond; time.Now().Before(deadline); delay = min(2*delay, 200*time.Millisecond) {
+		time.Sleep(delay)
+		if data, ok := c.cached(key); ok {
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+func (c *cache[T]) jitter(ttl time.Duration) time.Duration {
+	if c.config.Jitter <= 0 || ttl <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration(rand.Float64()*c.config.Jitter*float64(ttl))
+}
+
+func (c *cache[T]) encode(value any) ([]byte, error) {
+	return encodeValue(c.config.Codec, c.config.Compression, c.config.CompressThreshold, value)
+}
+
+// never nil, a nil list is the not found result
+func (c *cache[T]) decodeList(data []byte) ([]*T, error) {
+	var dest []*T
+	if err := decodeValue(data, &dest); err != nil {
+		return nil, err
+	}
+	if dest == nil {
+		dest = []*T{}
+	}
+	return dest, nil
+}
+
+func (c *cache[T]) fromLocal(key string) (any, bool) {
+	if c.local == nil {
+		return nil, false
+	}
+	value, ok := c.local.get(key)
+	if ok {
+		c.localHits.Add(1)
+	} else {
+		c.localMisses.Add(1)
+	}
+	return value, ok
+}
+
+func (c *cache[T]) toLocal(key string, value any, ttl time.Duration) {
+	if c.local != nil {
+		c.local.set(key, value, ttl)
+	}
+}
+
+// the local copy never outlives the redis one, 0 ttl in redis means no expiry
+func (c *cache[T]) localTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return c.config.LocalTTL
+	}
+	return min(ttl, c.config.LocalTTL)
+}
+
+func (c *cache[T]) countRedis(err error) {
+	switch err {
+	case nil:
+		c.redisHits.Add(1)
+	case redis.Nil:
+		c.redisMisses.Add(1)
+	}
+}
+
+func isNegative(data []byte) bool {
+	return string(data) == string(negativeValue)
+}
@@ -0,0 +1,235 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+type cacheItem struct {
+	Name string `json:"name"`
+}
+
+// every redis call fails, so the values are served by the loader alone
+func newUnreachableStore() Store {
+	return &store{
+		context:         context.Background(),
+		UniversalClient: redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}),
+	}
+}
+
+func TestGetOrLoadCoalesces(t *testing.T) {
+	cache := NewCache[cacheItem](newUnreachableStore())
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func() (*cacheItem, error) {
+		calls.Add(1)
+		<-release
+		return &cacheItem{Name: "a"}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*cacheItem, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			item, err := cache.GetOrLoad("item", time.Minute, loader)
+			assert.NoError(t, err)
+			results[i] = item
+		}(i)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	for _, item := range results {
+		assert.Equal(t, "a", item.Name)
+	}
+	assert.NotSame(t, results[0], results[1])
+}
+
+func TestGetOrLoadResults(t *testing.T) {
+	cache := NewCache[cacheItem](newUnreachableStore())
+
+	item, err := cache.GetOrLoad("missing", time.Minute, func() (*cacheItem, error) {
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, item)
+
+	failed := errors.New("failed")
+	_, err = cache.GetOrLoad("failing", time.Minute, func() (*cacheItem, error) {
+		return nil, failed
+	})
+	assert.ErrorIs(t, err, failed)
+
+	list, err := cache.GetOrLoadList("list", time.Minute, func() ([]*cacheItem, error) {
+		return []*cacheItem{{Name: "a"}, {Name: "b"}}, nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "b", list[1].Name)
+
+	list, err = cache.GetOrLoadList("empty", time.Minute, func() ([]*cacheItem, error) {
+		return []*cacheItem{}, nil
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, list)
+	assert.Empty(t, list)
+
+	list, err = cache.GetOrLoadList("missing_list", time.Minute, func() ([]*cacheItem, error) {
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, list)
+
+	// the value that could not be written is served untagged
+	item, err = cache.GetOrLoadTagged("tagged", time.Minute, func() (*cacheItem, []string, error) {
+		return &cacheItem{Name: "a"}, []string{"blog:1"}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "a", item.Name)
+
+	list, err = cache.GetOrLoadListTagged("tagged_list", time.Minute, func() ([]*cacheItem, []string, error) {
+		return nil, []string{"blog:1"}, nil
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, list)
+}
+
+func TestCacheJitter(t *testing.T) {
+	c := NewCache[cacheItem](newUnreachableStore()).(*cache[cacheItem])
+	for i := 0; i < 100; i++ {
+		ttl := c.jitter(time.Hour)
+		assert.GreaterOrEqual(t, ttl, time.Hour)
+		assert.LessOrEqual(t, ttl, time.Hour+6*time.Minute)
+	}
+
+	c.config.Jitter = 0
+	assert.Equal(t, time.Hour, c.jitter(time.Hour))
+}
+
+func TestCacheTags(t *testing.T) {
+	cache := NewCache[cacheItem](newUnreachableStore())
+
+	assert.Equal(t, "tag:blog:1", tagKey("blog:1"))
+	assert.NoError(t, cache.Tag("item", time.Minute))
+	assert.NoError(t, cache.InvalidateTag())
+
+	assert.Error(t, cache.Tag("item", time.Minute, "blog:1"))
+	assert.Error(t, cache.InvalidateTag("blog:1"))
+}
+
+func TestLocalCache(t *testing.T) {
+	local := newLocalCache(2)
+	local.set("a", 1, time.Minute)
+	local.set("b", 2, time.Minute)
+	local.get("a")
+	local.set("c", 3, time.Minute)
+
+	_, ok := local.get("b")
+	assert.False(t, ok, "least recently used is evicted")
+	value, ok := local.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+
+	local.set("c", 4, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	_, ok = local.get("c")
+	assert.False(t, ok, "expired")
+
+	local.delete("a")
+	_, ok = local.get("a")
+	assert.False(t, ok)
+
+	size, evictions := local.stats()
+	assert.Equal(t, 0, size)
+	assert.Equal(t, uint64(1), evictions)
+}
+
+func TestCacheLocalTier(t *testing.T) {
+	config := DefaultCacheConfig()
+	config.LocalSize = 10
+	cache := NewCacheWithConfig[cacheItem](newUnreachableStore(), config)
+
+	var calls int
+	loader := func() (*cacheItem, error) {
+		calls++
+		return &cacheItem{Name: "a"}, nil
+	}
+
+	first, err := cache.GetOrLoad("item", time.Minute, loader)
+	assert.NoError(t, err)
+	second, err := cache.GetOrLoad("item", time.Minute, loader)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Same(t, first, second)
+
+	found, err := cache.GetJSON("item")
+	assert.NoError(t, err)
+	assert.Same(t, first, found)
+
+	missing, err := cache.GetOrLoad("missing", time.Minute, func() (*cacheItem, error) { return nil, nil })
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+	_, err = cache.GetJSON("missing")
+	assert.ErrorIs(t, err, redis.Nil)
+
+	// redis is down but the local copy is still dropped
+	assert.Error(t, cache.Delete("item"))
+	_, err = cache.GetOrLoad("item", time.Minute, loader)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	stats := cache.Stats()
+	assert.Equal(t, uint64(3), stats.Local.Hits)
+	assert.Equal(t, uint64(3), stats.Local.Misses)
+	assert.Equal(t, uint64(0), stats.Redis.Hits)
+	assert.Equal(t, 2, stats.LocalSize)
+}
+
+func TestStoreDegraded(t *testing.T) {
+	s := NewStore(context.Background(), &Config{Host: "127.0.0.1", Port: 1, Optional: true, BreakerOpenTimeout: time.Minute})
+	assert.NotPanics(t, s.Connect)
+	assert.ErrorIs(t, s.Health(context.Background()), ErrUnavailable)
+
+	cache := NewCache[cacheItem](s)
+	start := time.Now()
+	_, err := cache.GetJSON("item")
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.False(t, IsMiss(err))
+	assert.Less(t, time.Since(start), 50*time.Millisecond, "fails fast")
+
+	item, err := cache.GetOrLoad("item", time.Minute, func() (*cacheItem, error) {
+		return &cacheItem{Name: "a"}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "a", item.Name)
+}
+
+func TestIsFailure(t *testing.T) {
+	assert.False(t, isFailure(nil))
+	assert.False(t, isFailure(redis.Nil))
+	assert.False(t, isFailure(context.Canceled))
+	assert.True(t, isFailure(errors.New("dial tcp: connection refused")))
+	assert.True(t, IsMiss(redis.Nil))
+}
+
+// the cache keys come from the requests, a fence counter kept per key would never be expired
+func TestGetOrLoadLockIsUnfenced(t *testing.T) {
+	c := NewCache[cacheItem](newUnreachableStore()).(*cache[cacheItem])
+	assert.False(t, c.locker.(*locker).backend.(*redisLockBackend).fenced)
+
+	l := NewLocker(newUnreachableStore(), DefaultLockConfig()).(*locker)
+	assert.True(t, l.backend.(*redisLockBackend).fenced)
+}
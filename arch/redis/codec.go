@@ -0,0 +1,216 @@
+package redis
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ugorji/go/codec"
+)
+
+/*
+ * The encoded values start with a header: formatMagic, formatVersion, codec id, compression id
+ * the reads use the codec and compression of the header, so changing them in the CacheConfig
+ * keeps the existing keys readable, the values without a header were written as plain json
+ */
+const (
+	formatMagic   byte = 0xff
+	formatVersion byte = 1
+	headerLen          = 4
+)
+
+var ErrUnknownFormat = errors.New("unknown cache value format")
+
+type Codec interface {
+	// stored in the header of the values, unique among the registered codecs
+	ID() byte
+	Marshal(value any) ([]byte, error)
+	Unmarshal(data []byte, dest any) error
+}
+
+var (
+	JSONCodec    Codec = jsonCodec{}
+	MsgpackCodec Codec = newMsgpackCodec()
+	GobCodec     Codec = gobCodec{}
+)
+
+var codecs = struct {
+	sync.RWMutex
+	byID map[byte]Codec
+}{byID: map[byte]Codec{}}
+
+func init() {
+	RegisterCodec(JSONCodec)
+	RegisterCodec(MsgpackCodec)
+	RegisterCodec(GobCodec)
+}
+
+// makes the values written with the codec readable, the built-in codecs are registered already
+func RegisterCodec(c Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	if existing, ok := codecs.byID[c.ID()]; ok && existing != c {
+		panic(fmt.Sprintf("redis: codec id %d is already registered", c.ID()))
+	}
+	codecs.byID[c.ID()] = c
+}
+
+func codecOf(id byte) (Codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	c, ok := codecs.byID[id]
+	return c, ok
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ID() byte { return 1 }
+
+func (jsonCodec) Marshal(value any) ([]byte, error) { return json.Marshal(value) }
+
+func (jsonCodec) Unmarshal(data []byte, dest any) error { return json.Unmarshal(data, dest) }
+
+// uses the json tags of the fields, so the dtos need no extra tags
+type msgpackCodec struct {
+	handle *codec.MsgpackHandle
+}
+
+func newMsgpackCodec() msgpackCodec {
+	handle := &codec.MsgpackHandle{WriteExt: true}
+	handle.RawToString = true
+	return msgpackCodec{handle: handle}
+}
+
+func (msgpackCodec) ID() byte { return 2 }
+
+func (c msgpackCodec) Marshal(value any) ([]byte, error) {
+	var data []byte
+	err := codec.NewEncoderBytes(&data, c.handle).Encode(value)
+	return data, err
+}
+
+func (c msgpackCodec) Unmarshal(data []byte, dest any) error {
+	return codec.NewDecoderBytes(data, c.handle).Decode(dest)
+}
+
+// the lists can't hold nil values with gob
+type gobCodec struct{}
+
+func (gobCodec) ID() byte { return 3 }
+
+func (gobCodec) Marshal(value any) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(value)
+	return buf.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(data []byte, dest any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(dest)
+}
+
+type Compression byte
+
+const (
+	CompressionNone Compression = iota
+	CompressionSnappy
+	CompressionZstd
+)
+
+// decoding a value can't take more memory than this
+const maxDecompressedLen = 64 << 20
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+func zstdCoders() (*zstd.Encoder, *zstd.Decoder) {
+	zstdOnce.Do(func() {
+		zstdEncoder, _ = zstd.NewWriter(nil)
+		zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecompressedLen))
+	})
+	return zstdEncoder, zstdDecoder
+}
+
+func compress(compression Compression, data []byte) ([]byte, error) {
+	switch compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionSnappy:
+		return snappy.Encode(nil, data), nil
+	case CompressionZstd:
+		encoder, _ := zstdCoders()
+		return encoder.EncodeAll(data, nil), nil
+	}
+	return nil, fmt.Errorf("%w: compression %d", ErrUnknownFormat, compression)
+}
+
+func decompress(compression Compression, data []byte) ([]byte, error) {
+	switch compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionSnappy:
+		n, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if n > maxDecompressedLen {
+			return nil, fmt.Errorf("%w: %d bytes decompressed", ErrUnknownFormat, n)
+		}
+		return snappy.Decode(nil, data)
+	case CompressionZstd:
+		_, decoder := zstdCoders()
+		return decoder.DecodeAll(data, nil)
+	}
+	return nil, fmt.Errorf("%w: compression %d", ErrUnknownFormat, compression)
+}
+
+/*
+ * compresses only the values of threshold bytes or more, and only when it makes them smaller
+ */
+func encodeValue(c Codec, compression Compression, threshold int, value any) ([]byte, error) {
+	payload, err := c.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	used := CompressionNone
+	if compression != CompressionNone && len(payload) >= threshold {
+		compressed, err := compress(compression, payload)
+		if err != nil {
+			return nil, err
+		}
+		if len(compressed) < len(payload) {
+			payload, used = compressed, compression
+		}
+	}
+
+	data := make([]byte, headerLen, headerLen+len(payload))
+	data[0], data[1], data[2], data[3] = formatMagic, formatVersion, c.ID(), byte(used)
+	return append(data, payload...), nil
+}
+
+func decodeValue(data []byte, dest any) error {
+	if len(data) == 0 || data[0] != formatMagic {
+		return json.Unmarshal(data, dest)
+	}
+	if len(data) < headerLen || data[1] != formatVersion {
+		return fmt.Errorf("%w: header %x", ErrUnknownFormat, data[:min(len(data), headerLen)])
+	}
+
+	c, ok := codecOf(data[2])
+	if !ok {
+		return fmt.Errorf("%w: codec %d", ErrUnknownFormat, data[2])
+	}
+	payload, err := decompress(Compression(data[3]), data[headerLen:])
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(payload, dest)
+}
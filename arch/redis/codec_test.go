@@ -0,0 +1,80 @@
+package redis
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type codecItem struct {
+	ID        [12]byte  `json:"_id"`
+	Title     string    `json:"title"`
+	ImgURL    *string   `json:"imgUrl,omitempty"`
+	Tags      []string  `json:"tags"`
+	Score     float64   `json:"score"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newCodecItem(text string) *codecItem {
+	url := "https://example.com/a.png"
+	return &codecItem{
+		ID:        [12]byte{1, 2, 3},
+		Title:     text,
+		ImgURL:    &url,
+		Tags:      []string{"GO", "REDIS"},
+		Score:     0.5,
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	long := strings.Repeat("compressible ", 200)
+	for _, c := range []Codec{JSONCodec, MsgpackCodec, GobCodec} {
+		for _, compression := range []Compression{CompressionNone, CompressionSnappy, CompressionZstd} {
+			item := newCodecItem(long)
+			data, err := encodeValue(c, compression, 1024, item)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte{formatMagic, formatVersion, c.ID(), byte(compression)}, data[:headerLen])
+
+			var dest codecItem
+			assert.NoError(t, decodeValue(data, &dest))
+			assert.Equal(t, *item, dest)
+
+			list := []*codecItem{newCodecItem("a"), newCodecItem("b")}
+			data, err = encodeValue(c, compression, 1024, list)
+			assert.NoError(t, err)
+			assert.Equal(t, byte(CompressionNone), data[3], "below the threshold")
+
+			var destList []*codecItem
+			assert.NoError(t, decodeValue(data, &destList))
+			assert.Equal(t, list, destList)
+		}
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	// written by SetJSONList before the values had a header
+	var legacy []*codecItem
+	assert.NoError(t, decodeValue([]byte(`[{"title":"a"},{"title":"b"}]`), &legacy))
+	assert.Equal(t, "b", legacy[1].Title)
+
+	var dest codecItem
+	assert.ErrorIs(t, decodeValue([]byte{formatMagic, 9, 1, 0}, &dest), ErrUnknownFormat)
+	assert.ErrorIs(t, decodeValue([]byte{formatMagic, formatVersion, 99, 0}, &dest), ErrUnknownFormat)
+	assert.ErrorIs(t, decodeValue([]byte{formatMagic, formatVersion, 1, 9}, &dest), ErrUnknownFormat)
+	assert.ErrorIs(t, decodeValue([]byte{formatMagic, formatVersion}, &dest), ErrUnknownFormat)
+
+	c := NewCacheWithConfig[codecItem](newUnreachableStore(), CacheConfig{Codec: GobCodec}).(*cache[codecItem])
+	data, err := c.encode([]*codecItem{})
+	assert.NoError(t, err)
+	list, err := c.decodeList(data)
+	assert.NoError(t, err)
+	assert.NotNil(t, list)
+	assert.Empty(t, list)
+
+	assert.Panics(t, func() { RegisterCodec(jsonCodecCopy{}) })
+}
+
+type jsonCodecCopy struct{ jsonCodec }
@@ -0,0 +1,129 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	ModeStandalone = "standalone"
+	ModeSentinel   = "sentinel"
+	ModeCluster    = "cluster"
+)
+
+func (c *Config) mode() string {
+	if c.Mode == "" {
+		return ModeStandalone
+	}
+	return c.Mode
+}
+
+func (c *Config) addrs() []string {
+	hosts := strings.Split(c.Host, ",")
+	for i, h := range hosts {
+		h = strings.TrimSpace(h)
+		if !strings.Contains(h, ":") && c.Port > 0 {
+			h = fmt.Sprintf("%s:%d", h, c.Port)
+		}
+		hosts[i] = h
+	}
+	return hosts
+}
+
+func (c *Config) universalOptions() (*redis.UniversalOptions, error) {
+	opts := &redis.UniversalOptions{
+		Addrs:            c.addrs(),
+		DB:               c.DB,
+		Username:         c.Username,
+		Password:         c.Pwd,
+		MasterName:       c.MasterName,
+		SentinelPassword: c.SentinelPwd,
+		PoolSize:         c.PoolSize,
+		MinIdleConns:     c.MinIdleConns,
+		PoolTimeout:      c.PoolTimeout,
+		DialTimeout:      c.DialTimeout,
+		ReadTimeout:      c.ReadTimeout,
+		WriteTimeout:     c.ReadTimeout,
+	}
+
+	switch c.mode() {
+	case ModeStandalone:
+		if len(opts.Addrs) > 1 {
+			return nil, fmt.Errorf("redis %s mode takes a single host, got %s", ModeStandalone, c.Host)
+		}
+	case ModeSentinel:
+		if c.MasterName == "" {
+			return nil, fmt.Errorf("redis %s mode needs the master name", ModeSentinel)
+		}
+	case ModeCluster:
+		if c.DB != 0 {
+			return nil, fmt.Errorf("redis %s mode only has the db 0, got %d", ModeCluster, c.DB)
+		}
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q, use %s, %s or %s", c.Mode, ModeStandalone, ModeSentinel, ModeCluster)
+	}
+
+	if c.PoolSize > 0 && c.MinIdleConns > c.PoolSize {
+		return nil, fmt.Errorf("redis min idle conns %d is greater than pool size %d", c.MinIdleConns, c.PoolSize)
+	}
+
+	if c.TLS || c.TLSCAFile != "" || c.TLSCertKeyFile != "" {
+		tlsConfig, err := c.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+
+	return opts, nil
+}
+
+// built by the mode, redis.NewUniversalClient would take a cluster given by a single seed host for a standalone
+func (c *Config) newClient() (redis.UniversalClient, error) {
+	opts, err := c.universalOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.mode() {
+	case ModeSentinel:
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case ModeCluster:
+		return redis.NewClusterClient(opts.Cluster()), nil
+	default:
+		return redis.NewClient(opts.Simple()), nil
+	}
+}
+
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: c.TLSInsecure}
+
+	if c.TLSCAFile != "" {
+		ca, err := os.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading redis tls ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("redis tls ca file has no valid certificates")
+		}
+		config.RootCAs = pool
+	}
+
+	if c.TLSCertKeyFile != "" {
+		// the client certificate and its private key in a single pem file
+		cert, err := tls.LoadX509KeyPair(c.TLSCertKeyFile, c.TLSCertKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading redis tls certificate key file: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_Addrs(t *testing.T) {
+	config := Config{Host: "localhost", Port: 6379}
+	assert.Equal(t, []string{"localhost:6379"}, config.addrs())
+
+	config = Config{Host: "redis1, redis2:26380", Port: 26379}
+	assert.Equal(t, []string{"redis1:26379", "redis2:26380"}, config.addrs())
+}
+
+func TestConfig_UniversalOptions(t *testing.T) {
+	config := Config{
+		Host:         "localhost",
+		Port:         6379,
+		Username:     "app",
+		Pwd:          "pwd",
+		DB:           2,
+		PoolSize:     20,
+		MinIdleConns: 5,
+		PoolTimeout:  time.Second,
+		ReadTimeout:  2 * time.Second,
+	}
+
+	opts, err := config.universalOptions()
+	assert.NoError(t, err)
+	assert.Equal(t, "app", opts.Username)
+	assert.Equal(t, 2, opts.DB)
+	assert.Equal(t, 20, opts.PoolSize)
+	assert.Equal(t, 5, opts.MinIdleConns)
+	assert.Equal(t, 2*time.Second, opts.WriteTimeout)
+	assert.Nil(t, opts.TLSConfig)
+
+	config.MinIdleConns = 30
+	_, err = config.universalOptions()
+	assert.Error(t, err)
+
+	_, err = (&Config{Host: "a,b", Port: 6379}).universalOptions()
+	assert.Error(t, err)
+	_, err = (&Config{Host: "a", Port: 26379, Mode: ModeSentinel}).universalOptions()
+	assert.Error(t, err)
+	_, err = (&Config{Host: "a", Port: 6379, Mode: ModeCluster, DB: 1}).universalOptions()
+	assert.Error(t, err)
+	_, err = (&Config{Host: "a", Port: 6379, Mode: "replica"}).universalOptions()
+	assert.Error(t, err)
+}
+
+func TestConfig_NewClient(t *testing.T) {
+	client, err := (&Config{Host: "localhost", Port: 6379}).newClient()
+	assert.NoError(t, err)
+	assert.IsType(t, &redis.Client{}, client)
+
+	client, err = (&Config{Host: "sentinel1,sentinel2", Port: 26379, Mode: ModeSentinel, MasterName: "mymaster"}).newClient()
+	assert.NoError(t, err)
+	assert.IsType(t, &redis.Client{}, client)
+
+	// a single seed node is still a cluster
+	client, err = (&Config{Host: "node1", Port: 6379, Mode: ModeCluster}).newClient()
+	assert.NoError(t, err)
+	assert.IsType(t, &redis.ClusterClient{}, client)
+}
+
+func TestConfig_TLS(t *testing.T) {
+	config := Config{Host: "localhost", Port: 6380, TLS: true, TLSInsecure: true}
+	opts, err := config.universalOptions()
+	assert.NoError(t, err)
+	assert.True(t, opts.TLSConfig.InsecureSkipVerify)
+
+	config.TLSCAFile = "nonexistent-ca.pem"
+	_, err = config.universalOptions()
+	assert.Error(t, err)
+}
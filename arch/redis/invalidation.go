@@ -0,0 +1,125 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const invalidationChannel = "cache:invalidate"
+
+type invalidation struct {
+	Origin string   `json:"origin"`
+	Keys   []string `json:"keys"`
+}
+
+/*
+ * Evicts the keys from the local caches of every instance sharing the redis
+ * one subscription per store, shared by all its caches with a local tier
+ * the local caches are cleared on every (re)subscription since the messages sent while disconnected are lost
+ */
+type invalidationBus struct {
+	store  *store
+	origin string
+	mu     sync.RWMutex
+	locals []*localCache
+	pubsub *redis.PubSub
+}
+
+func newInvalidationBus(store *store) *invalidationBus {
+	origin := make([]byte, 8)
+	rand.Read(origin)
+	return &invalidationBus{
+		store:  store,
+		origin: hex.EncodeToString(origin),
+	}
+}
+
+func (b *invalidationBus) register(local *localCache) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.locals = append(b.locals, local)
+	if b.pubsub == nil {
+		b.pubsub = b.store.Subscribe(b.store.context, invalidationChannel)
+		go b.listen(b.store.context, b.pubsub)
+	}
+}
+
+// evicts the keys in this instance right away and in the others when they receive the message
+func (b *invalidationBus) publish(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	b.evict(keys...)
+
+	data, err := json.Marshal(invalidation{Origin: b.origin, Keys: keys})
+	if err != nil {
+		return err
+	}
+	return b.store.Publish(ctx, invalidationChannel, data).Err()
+}
+
+func (b *invalidationBus) evict(keys ...string) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, local := range b.locals {
+		local.delete(keys...)
+	}
+}
+
+func (b *invalidationBus) clear() {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, local := range b.locals {
+		local.clear()
+	}
+}
+
+func (b *invalidationBus) listen(ctx context.Context, pubsub *redis.PubSub) {
+	for delay := 100 * time.Millisecond; ; {
+		msg, err := pubsub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, redis.ErrClosed) {
+				return
+			}
+			// go-redis reconnects and resubscribes on the next receive
+			time.Sleep(delay)
+			delay = min(2*delay, 5*time.Second)
+			continue
+		}
+		delay = 100 * time.Millisecond
+
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			b.clear()
+		case *redis.Message:
+			var inv invalidation
+			if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+				fmt.Println("invalid cache invalidation:", err)
+				continue
+			}
+			if inv.Origin != b.origin {
+				b.evict(inv.Keys...)
+			}
+		}
+	}
+}
+
+func (b *invalidationBus) close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pubsub == nil {
+		return nil
+	}
+	err := b.pubsub.Close()
+	b.pubsub = nil
+	return err
+}
@@ -0,0 +1,101 @@
+package redis
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// in-process LRU with a ttl per key, the values are shared by the readers
+type localCache struct {
+	mu        sync.Mutex
+	size      int
+	items     map[string]*list.Element
+	order     *list.List
+	evictions uint64
+}
+
+type localEntry struct {
+	key     string
+	value   any
+	expires time.Time
+}
+
+func newLocalCache(size int) *localCache {
+	return &localCache{
+		size:  size,
+		items: make(map[string]*list.Element, size),
+		order: list.New(),
+	}
+}
+
+func (l *localCache) get(key string) (any, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	elem, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*localEntry)
+	if !entry.expires.After(time.Now()) {
+		l.remove(elem)
+		return nil, false
+	}
+	l.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (l *localCache) set(key string, value any, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	expires := time.Now().Add(ttl)
+	if elem, ok := l.items[key]; ok {
+		entry := elem.Value.(*localEntry)
+		entry.value = value
+		entry.expires = expires
+		l.order.MoveToFront(elem)
+		return
+	}
+
+	l.items[key] = l.order.PushFront(&localEntry{key: key, value: value, expires: expires})
+	for l.order.Len() > l.size {
+		l.remove(l.order.Back())
+		l.evictions++
+	}
+}
+
+func (l *localCache) delete(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		if elem, ok := l.items[key]; ok {
+			l.remove(elem)
+		}
+	}
+}
+
+func (l *localCache) clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.items = make(map[string]*list.Element, l.size)
+	l.order.Init()
+}
+
+func (l *localCache) stats() (int, uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len(), l.evictions
+}
+
+func (l *localCache) remove(elem *list.Element) {
+	l.order.Remove(elem)
+	delete(l.items, elem.Value.(*localEntry).key)
+}
@@ -0,0 +1,305 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrNotAcquired = errors.New("redis: lock is held by another")
+	ErrLockLost    = errors.New("redis: lock expired or taken by another")
+)
+
+// sets the lock if free and increments its fencing counter, the keys share a hash slot for the cluster
+var acquireScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0
+`)
+
+var extendScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// deletes the lock only if it is still held with the token, it may have expired and been taken by another
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+type LockConfig struct {
+	// the lock expires after TTL if its holder dies without releasing it
+	TTL time.Duration
+	// extends the lock every TTL/3 while held, it is lost when it can't be extended before it expires
+	AutoExtend bool
+	// Lock retries with an exponential backoff from RetryMin up to RetryMax, with jitter
+	RetryMin time.Duration
+	RetryMax time.Duration
+}
+
+func DefaultLockConfig() LockConfig {
+	return LockConfig{
+		TTL:        10 * time.Second,
+		AutoExtend: true,
+		RetryMin:   10 * time.Millisecond,
+		RetryMax:   500 * time.Millisecond,
+	}
+}
+
+/*
+ * Example -> lock, err := locker.Lock(ctx, "migrations")
+ * defer lock.Release(ctx)
+ * the work must stop when lock.Done() is closed, another may hold the lock from then on
+ * the writes guarded by the lock should carry lock.Fence() so that the store can reject a stale holder
+ */
+type Locker interface {
+	// ErrNotAcquired when another holds the lock
+	TryLock(ctx context.Context, key string) (Lock, error)
+	// waits for the lock until ctx is done
+	Lock(ctx context.Context, key string) (Lock, error)
+	// runs fn holding the lock, its ctx is cancelled if the lock is lost
+	WithLock(ctx context.Context, key string, fn func(ctx context.Context, fence int64) error) error
+}
+
+type Lock interface {
+	Key() string
+	// increases with every acquisition of the key, never repeats
+	Fence() int64
+	// resets the ttl, ErrLockLost if the lock is no longer held
+	Extend(ctx context.Context) error
+	// ErrLockLost if the lock expired before, it may be held by another already
+	Release(ctx context.Context) error
+	// closed when the lock is released or lost
+	Done() <-chan struct{}
+}
+
+type lockBackend interface {
+	// fence is 0 when the lock is held by another
+	acquire(ctx context.Context, key string, token string, ttl time.Duration) (int64, error)
+	extend(ctx context.Context, key string, token string, ttl time.Duration) (bool, error)
+	release(ctx context.Context, key string, token string) (bool, error)
+}
+
+type locker struct {
+	backend lockBackend
+	config  LockConfig
+}
+
+func NewLocker(store Store, config LockConfig) Locker {
+	return newLocker(&redisLockBackend{store: store, fenced: true}, config)
+}
+
+// without the fencing counter, which is never expired, for the locks taken on arbitrary keys e.g. the cache loads
+func newUnfencedLocker(store Store, config LockConfig) Locker {
+	return newLocker(&redisLockBackend{store: store}, config)
+}
+
+func newLocker(backend lockBackend, config LockConfig) *locker {
+	if config.TTL <= 0 {
+		config.TTL = DefaultLockConfig().TTL
+	}
+	if config.RetryMin <= 0 {
+		config.RetryMin = DefaultLockConfig().RetryMin
+	}
+	config.RetryMax = max(config.RetryMax, config.RetryMin)
+	return &locker{backend: backend, config: config}
+}
+
+func (l *locker) TryLock(ctx context.Context, key string) (Lock, error) {
+	token := newToken()
+	start := time.Now()
+	fence, err := l.backend.acquire(ctx, key, token, l.config.TTL)
+	if err != nil {
+		return nil, err
+	}
+	if fence == 0 {
+		return nil, ErrNotAcquired
+	}
+
+	lock := &lock{
+		locker:  l,
+		key:     key,
+		token:   token,
+		fence:   fence,
+		expires: start.Add(l.config.TTL),
+		done:    make(chan struct{}),
+	}
+	if l.config.AutoExtend {
+		go lock.keepAlive()
+	}
+	return lock, nil
+}
+
+func (l *locker) Lock(ctx context.Context, key string) (Lock, error) {
+	for delay := l.config.RetryMin; ; delay = min(2*delay, l.config.RetryMax) {
+		lock, err := l.TryLock(ctx, key)
+		if !errors.Is(err, ErrNotAcquired) {
+			return lock, err
+		}
+
+		// the waiters don't retry in step
+		wait := delay/2 + time.Duration(mrand.Int63n(int64(delay/2)+1))
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %s: %w", ErrNotAcquired, key, ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (l *locker) WithLock(ctx context.Context, key string, fn func(ctx context.Context, fence int64) error) error {
+	lock, err := l.Lock(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-lock.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err = fn(ctx, lock.Fence())
+	// the caller's ctx may be done already, the lock should still be released
+	return errors.Join(err, lock.Release(context.WithoutCancel(ctx)))
+}
+
+type lock struct {
+	locker *locker
+	key    string
+	token  string
+	fence  int64
+	mu     sync.Mutex
+	// when the lock expires in redis unless extended, by the local clock
+	expires  time.Time
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+func (l *lock) Key() string {
+	return l.key
+}
+
+func (l *lock) Fence() int64 {
+	return l.fence
+}
+
+func (l *lock) Done() <-chan struct{} {
+	return l.done
+}
+
+func (l *lock) Extend(ctx context.Context) error {
+	start := time.Now()
+	ok, err := l.locker.backend.extend(ctx, l.key, l.token, l.locker.config.TTL)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		l.finish()
+		return fmt.Errorf("%w: %s", ErrLockLost, l.key)
+	}
+
+	l.mu.Lock()
+	l.expires = start.Add(l.locker.config.TTL)
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *lock) Release(ctx context.Context) error {
+	l.finish()
+	ok, err := l.locker.backend.release(ctx, l.key, l.token)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrLockLost, l.key)
+	}
+	return nil
+}
+
+func (l *lock) finish() {
+	l.doneOnce.Do(func() { close(l.done) })
+}
+
+// a failed extension is retried until the lock would have expired, only then it is given up
+func (l *lock) keepAlive() {
+	ticker := time.NewTicker(l.locker.config.TTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+
+		err := l.Extend(context.Background())
+		if errors.Is(err, ErrLockLost) {
+			return
+		}
+
+		l.mu.Lock()
+		expired := !time.Now().Before(l.expires)
+		l.mu.Unlock()
+		if err != nil && expired {
+			l.finish()
+			return
+		}
+	}
+}
+
+func newToken() string {
+	token := make([]byte, 16)
+	rand.Read(token)
+	return hex.EncodeToString(token)
+}
+
+type redisLockBackend struct {
+	store Store
+	// the unfenced locks all have the fence 1
+	fenced bool
+}
+
+// the braces make the lock and its fence counter share a cluster hash slot
+func lockKeys(key string) []string {
+	return []string{"lock:{" + key + "}", "lock:{" + key + "}:fence"}
+}
+
+func (b *redisLockBackend) acquire(ctx context.Context, key string, token string, ttl time.Duration) (int64, error) {
+	if !b.fenced {
+		ok, err := b.store.GetInstance().SetNX(ctx, lockKeys(key)[0], token, ttl).Result()
+		if err != nil || !ok {
+			return 0, err
+		}
+		return 1, nil
+	}
+	return acquireScript.Run(ctx, b.store.GetInstance(), lockKeys(key), token, ttl.Milliseconds()).Int64()
+}
+
+func (b *redisLockBackend) extend(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	n, err := extendScript.Run(ctx, b.store.GetInstance(), lockKeys(key)[:1], token, ttl.Milliseconds()).Int64()
+	return n == 1, err
+}
+
+func (b *redisLockBackend) release(ctx context.Context, key string, token string) (bool, error) {
+	n, err := releaseScript.Run(ctx, b.store.GetInstance(), lockKeys(key)[:1], token).Int64()
+	return n == 1, err
+}
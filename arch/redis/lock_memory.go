@@ -0,0 +1,78 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/*
+ * Same as NewLocker within a single process, for the unit tests of the services using a Locker
+ */
+func NewMemoryLocker(config LockConfig) Locker {
+	return newLocker(newMemoryLockBackend(time.Now), config)
+}
+
+type memoryLock struct {
+	token   string
+	expires time.Time
+}
+
+type memoryLockBackend struct {
+	mu     sync.Mutex
+	now    func() time.Time
+	locks  map[string]memoryLock
+	fences map[string]int64
+}
+
+func newMemoryLockBackend(now func() time.Time) *memoryLockBackend {
+	return &memoryLockBackend{
+		now:    now,
+		locks:  map[string]memoryLock{},
+		fences: map[string]int64{},
+	}
+}
+
+// the token of the lock if it has not expired
+func (b *memoryLockBackend) holder(key string) string {
+	l, ok := b.locks[key]
+	if !ok || !b.now().Before(l.expires) {
+		delete(b.locks, key)
+		return ""
+	}
+	return l.token
+}
+
+func (b *memoryLockBackend) acquire(_ context.Context, key string, token string, ttl time.Duration) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.holder(key) != "" {
+		return 0, nil
+	}
+	b.locks[key] = memoryLock{token: token, expires: b.now().Add(ttl)}
+	b.fences[key]++
+	return b.fences[key], nil
+}
+
+func (b *memoryLockBackend) extend(_ context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.holder(key) != token {
+		return false, nil
+	}
+	b.locks[key] = memoryLock{token: token, expires: b.now().Add(ttl)}
+	return true, nil
+}
+
+func (b *memoryLockBackend) release(_ context.Context, key string, token string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.holder(key) != token {
+		return false, nil
+	}
+	delete(b.locks, key)
+	return true, nil
+}
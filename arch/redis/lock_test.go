@@ -0,0 +1,194 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestLocker(config LockConfig) (*locker, *memoryLockBackend, *testClock) {
+	clock := &testClock{now: time.Now()}
+	backend := newMemoryLockBackend(clock.Now)
+	return newLocker(backend, config), backend, clock
+}
+
+func TestLocker(t *testing.T) {
+	ctx := context.Background()
+	locker, _, _ := newTestLocker(LockConfig{TTL: time.Second})
+
+	first, err := locker.TryLock(ctx, "job")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), first.Fence())
+
+	_, err = locker.TryLock(ctx, "job")
+	assert.ErrorIs(t, err, ErrNotAcquired)
+
+	other, err := locker.TryLock(ctx, "other")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), other.Fence())
+
+	assert.NoError(t, first.Release(ctx))
+	<-first.Done()
+
+	second, err := locker.TryLock(ctx, "job")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), second.Fence())
+	assert.ErrorIs(t, first.Release(ctx), ErrLockLost)
+	assert.NoError(t, second.Release(ctx))
+}
+
+func TestLockExpiryRace(t *testing.T) {
+	ctx := context.Background()
+	locker, _, clock := newTestLocker(LockConfig{TTL: time.Second})
+
+	slow, err := locker.TryLock(ctx, "job")
+	assert.NoError(t, err)
+
+	// the holder pauses past the ttl and another takes the lock
+	clock.Advance(time.Second)
+	next, err := locker.TryLock(ctx, "job")
+	assert.NoError(t, err)
+	assert.Greater(t, next.Fence(), slow.Fence())
+
+	// the stale holder can neither extend nor release the lock of the next one
+	assert.ErrorIs(t, slow.Extend(ctx), ErrLockLost)
+	assert.ErrorIs(t, slow.Release(ctx), ErrLockLost)
+	select {
+	case <-slow.Done():
+	default:
+		t.Fatal("the lost lock is not done")
+	}
+
+	_, err = locker.TryLock(ctx, "job")
+	assert.ErrorIs(t, err, ErrNotAcquired)
+
+	// extended just before expiring
+	clock.Advance(999 * time.Millisecond)
+	assert.NoError(t, next.Extend(ctx))
+	clock.Advance(999 * time.Millisecond)
+	_, err = locker.TryLock(ctx, "job")
+	assert.ErrorIs(t, err, ErrNotAcquired)
+	assert.NoError(t, next.Release(ctx))
+}
+
+func TestLockBlocking(t *testing.T) {
+	ctx := context.Background()
+	locker := NewMemoryLocker(LockConfig{TTL: time.Second, RetryMin: time.Millisecond, RetryMax: 5 * time.Millisecond})
+
+	held, err := locker.TryLock(ctx, "job")
+	assert.NoError(t, err)
+
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = locker.Lock(timeout, "job")
+	assert.ErrorIs(t, err, ErrNotAcquired)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	acquired := make(chan Lock)
+	go func() {
+		lock, err := locker.Lock(ctx, "job")
+		assert.NoError(t, err)
+		acquired <- lock
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, held.Release(ctx))
+
+	select {
+	case lock := <-acquired:
+		assert.Equal(t, held.Fence()+1, lock.Fence())
+	case <-time.After(time.Second):
+		t.Fatal("the waiter did not get the released lock")
+	}
+}
+
+func TestLockAutoExtend(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLocker(LockConfig{TTL: 30 * time.Millisecond, AutoExtend: true})
+	backend := l.(*locker).backend.(*memoryLockBackend)
+
+	lock, err := l.TryLock(ctx, "job")
+	assert.NoError(t, err)
+
+	// held for several ttls
+	time.Sleep(100 * time.Millisecond)
+	_, err = l.TryLock(ctx, "job")
+	assert.ErrorIs(t, err, ErrNotAcquired)
+
+	// taken over e.g. after a long gc pause, the extension notices it
+	backend.mu.Lock()
+	backend.locks["job"] = memoryLock{token: "other", expires: time.Now().Add(time.Minute)}
+	backend.mu.Unlock()
+
+	select {
+	case <-lock.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the lost lock is not done")
+	}
+}
+
+type failingLockBackend struct {
+	*memoryLockBackend
+}
+
+func (b failingLockBackend) extend(context.Context, string, string, time.Duration) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func TestLockAutoExtendFailure(t *testing.T) {
+	ctx := context.Background()
+	locker := newLocker(failingLockBackend{newMemoryLockBackend(time.Now)}, LockConfig{TTL: 30 * time.Millisecond, AutoExtend: true})
+
+	start := time.Now()
+	lock, err := locker.TryLock(ctx, "job")
+	assert.NoError(t, err)
+
+	select {
+	case <-lock.Done():
+		assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond, "given up only once expired")
+	case <-time.After(time.Second):
+		t.Fatal("the unextended lock is not done")
+	}
+}
+
+func TestWithLock(t *testing.T) {
+	ctx := context.Background()
+	locker, backend, _ := newTestLocker(LockConfig{TTL: time.Second})
+
+	failed := errors.New("failed")
+	err := locker.WithLock(ctx, "job", func(ctx context.Context, fence int64) error {
+		assert.Equal(t, int64(1), fence)
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+	assert.Empty(t, backend.locks, "released")
+
+	err = locker.WithLock(ctx, "job", func(ctx context.Context, fence int64) error {
+		lock := backend.locks["job"]
+		lock.token = "other"
+		backend.locks["job"] = lock
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrLockLost)
+}
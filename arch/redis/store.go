@@ -4,55 +4,127 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/unusualcodeorg/goserve/arch/breaker"
 )
 
 type Config struct {
+	// the sentinels or the cluster nodes can be given as a comma separated list e.g. redis1:26379,redis2:26379
 	Host string
 	Port uint16
-	Pwd  string
-	DB   int
+	// ACL user, the default user when empty
+	Username string
+	Pwd      string
+	DB       int
+	// standalone, sentinel or cluster, standalone when empty
+	Mode string
+	// the master monitored by the sentinels, in sentinel mode
+	MasterName     string
+	SentinelPwd    string
+	TLS            bool
+	TLSCAFile      string
+	TLSCertKeyFile string
+	TLSInsecure    bool
+	// the go-redis defaults are used for the zero values, the write timeout is the read timeout
+	PoolSize     int
+	MinIdleConns int
+	PoolTimeout  time.Duration
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	// the startup continues without redis when it can't connect, the caches load from the database meanwhile
+	Optional bool
+	// the consecutive failures that make the commands fail fast, and for how long before redis is probed
+	BreakerFailures    int
+	BreakerOpenTimeout time.Duration
 }
 
 type Store interface {
 	GetInstance() *store
 	Connect()
 	Disconnect()
+	// nil when redis answers, ErrUnavailable while the breaker is open
+	Health(ctx context.Context) error
 }
 
+// works the same on a single node, sentinel or cluster
 type store struct {
-	*redis.Client
+	redis.UniversalClient
 	context context.Context
+	config  *Config
+	breaker breaker.Breaker
+	busOnce sync.Once
+	bus     *invalidationBus
 }
 
 func NewStore(context context.Context, config *Config) Store {
-	client := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", config.Host, config.Port),
-		Password: config.Pwd,
-		DB:       config.DB,
-	})
-	return &store{
-		context: context,
-		Client:  client,
+	client, err := config.newClient()
+	if err != nil {
+		panic(fmt.Errorf("invalid redis config: %w", err))
+	}
+
+	s := &store{
+		context:         context,
+		config:          config,
+		UniversalClient: client,
 	}
+	s.breaker = breaker.New("redis", breaker.Config{
+		Failures:    config.BreakerFailures,
+		OpenTimeout: config.BreakerOpenTimeout,
+		Probe:       s.ping,
+		IsFailure:   isFailure,
+		OnStateChange: func(name string, from breaker.State, to breaker.State) {
+			fmt.Printf("%s circuit breaker %s -> %s\n", name, from, to)
+		},
+	})
+	client.AddHook(breakerHook{breaker: s.breaker})
+	return s
 }
 
 func (r *store) GetInstance() *store {
 	return r
 }
 
+func (r *store) invalidations() *invalidationBus {
+	r.busOnce.Do(func() {
+		r.bus = newInvalidationBus(r)
+	})
+	return r.bus
+}
+
 func (r *store) Connect() {
 	fmt.Println("connecting to redis")
-	pong, err := r.Ping(r.context).Result()
+	pong, err := r.Ping(bypassBreaker(r.context)).Result()
 	if err != nil {
-		panic(fmt.Errorf("could not connect to redis: %v", err))
+		if r.config == nil || !r.config.Optional {
+			panic(fmt.Errorf("could not connect to redis: %v", err))
+		}
+		// probed in the background until it connects
+		fmt.Println("could not connect to redis, continuing without it:", err)
+		r.breaker.Trip()
+		return
 	}
 	fmt.Println("connected to Redis:", pong)
 }
 
+func (r *store) Health(ctx context.Context) error {
+	if r.breaker != nil && r.breaker.State() == breaker.Open {
+		return ErrUnavailable
+	}
+	return r.ping(ctx)
+}
+
+func (r *store) ping(ctx context.Context) error {
+	return r.Ping(bypassBreaker(ctx)).Err()
+}
+
 func (r *store) Disconnect() {
 	fmt.Println("disconnecting redis...")
+	if err := r.invalidations().close(); err != nil {
+		fmt.Println("error closing cache invalidations:", err)
+	}
 	err := r.Close()
 	if err != nil {
 		log.Panic(err)
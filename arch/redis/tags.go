@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const tagKeyPrefix = "tag:"
+
+func tagKey(tag string) string {
+	return tagKeyPrefix + tag
+}
+
+/*
+ * the tag set lives as long as its longest lived key, NX sets the expiry of a new set and GT extends it
+ * a key removed by its ttl stays in the set until the set expires, deleting it again is harmless
+ */
+func addTags(ctx context.Context, store Store, key string, ttl time.Duration, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	_, err := store.GetInstance().Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, tag := range tags {
+			pipe.SAdd(ctx, tagKey(tag), key)
+			if ttl > 0 {
+				pipe.ExpireNX(ctx, tagKey(tag), ttl)
+				pipe.ExpireGT(ctx, tagKey(tag), ttl)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+/*
+ * deletes the keys one by one so that it also works when the keys are spread over the nodes of a cluster
+ * the members are removed instead of the set, a key tagged during the invalidation stays registered
+ * returns the deleted keys for the local caches to drop
+ */
+func invalidateTags(ctx context.Context, store Store, tags ...string) ([]string, error) {
+	client := store.GetInstance()
+	var deleted []string
+	for _, tag := range tags {
+		keys, err := client.SMembers(ctx, tagKey(tag)).Result()
+		if err != nil {
+			return deleted, err
+		}
+		if len(keys) == 0 {
+			continue
+		}
+
+		members := make([]any, len(keys))
+		for i, key := range keys {
+			members[i] = key
+		}
+
+		_, err = client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				pipe.Del(ctx, key)
+			}
+			pipe.SRem(ctx, tagKey(tag), members...)
+			return nil
+		})
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, keys...)
+	}
+	return deleted, nil
+}
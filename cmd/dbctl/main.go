@@ -0,0 +1,15 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/unusualcodeorg/goserve/startup"
+)
+
+func main() {
+	if err := startup.DbCtl(os.Args[1:]); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
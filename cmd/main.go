@@ -1,7 +1,15 @@
 package main
 
-import "github.com/unusualcodeorg/goserve/startup"
+import (
+	"fmt"
+	"os"
+
+	"github.com/unusualcodeorg/goserve/startup"
+)
 
 func main() {
-	startup.Server()
+	if err := startup.Server(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 }
@@ -12,27 +12,81 @@ type Env struct {
 	ServerHost string `mapstructure:"SERVER_HOST"`
 	ServerPort uint16 `mapstructure:"SERVER_PORT"`
 	// database
-	DBHost         string `mapstructure:"DB_HOST"`
-	DBName         string `mapstructure:"DB_NAME"`
-	DBPort         uint16 `mapstructure:"DB_PORT"`
-	DBUser         string `mapstructure:"DB_USER"`
-	DBUserPwd      string `mapstructure:"DB_USER_PWD"`
-	DBMinPoolSize  uint16 `mapstructure:"DB_MIN_POOL_SIZE"`
-	DBMaxPoolSize  uint16 `mapstructure:"DB_MAX_POOL_SIZE"`
-	DBQueryTimeout uint16 `mapstructure:"DB_QUERY_TIMEOUT_SEC"`
+	DBURI            string `mapstructure:"DB_URI"`
+	DBHost           string `mapstructure:"DB_HOST"`
+	DBName           string `mapstructure:"DB_NAME"`
+	DBPort           uint16 `mapstructure:"DB_PORT"`
+	DBUser           string `mapstructure:"DB_USER"`
+	DBUserPwd        string `mapstructure:"DB_USER_PWD"`
+	DBMinPoolSize    uint16 `mapstructure:"DB_MIN_POOL_SIZE"`
+	DBMaxPoolSize    uint16 `mapstructure:"DB_MAX_POOL_SIZE"`
+	DBQueryTimeout   uint16 `mapstructure:"DB_QUERY_TIMEOUT_SEC"`
+	DBAuthSource     string `mapstructure:"DB_AUTH_SOURCE"`
+	DBReplicaSet     string `mapstructure:"DB_REPLICA_SET"`
+	DBTLS            bool   `mapstructure:"DB_TLS"`
+	DBTLSCAFile      string `mapstructure:"DB_TLS_CA_FILE"`
+	DBTLSCertKeyFile string `mapstructure:"DB_TLS_CERT_KEY_FILE"`
+	DBTLSInsecure    bool   `mapstructure:"DB_TLS_INSECURE"`
+	DBReadPreference string `mapstructure:"DB_READ_PREFERENCE"`
+	DBRetryWrites    *bool  `mapstructure:"DB_RETRY_WRITES"`
+	DBRetryReads     *bool  `mapstructure:"DB_RETRY_READS"`
+	DBConnectRetries uint16 `mapstructure:"DB_CONNECT_RETRIES"`
+	DBSlowQueryMs    uint16 `mapstructure:"DB_SLOW_QUERY_MS"`
+	DBExplain        bool   `mapstructure:"DB_EXPLAIN"`
+	// indexes
+	DBIndexDryRun         bool   `mapstructure:"DB_INDEX_DRY_RUN"`
+	DBIndexDropUndeclared bool   `mapstructure:"DB_INDEX_DROP_UNDECLARED"`
+	DBIndexTimeout        uint16 `mapstructure:"DB_INDEX_TIMEOUT_SEC"`
+	DBValidationLevel     string `mapstructure:"DB_VALIDATION_LEVEL"`
+	DBValidationAction    string `mapstructure:"DB_VALIDATION_ACTION"`
+	// seed
+	AdminApiKey   string `mapstructure:"ADMIN_API_KEY"`
+	AdminEmail    string `mapstructure:"ADMIN_EMAIL"`
+	AdminPassword string `mapstructure:"ADMIN_PASSWORD"`
 	// redis
-	RedisHost string `mapstructure:"REDIS_HOST"`
-	RedisPort uint16 `mapstructure:"REDIS_PORT"`
-	RedisPwd  string `mapstructure:"REDIS_PASSWORD"`
-	RedisDB   int    `mapstructure:"REDIS_DB"`
+	RedisHost           string `mapstructure:"REDIS_HOST"`
+	RedisPort           uint16 `mapstructure:"REDIS_PORT"`
+	RedisUser           string `mapstructure:"REDIS_USER"`
+	RedisPwd            string `mapstructure:"REDIS_PASSWORD"`
+	RedisDB             int    `mapstructure:"REDIS_DB"`
+	RedisMode           string `mapstructure:"REDIS_MODE"`
+	RedisMasterName     string `mapstructure:"REDIS_MASTER_NAME"`
+	RedisSentinelPwd    string `mapstructure:"REDIS_SENTINEL_PASSWORD"`
+	RedisTLS            bool   `mapstructure:"REDIS_TLS"`
+	RedisTLSCAFile      string `mapstructure:"REDIS_TLS_CA_FILE"`
+	RedisTLSCertKeyFile string `mapstructure:"REDIS_TLS_CERT_KEY_FILE"`
+	RedisTLSInsecure    bool   `mapstructure:"REDIS_TLS_INSECURE"`
+	RedisPoolSize       uint16 `mapstructure:"REDIS_POOL_SIZE"`
+	RedisMinIdleConns   uint16 `mapstructure:"REDIS_MIN_IDLE_CONNS"`
+	RedisPoolTimeoutMs  uint32 `mapstructure:"REDIS_POOL_TIMEOUT_MS"`
+	RedisDialTimeoutMs  uint32 `mapstructure:"REDIS_DIAL_TIMEOUT_MS"`
+	RedisReadTimeoutMs  uint32 `mapstructure:"REDIS_READ_TIMEOUT_MS"`
+	RedisOptional       bool   `mapstructure:"REDIS_OPTIONAL"`
+	RedisBreakerFails   uint16 `mapstructure:"REDIS_BREAKER_FAILURES"`
+	RedisBreakerOpenMs  uint32 `mapstructure:"REDIS_BREAKER_OPEN_MS"`
+	// jobs
+	JobsQueue                string `mapstructure:"JOBS_QUEUE"`
+	JobsWorkers              uint16 `mapstructure:"JOBS_WORKERS"`
+	JobsMaxAttempts          uint16 `mapstructure:"JOBS_MAX_ATTEMPTS"`
+	JobsVisibilityTimeoutSec uint32 `mapstructure:"JOBS_VISIBILITY_TIMEOUT_SEC"`
+	JobsTimeoutSec           uint32 `mapstructure:"JOBS_TIMEOUT_SEC"`
+	JobsShutdownTimeoutSec   uint32 `mapstructure:"JOBS_SHUTDOWN_TIMEOUT_SEC"`
 	// keys
 	RSAPrivateKeyPath string `mapstructure:"RSA_PRIVATE_KEY_PATH"`
 	RSAPublicKeyPath  string `mapstructure:"RSA_PUBLIC_KEY_PATH"`
+	// encryption
+	EncryptionMasterKey     string `mapstructure:"ENCRYPTION_MASTER_KEY"`
+	EncryptionDataKeys      string `mapstructure:"ENCRYPTION_DATA_KEYS"`
+	EncryptionActiveKey     string `mapstructure:"ENCRYPTION_ACTIVE_KEY"`
+	EncryptionBlindIndexKey string `mapstructure:"ENCRYPTION_BLIND_INDEX_KEY"`
 	// Token
 	AccessTokenValiditySec  uint64 `mapstructure:"ACCESS_TOKEN_VALIDITY_SEC"`
 	RefreshTokenValiditySec uint64 `mapstructure:"REFRESH_TOKEN_VALIDITY_SEC"`
 	TokenIssuer             string `mapstructure:"TOKEN_ISSUER"`
 	TokenAudience           string `mapstructure:"TOKEN_AUDIENCE"`
+	// caches the api keys, keystores and users looked up on every request in redis
+	AuthCache       bool   `mapstructure:"AUTH_CACHE"`
+	AuthCacheTTLSec uint32 `mapstructure:"AUTH_CACHE_TTL_SEC"`
 }
 
 func NewEnv(filename string, override bool) *Env {
@@ -0,0 +1,169 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/unusualcodeorg/goserve/arch/mongo"
+	"github.com/unusualcodeorg/goserve/config"
+)
+
+const dbctlUsage = `usage: dbctl <command> [args]
+
+commands:
+  migrate up           apply all pending migrations
+  migrate down [n]     rollback the last n applied migrations (default 1)
+  migrate status       list migrations and their state
+  indexes plan         show the index changes without applying them
+  indexes apply        create missing indexes and drop undeclared ones if enabled
+  explain              show the plans of the known service queries, fails on collection scans
+  reencrypt            encrypt the fields written with an old key or in plaintext with the active key
+  keygen <id>          print a new data key wrapped by the master key, use the id blind for the blind index key`
+
+func DbCtl(args []string) error {
+	if len(args) == 0 {
+		return errors.New(dbctlUsage)
+	}
+
+	env := config.NewEnv(".env", true)
+	context := context.Background()
+
+	// needs only the master key
+	if args[0] == "keygen" {
+		return keygenCmd(env, args[1:])
+	}
+
+	db := newDatabase(context, env)
+	db.Connect()
+	defer db.Disconnect()
+
+	switch args[0] {
+	case "migrate":
+		return migrateCmd(context, db, env, args[1:])
+	case "indexes":
+		return indexesCmd(context, db, env, args[1:])
+	case "explain":
+		return explainCmd(context, db)
+	case "reencrypt":
+		return reencryptCmd(context, db)
+	default:
+		return errors.New(dbctlUsage)
+	}
+}
+
+func migrateCmd(ctx context.Context, db mongo.Database, env *config.Env, args []string) error {
+	if len(args) == 0 {
+		return errors.New(dbctlUsage)
+	}
+
+	migrator := mongo.NewMigrator(db, Migrations(env))
+
+	switch args[0] {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+			steps = n
+		}
+		return migrator.Down(ctx, steps)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-30s  %s\n", s.Version, s.Description, state)
+		}
+		return nil
+	default:
+		return errors.New(dbctlUsage)
+	}
+}
+
+func indexesCmd(ctx context.Context, db mongo.Database, env *config.Env, args []string) error {
+	if len(args) == 0 {
+		return errors.New(dbctlUsage)
+	}
+
+	config := indexConfig(env)
+
+	switch args[0] {
+	case "plan":
+		plans, err := mongo.NewIndexReconciler(db, config).Plan(ctx, Documents()...)
+		if err != nil {
+			return err
+		}
+		for _, p := range plans {
+			fmt.Println(p)
+		}
+		return nil
+	case "apply":
+		config.DryRun = false
+		_, err := mongo.NewIndexReconciler(db, config).Reconcile(ctx, Documents()...)
+		return err
+	default:
+		return errors.New(dbctlUsage)
+	}
+}
+
+func explainCmd(ctx context.Context, db mongo.Database) error {
+	results, err := ExplainKnownQueries(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	scans := 0
+	for _, r := range results {
+		fmt.Println(r)
+		if r.CollScan {
+			scans++
+		}
+	}
+
+	if scans > 0 {
+		return fmt.Errorf("%d of %d queries scan the whole collection", scans, len(results))
+	}
+	return nil
+}
+
+func reencryptCmd(ctx context.Context, db mongo.Database) error {
+	for _, doc := range Documents() {
+		count, err := mongo.Reencrypt(ctx, db, doc)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			fmt.Printf("%s: %d documents re-encrypted\n", doc.GetCollectionName(), count)
+		}
+	}
+	return nil
+}
+
+func keygenCmd(env *config.Env, args []string) error {
+	if len(args) != 1 {
+		return errors.New(dbctlUsage)
+	}
+
+	masterKey, err := encryptionMasterKey(env)
+	if err != nil {
+		return err
+	}
+
+	key, err := mongo.GenerateDataKey(masterKey, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println(key)
+	return nil
+}
@@ -0,0 +1,54 @@
+package startup
+
+import (
+	"context"
+
+	auth "github.com/unusualcodeorg/goserve/api/auth/model"
+	blog "github.com/unusualcodeorg/goserve/api/blog/model"
+	contact "github.com/unusualcodeorg/goserve/api/contact/model"
+	user "github.com/unusualcodeorg/goserve/api/user/model"
+	"github.com/unusualcodeorg/goserve/arch/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// the hot queries of the services, add the new ones here to check them with `dbctl explain`
+func KnownQueries() []mongo.ExplainQuery {
+	id := primitive.NewObjectID()
+	latest := bson.D{{Key: "updatedAt", Value: -1}, {Key: "score", Value: -1}}
+
+	return []mongo.ExplainQuery{
+		{Name: "user by email", Collection: user.UserCollectionName, Filter: bson.M{"emailHash": "", "status": true}},
+		{Name: "user by id", Collection: user.UserCollectionName, Filter: bson.M{"_id": id, "status": true}},
+		{Name: "role by code", Collection: user.RolesCollectionName, Filter: bson.M{"code": "", "status": true}},
+		{Name: "keystore", Collection: auth.KeystoreCollectionName, Filter: bson.M{"client": id, "pKey": "", "status": true}},
+		{Name: "refresh keystore", Collection: auth.KeystoreCollectionName, Filter: bson.M{"client": id, "pKey": "", "sKey": "", "status": true}},
+		{Name: "api key", Collection: auth.ApiKeyCollectionName, Filter: bson.M{"key": "", "status": true}},
+		{Name: "blog by slug", Collection: blog.CollectionName, Filter: bson.M{"slug": "", "published": true, "status": true}},
+		{Name: "blog by id", Collection: blog.CollectionName, Filter: bson.M{"_id": id, "published": true, "status": true}},
+		{Name: "latest blogs", Collection: blog.CollectionName, Filter: bson.M{"status": true, "published": true}, Sort: latest},
+		{Name: "tagged blogs", Collection: blog.CollectionName, Filter: bson.M{"status": true, "published": true, "tags": ""}, Sort: latest},
+		{Name: "similar blogs", Collection: blog.CollectionName, Filter: bson.M{
+			"$text":     bson.M{"$search": "go", "$caseSensitive": false},
+			"status":    true,
+			"published": true,
+			"_id":       bson.M{"$ne": id},
+		}},
+		{Name: "author drafts", Collection: blog.CollectionName, Filter: bson.M{"author": id, "status": true, "drafted": true}},
+		{Name: "submitted blogs", Collection: blog.CollectionName, Filter: bson.M{"status": true, "submitted": true}},
+		{Name: "messages", Collection: contact.CollectionName, Filter: bson.M{"status": true}},
+	}
+}
+
+func ExplainKnownQueries(ctx context.Context, db mongo.Database) ([]*mongo.ExplainResult, error) {
+	queries := KnownQueries()
+	results := make([]*mongo.ExplainResult, 0, len(queries))
+	for _, q := range queries {
+		result, err := mongo.Explain(ctx, db, q)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
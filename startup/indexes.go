@@ -1,18 +1,39 @@
 package startup
 
 import (
+	"context"
+	"time"
+
 	auth "github.com/unusualcodeorg/goserve/api/auth/model"
 	blog "github.com/unusualcodeorg/goserve/api/blog/model"
 	contact "github.com/unusualcodeorg/goserve/api/contact/model"
 	user "github.com/unusualcodeorg/goserve/api/user/model"
 	"github.com/unusualcodeorg/goserve/arch/mongo"
+	"github.com/unusualcodeorg/goserve/config"
 )
 
-func EnsureDbIndexes(db mongo.Database) {
-	go mongo.Document[auth.Keystore](&auth.Keystore{}).EnsureIndexes(db)
-	go mongo.Document[auth.ApiKey](&auth.ApiKey{}).EnsureIndexes(db)
-	go mongo.Document[user.User](&user.User{}).EnsureIndexes(db)
-	go mongo.Document[user.Role](&user.Role{}).EnsureIndexes(db)
-	go mongo.Document[blog.Blog](&blog.Blog{}).EnsureIndexes(db)
-	go mongo.Document[contact.Message](&contact.Message{}).EnsureIndexes(db)
+func Documents() []mongo.Indexed {
+	return []mongo.Indexed{
+		mongo.Document[auth.Keystore](&auth.Keystore{}),
+		mongo.Document[auth.ApiKey](&auth.ApiKey{}),
+		mongo.Document[user.User](&user.User{}),
+		mongo.Document[user.Role](&user.Role{}),
+		mongo.Document[blog.Blog](&blog.Blog{}),
+		mongo.Document[contact.Message](&contact.Message{}),
+	}
+}
+
+func indexConfig(env *config.Env) mongo.IndexConfig {
+	return mongo.IndexConfig{
+		DryRun:           env.DBIndexDryRun,
+		DropUndeclared:   env.DBIndexDropUndeclared,
+		Timeout:          time.Duration(env.DBIndexTimeout) * time.Second,
+		ValidationLevel:  env.DBValidationLevel,
+		ValidationAction: env.DBValidationAction,
+	}
+}
+
+func EnsureDbIndexes(ctx context.Context, db mongo.Database, env *config.Env) error {
+	_, err := mongo.NewIndexReconciler(db, indexConfig(env)).Reconcile(ctx, Documents()...)
+	return err
 }
@@ -0,0 +1,194 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	auth "github.com/unusualcodeorg/goserve/api/auth/model"
+	user "github.com/unusualcodeorg/goserve/api/user/model"
+	"github.com/unusualcodeorg/goserve/arch/mongo"
+	"github.com/unusualcodeorg/goserve/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongod "go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var seedRoleCodes = []user.RoleCode{
+	user.RoleCodeLearner,
+	user.RoleCodeAuthor,
+	user.RoleCodeEditor,
+	user.RoleCodeAdmin,
+}
+
+/*
+ * The fields written in plaintext are encrypted first, so that the seeds find the documents by their blind index
+ * the seeds of the empty ADMIN_* values are skipped, and recorded as applied
+ */
+func Migrations(env *config.Env) []mongo.Migration {
+	return []mongo.Migration{
+		{
+			Version:     1,
+			Description: "encrypt plaintext fields",
+			Up:          encryptPlaintext,
+		},
+		{
+			Version:     2,
+			Description: "seed roles",
+			Up:          seedRoles,
+			Down:        dropSeedRoles,
+		},
+		{
+			Version:     3,
+			Description: "seed admin api key",
+			Up: func(ctx context.Context, db mongo.Database) error {
+				return seedApiKey(ctx, db, env.AdminApiKey)
+			},
+			Down: func(ctx context.Context, db mongo.Database) error {
+				return dropSeedApiKey(ctx, db, env.AdminApiKey)
+			},
+		},
+		{
+			Version:     4,
+			Description: "seed admin user",
+			Up: func(ctx context.Context, db mongo.Database) error {
+				return seedAdmin(ctx, db, env.AdminEmail, env.AdminPassword)
+			},
+			Down: func(ctx context.Context, db mongo.Database) error {
+				return dropSeedAdmin(ctx, db, env.AdminEmail)
+			},
+		},
+	}
+}
+
+func Migrate(ctx context.Context, db mongo.Database, env *config.Env) error {
+	return mongo.NewMigrator(db, Migrations(env)).Up(ctx)
+}
+
+func encryptPlaintext(ctx context.Context, db mongo.Database) error {
+	for _, doc := range Documents() {
+		if _, err := mongo.Reencrypt(ctx, db, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func seedRoles(ctx context.Context, db mongo.Database) error {
+	builder := mongo.NewQueryBuilder[user.Role](db, user.RolesCollectionName)
+	for _, code := range seedRoleCodes {
+		role, err := user.NewRole(code)
+		if err != nil {
+			return err
+		}
+
+		filter := bson.M{"code": code}
+		update := bson.M{"$setOnInsert": role}
+		_, err = builder.Query(ctx).UpsertOne(filter, update)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dropSeedRoles(ctx context.Context, db mongo.Database) error {
+	query := mongo.NewQueryBuilder[user.Role](db, user.RolesCollectionName).Query(ctx)
+	_, err := query.DeleteMany(bson.M{"code": bson.M{"$in": seedRoleCodes}})
+	return err
+}
+
+func seedApiKey(ctx context.Context, db mongo.Database, key string) error {
+	if key == "" {
+		fmt.Println("ADMIN_API_KEY is not set, no api key is seeded")
+		return nil
+	}
+
+	apikey := auth.NewApiKey(key, 1, []auth.Permission{auth.GeneralPermission}, []string{"To be used by the xyz vendor"})
+	if err := apikey.Validate(); err != nil {
+		return err
+	}
+
+	query := mongo.NewQueryBuilder[auth.ApiKey](db, auth.ApiKeyCollectionName).Query(ctx)
+	filter := bson.M{"key": key}
+	update := bson.M{"$setOnInsert": apikey}
+	_, err := query.UpsertOne(filter, update)
+	return err
+}
+
+func dropSeedApiKey(ctx context.Context, db mongo.Database, key string) error {
+	if key == "" {
+		return nil
+	}
+
+	query := mongo.NewQueryBuilder[auth.ApiKey](db, auth.ApiKeyCollectionName).Query(ctx)
+	_, err := query.DeleteOne(bson.M{"key": key})
+	return err
+}
+
+func seedAdmin(ctx context.Context, db mongo.Database, email string, password string) error {
+	if email == "" || password == "" {
+		fmt.Println("ADMIN_EMAIL or ADMIN_PASSWORD is not set, no admin user is seeded")
+		return nil
+	}
+
+	roleQuery := mongo.NewQueryBuilder[user.Role](db, user.RolesCollectionName).Query(ctx)
+	roles, err := roleQuery.FindAll(bson.M{"code": bson.M{"$in": seedRoleCodes}}, nil)
+	if err != nil {
+		return err
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	admin, err := user.NewUser(email, string(hashed), "Admin", nil, roles)
+	if err != nil {
+		return err
+	}
+
+	filter, err := adminFilter(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	query := mongo.NewQueryBuilder[user.User](db, user.UserCollectionName).Query(ctx)
+	update := bson.M{"$setOnInsert": admin}
+	_, err = query.UpsertOne(filter, update)
+	return err
+}
+
+func dropSeedAdmin(ctx context.Context, db mongo.Database, email string) error {
+	if email == "" {
+		return nil
+	}
+
+	filter, err := adminFilter(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	query := mongo.NewQueryBuilder[user.User](db, user.UserCollectionName).Query(ctx)
+	_, err = query.DeleteMany(filter)
+	return err
+}
+
+// the filters of this type are not rewritten to the blind index, so it finds the emails written in plaintext
+type plaintextAdmin struct {
+	ID primitive.ObjectID `bson:"_id"`
+}
+
+// the admin by the blind index of its email, or by its plaintext email e.g. written by the older init-mongo.js
+func adminFilter(ctx context.Context, db mongo.Database, email string) (bson.M, error) {
+	query := mongo.NewQueryBuilder[plaintextAdmin](db, user.UserCollectionName).Query(ctx)
+	plaintext, err := query.FindOne(bson.M{"email": email}, nil)
+	if errors.Is(err, mongod.ErrNoDocuments) {
+		return bson.M{"email": email}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{"$or": bson.A{bson.M{"email": email}, bson.M{"_id": plaintext.ID}}}, nil
+}
@@ -0,0 +1,112 @@
+package startup
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	auth "github.com/unusualcodeorg/goserve/api/auth/model"
+	user "github.com/unusualcodeorg/goserve/api/user/model"
+	"github.com/unusualcodeorg/goserve/arch/mongo"
+	"github.com/unusualcodeorg/goserve/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// a user as written before the email was encrypted
+type plaintextUser struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Email     string             `bson:"email"`
+	EmailHash string             `bson:"emailHash,omitempty"`
+	Name      string             `bson:"name"`
+	Status    bool               `bson:"status"`
+}
+
+func newMigrationTestEnv() *config.Env {
+	return &config.Env{
+		AdminApiKey:   "test-admin-api-key",
+		AdminEmail:    "admin@test.com",
+		AdminPassword: "changeit",
+	}
+}
+
+// the users and the admin written by the older init-mongo.js
+func insertPlaintextUsers(t *testing.T, db mongo.Database, emails ...string) {
+	raw := mongo.NewQueryBuilder[plaintextUser](db, user.UserCollectionName)
+	for _, email := range emails {
+		_, err := raw.SingleQuery().InsertOne(&plaintextUser{Email: email, Name: "old", Status: true})
+		assert.NoError(t, err)
+	}
+}
+
+// the unique emailHash index can only be built when every user has a distinct hash
+func assertEncryptedUsers(t *testing.T, db mongo.Database, emails ...string) {
+	raw := mongo.NewQueryBuilder[plaintextUser](db, user.UserCollectionName)
+	docs, err := raw.SingleQuery().FindAll(bson.M{}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, docs, len(emails))
+
+	hashes := map[string]bool{}
+	for _, doc := range docs {
+		assert.NotEmpty(t, doc.EmailHash)
+		assert.NotContains(t, doc.Email, "@")
+		hashes[doc.EmailHash] = true
+	}
+	assert.Len(t, hashes, len(emails))
+
+	users := mongo.NewQueryBuilder[user.User](db, user.UserCollectionName)
+	for _, email := range emails {
+		found, err := users.SingleQuery().FindOne(bson.M{"email": email}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, email, found.Email)
+	}
+}
+
+func TestMigrate_EncryptsPlaintextUsers(t *testing.T) {
+	db := mongo.NewMemoryDatabase()
+	env := newMigrationTestEnv()
+	insertPlaintextUsers(t, db, "a@test.com", "b@test.com")
+
+	assert.NoError(t, Migrate(context.Background(), db, env))
+	assertEncryptedUsers(t, db, "a@test.com", "b@test.com", env.AdminEmail)
+}
+
+func TestMigrate_PlaintextAdminIsNotSeededAgain(t *testing.T) {
+	db := mongo.NewMemoryDatabase()
+	env := newMigrationTestEnv()
+	insertPlaintextUsers(t, db, env.AdminEmail, "a@test.com")
+
+	assert.NoError(t, Migrate(context.Background(), db, env))
+	assertEncryptedUsers(t, db, env.AdminEmail, "a@test.com")
+}
+
+// a plaintext admin written after the fields were encrypted is still found by the seed
+func TestSeedAdmin_MatchesPlaintextAdmin(t *testing.T) {
+	ctx := context.Background()
+	db := mongo.NewMemoryDatabase()
+	env := newMigrationTestEnv()
+	insertPlaintextUsers(t, db, env.AdminEmail)
+
+	assert.NoError(t, seedAdmin(ctx, db, env.AdminEmail, env.AdminPassword))
+	assert.NoError(t, encryptPlaintext(ctx, db))
+	assertEncryptedUsers(t, db, env.AdminEmail)
+
+	assert.NoError(t, dropSeedAdmin(ctx, db, env.AdminEmail))
+	assertEncryptedUsers(t, db)
+}
+
+func TestMigrate_SkipsEmptySeeds(t *testing.T) {
+	ctx := context.Background()
+	db := mongo.NewMemoryDatabase()
+
+	assert.NoError(t, Migrate(ctx, db, &config.Env{}))
+	assertEncryptedUsers(t, db)
+
+	keys, err := mongo.NewQueryBuilder[auth.ApiKey](db, auth.ApiKeyCollectionName).SingleQuery().FindAll(bson.M{}, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	roles, err := mongo.NewQueryBuilder[user.Role](db, user.RolesCollectionName).SingleQuery().FindAll(bson.M{}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, roles, len(seedRoleCodes))
+}
@@ -2,6 +2,7 @@ package startup
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/unusualcodeorg/goserve/api/auth"
 	authMW "github.com/unusualcodeorg/goserve/api/auth/middleware"
@@ -11,6 +12,7 @@ import (
 	"github.com/unusualcodeorg/goserve/api/blogs"
 	"github.com/unusualcodeorg/goserve/api/contact"
 	"github.com/unusualcodeorg/goserve/api/user"
+	"github.com/unusualcodeorg/goserve/arch/jobs"
 	coreMW "github.com/unusualcodeorg/goserve/arch/middleware"
 	"github.com/unusualcodeorg/goserve/arch/mongo"
 	"github.com/unusualcodeorg/goserve/arch/network"
@@ -25,6 +27,7 @@ type module struct {
 	Env         *config.Env
 	DB          mongo.Database
 	Store       redis.Store
+	Queue       jobs.Queue
 	UserService user.Service
 	AuthService auth.Service
 	BlogService blog.Service
@@ -39,8 +42,8 @@ func (m *module) Controllers() []network.Controller {
 		auth.NewController(m.AuthenticationProvider(), m.AuthorizationProvider(), m.AuthService),
 		user.NewController(m.AuthenticationProvider(), m.AuthorizationProvider(), m.UserService),
 		blog.NewController(m.AuthenticationProvider(), m.AuthorizationProvider(), m.BlogService),
-		author.NewController(m.AuthenticationProvider(), m.AuthorizationProvider(), author.NewService(m.DB, m.BlogService)),
-		editor.NewController(m.AuthenticationProvider(), m.AuthorizationProvider(), editor.NewService(m.DB, m.UserService)),
+		author.NewController(m.AuthenticationProvider(), m.AuthorizationProvider(), author.NewService(m.DB, m.UserService, m.BlogService)),
+		editor.NewController(m.AuthenticationProvider(), m.AuthorizationProvider(), editor.NewService(m.DB, m.UserService, m.BlogService, m.Queue)),
 		blogs.NewController(m.AuthenticationProvider(), m.AuthorizationProvider(), blogs.NewService(m.DB, m.Store)),
 		contact.NewController(m.AuthenticationProvider(), m.AuthorizationProvider(), contact.NewService(m.DB)),
 	}
@@ -49,11 +52,47 @@ func (m *module) Controllers() []network.Controller {
 func (m *module) RootMiddlewares() []network.RootMiddleware {
 	return []network.RootMiddleware{
 		coreMW.NewErrorCatcher(), // NOTE: this should be the first handler to be mounted
+		coreMW.NewHealth("/health",
+			coreMW.HealthCheck{Name: "mongo", Check: m.DB.Health},
+			coreMW.HealthCheck{Name: "redis", Optional: m.Env.RedisOptional, Check: m.Store.Health},
+		),
 		authMW.NewKeyProtection(m.AuthService),
 		coreMW.NewNotFound(),
 	}
 }
 
+func (m *module) WatchChanges() (stop func()) {
+	ctx, cancel := context.WithCancel(m.Context)
+	tokens := mongo.NewResumeTokenStore(m.DB)
+
+	go func() {
+		if err := m.BlogService.WatchBlogChanges(ctx, tokens); err != nil {
+			fmt.Println("blog cache invalidation stopped:", err)
+		}
+	}()
+
+	if m.Env.AuthCache {
+		go func() {
+			if err := m.UserService.WatchUserChanges(ctx, tokens); err != nil {
+				fmt.Println("user cache invalidation stopped:", err)
+			}
+		}()
+		go func() {
+			if err := m.UserService.WatchRoleChanges(ctx, tokens); err != nil {
+				fmt.Println("role cache invalidation stopped:", err)
+			}
+		}()
+	}
+
+	return cancel
+}
+
+func (m *module) RegisterJobs() {
+	blog.WarmCacheJob.Handle(m.Queue, func(ctx context.Context, job *jobs.Job[blog.WarmCachePayload]) error {
+		return m.BlogService.WarmBlogDtoCache(job.Payload.BlogID, job.Payload.Slug)
+	})
+}
+
 func (m *module) AuthenticationProvider() network.AuthenticationProvider {
 	return authMW.NewAuthenticationProvider(m.AuthService, m.UserService)
 }
@@ -62,9 +101,9 @@ func (m *module) AuthorizationProvider() network.AuthorizationProvider {
 	return authMW.NewAuthorizationProvider()
 }
 
-func NewModule(context context.Context, env *config.Env, db mongo.Database, store redis.Store) Module {
-	userService := user.NewService(db)
-	authService := auth.NewService(db, env, userService)
+func NewModule(context context.Context, env *config.Env, db mongo.Database, store redis.Store, queue jobs.Queue) Module {
+	userService := user.NewService(db, store, auth.CacheTTL(env))
+	authService := auth.NewService(db, store, env, userService)
 	blogService := blog.NewService(db, store, userService)
 
 	return &module{
@@ -72,6 +111,7 @@ func NewModule(context context.Context, env *config.Env, db mongo.Database, stor
 		Env:         env,
 		DB:          db,
 		Store:       store,
+		Queue:       queue,
 		UserService: userService,
 		AuthService: authService,
 		BlogService: blogService,
@@ -2,9 +2,13 @@ package startup
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/unusualcodeorg/goserve/arch/jobs"
 	"github.com/unusualcodeorg/goserve/arch/mongo"
 	"github.com/unusualcodeorg/goserve/arch/network"
 	"github.com/unusualcodeorg/goserve/arch/redis"
@@ -13,45 +17,78 @@ import (
 
 type Shutdown = func()
 
-func Server() {
+func Server() error {
 	env := config.NewEnv(".env", true)
-	router, _, shutdown := create(env)
+	router, _, shutdown, err := create(env)
+	if err != nil {
+		return err
+	}
 	defer shutdown()
 	router.Start(env.ServerHost, env.ServerPort)
+	return nil
 }
 
-func create(env *config.Env) (network.Router, Module, Shutdown) {
+// the database is disconnected when its migrations or indexes fail
+func create(env *config.Env) (network.Router, Module, Shutdown, error) {
 	context := context.Background()
 
-	dbConfig := mongo.DbConfig{
-		User:        env.DBUser,
-		Pwd:         env.DBUserPwd,
-		Host:        env.DBHost,
-		Port:        env.DBPort,
-		Name:        env.DBName,
-		MinPoolSize: env.DBMinPoolSize,
-		MaxPoolSize: env.DBMaxPoolSize,
-		Timeout:     time.Duration(env.DBQueryTimeout) * time.Second,
-	}
-
-	db := mongo.NewDatabase(context, dbConfig)
+	db := newDatabase(context, env)
 	db.Connect()
 
+	if err := Migrate(context, db, env); err != nil {
+		db.Disconnect()
+		return nil, nil, nil, err
+	}
+
 	if env.GoMode != gin.TestMode {
-		EnsureDbIndexes(db)
+		if err := EnsureDbIndexes(context, db, env); err != nil {
+			db.Disconnect()
+			return nil, nil, nil, err
+		}
 	}
 
 	redisConfig := redis.Config{
-		Host: env.RedisHost,
-		Port: env.RedisPort,
-		Pwd:  env.RedisPwd,
-		DB:   env.RedisDB,
+		Host:               env.RedisHost,
+		Port:               env.RedisPort,
+		Username:           env.RedisUser,
+		Pwd:                env.RedisPwd,
+		DB:                 env.RedisDB,
+		Mode:               env.RedisMode,
+		MasterName:         env.RedisMasterName,
+		SentinelPwd:        env.RedisSentinelPwd,
+		TLS:                env.RedisTLS,
+		TLSCAFile:          env.RedisTLSCAFile,
+		TLSCertKeyFile:     env.RedisTLSCertKeyFile,
+		TLSInsecure:        env.RedisTLSInsecure,
+		PoolSize:           int(env.RedisPoolSize),
+		MinIdleConns:       int(env.RedisMinIdleConns),
+		PoolTimeout:        time.Duration(env.RedisPoolTimeoutMs) * time.Millisecond,
+		DialTimeout:        time.Duration(env.RedisDialTimeoutMs) * time.Millisecond,
+		ReadTimeout:        time.Duration(env.RedisReadTimeoutMs) * time.Millisecond,
+		Optional:           env.RedisOptional,
+		BreakerFailures:    int(env.RedisBreakerFails),
+		BreakerOpenTimeout: time.Duration(env.RedisBreakerOpenMs) * time.Millisecond,
 	}
 
 	store := redis.NewStore(context, &redisConfig)
 	store.Connect()
 
-	module := NewModule(context, env, db, store)
+	queue := jobs.NewQueue(store, jobs.Config{
+		Name:              env.JobsQueue,
+		Workers:           int(env.JobsWorkers),
+		MaxAttempts:       int(env.JobsMaxAttempts),
+		VisibilityTimeout: time.Duration(env.JobsVisibilityTimeoutSec) * time.Second,
+		JobTimeout:        time.Duration(env.JobsTimeoutSec) * time.Second,
+	})
+
+	module := NewModule(context, env, db, store, queue)
+	module.GetInstance().RegisterJobs()
+
+	stopWatch := func() {}
+	if env.GoMode != gin.TestMode {
+		stopWatch = module.GetInstance().WatchChanges()
+		queue.Start()
+	}
 
 	router := network.NewRouter(env.GoMode)
 	router.RegisterValidationParsers(network.CustomTagNameFunc())
@@ -59,9 +96,87 @@ func create(env *config.Env) (network.Router, Module, Shutdown) {
 	router.LoadControllers(module.Controllers())
 
 	shutdown := func() {
+		stopWatch()
+		stopQueue(queue, time.Duration(env.JobsShutdownTimeoutSec)*time.Second)
 		db.Disconnect()
 		store.Disconnect()
 	}
 
-	return router, module, shutdown
+	return router, module, shutdown, nil
+}
+
+// the jobs still running after the timeout are left to the other instances
+func stopQueue(queue jobs.Queue, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := queue.Shutdown(ctx); err != nil {
+		fmt.Println("jobs still running at shutdown:", err)
+	}
+}
+
+func newDatabase(context context.Context, env *config.Env) mongo.Database {
+	dbConfig := mongo.DbConfig{
+		URI:                env.DBURI,
+		User:               env.DBUser,
+		Pwd:                env.DBUserPwd,
+		Host:               env.DBHost,
+		Port:               env.DBPort,
+		Name:               env.DBName,
+		AuthSource:         env.DBAuthSource,
+		ReplicaSet:         env.DBReplicaSet,
+		TLS:                env.DBTLS,
+		TLSCAFile:          env.DBTLSCAFile,
+		TLSCertKeyFile:     env.DBTLSCertKeyFile,
+		TLSInsecure:        env.DBTLSInsecure,
+		ReadPreference:     env.DBReadPreference,
+		RetryWrites:        env.DBRetryWrites,
+		RetryReads:         env.DBRetryReads,
+		MinPoolSize:        env.DBMinPoolSize,
+		MaxPoolSize:        env.DBMaxPoolSize,
+		Timeout:            time.Duration(env.DBQueryTimeout) * time.Second,
+		ConnectRetries:     env.DBConnectRetries,
+		SlowQueryThreshold: time.Duration(env.DBSlowQueryMs) * time.Millisecond,
+		Explain:            env.DBExplain && env.GoMode == gin.DebugMode,
+		Keyring:            newKeyring(env),
+	}
+
+	return mongo.NewDatabase(context, dbConfig)
+}
+
+func newKeyring(env *config.Env) mongo.Keyring {
+	masterKey, err := encryptionMasterKey(env)
+	if err != nil {
+		panic(err)
+	}
+
+	dataKeys := map[string]string{}
+	for _, entry := range strings.Split(env.EncryptionDataKeys, ",") {
+		id, key, found := strings.Cut(strings.TrimSpace(entry), ":")
+		if !found {
+			panic(fmt.Errorf("invalid ENCRYPTION_DATA_KEYS entry: %q", entry))
+		}
+		dataKeys[id] = key
+	}
+
+	keyring, err := mongo.NewKeyring(mongo.KeyringConfig{
+		MasterKey:     masterKey,
+		DataKeys:      dataKeys,
+		ActiveKey:     env.EncryptionActiveKey,
+		BlindIndexKey: env.EncryptionBlindIndexKey,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return keyring
+}
+
+func encryptionMasterKey(env *config.Env) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(env.EncryptionMasterKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ENCRYPTION_MASTER_KEY: %w", err)
+	}
+	return key, nil
 }
@@ -11,7 +11,10 @@ type Teardown = func()
 
 func TestServer() (network.Router, Module, Teardown) {
 	env := config.NewEnv("../.test.env", false)
-	router, module, shutdown := create(env)
+	router, module, shutdown, err := create(env)
+	if err != nil {
+		panic(err)
+	}
 	ts := httptest.NewServer(router.GetEngine())
 	teardown := func() {
 		ts.Close()